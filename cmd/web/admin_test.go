@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newAdminTestClients signs up an admin, the first user, and a regular user on the same server
+func newAdminTestClients(t *testing.T) (*testClient, *testClient, models.User) {
+	t.Helper()
+
+	admin := newTestClient(t)
+	admin.signup("Ada", "ada@example.com", "password")
+
+	user := newTestClientFor(t, admin)
+	user.signup("Julia", "julia@example.com", "password")
+
+	julia, err := admin.db.GetUserByEmail("julia@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return admin, user, julia
+}
+
+func TestAdminRequiresAdminRole(t *testing.T) {
+	admin, user, julia := newAdminTestClients(t)
+	id := strconv.Itoa(julia.ID)
+
+	_, body := admin.get("/")
+	if !strings.Contains(body, `href="/admin/users"`) {
+		t.Error("expected admin link in the nav")
+	}
+	_, body = user.get("/")
+	if strings.Contains(body, `href="/admin/users"`) {
+		t.Error("expected admin link to be hidden from regular users")
+	}
+
+	for _, path := range []string{"/admin/users", "/admin/recipes", "/admin/audit"} {
+		res, _ := user.get(path)
+		expectRedirect(t, res, "/")
+		res, _ = admin.get(path)
+		expectStatus(t, res, http.StatusOK)
+	}
+	res, _ := user.postForm("/admin/users/disable/"+id, nil)
+	expectStatus(t, res, http.StatusForbidden)
+
+	anonymous := newTestClientFor(t, admin)
+	res, _ = anonymous.get("/admin/users")
+	expectRedirect(t, res, "/user/login")
+}
+
+func TestAdminUsers(t *testing.T) {
+	admin, _, _ := newAdminTestClients(t)
+
+	_, body := admin.get("/admin/users")
+	if !strings.Contains(body, "ada@example.com") || !strings.Contains(body, "julia@example.com") {
+		t.Error("expected every user to be listed")
+	}
+
+	_, body = admin.get("/admin/users?q=JULIA")
+	if strings.Contains(body, "ada@example.com") || !strings.Contains(body, "julia@example.com") {
+		t.Error("expected search to filter users by name or email")
+	}
+}
+
+func TestAdminDisableUser(t *testing.T) {
+	admin, user, julia := newAdminTestClients(t)
+	id := strconv.Itoa(julia.ID)
+
+	res, _ := admin.postForm("/admin/users/disable/"+id, nil)
+	expectRedirect(t, res, "/admin/users")
+	_, body := admin.get("/admin/users")
+	if !strings.Contains(body, "Disabled") {
+		t.Error("expected user to be shown as disabled")
+	}
+
+	// The existing session is logged out
+	res, _ = user.get("/recipe/new")
+	expectRedirect(t, res, "/user/login")
+
+	// And logging in again is refused
+	res, _ = user.postForm("/user/login", url.Values{"email": {"julia@example.com"}, "password": {"password"}})
+	expectRedirect(t, res, "/")
+	_, body = user.get("/")
+	if !strings.Contains(body, "Your account has been disabled") || strings.Contains(body, "Welcome Julia") {
+		t.Error("expected disabled user to be refused")
+	}
+
+	res, _ = admin.postForm("/admin/users/enable/"+id, nil)
+	expectRedirect(t, res, "/admin/users")
+	res, _ = user.postForm("/user/login", url.Values{"email": {"julia@example.com"}, "password": {"password"}})
+	expectRedirect(t, res, "/")
+	_, body = user.get("/")
+	if !strings.Contains(body, "Welcome Julia") {
+		t.Error("expected enabled user to log in")
+	}
+}
+
+func TestAdminCannotChangeOwnAccount(t *testing.T) {
+	admin, _, _ := newAdminTestClients(t)
+	ada, err := admin.db.GetUserByEmail("ada@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := strconv.Itoa(ada.ID)
+
+	for _, path := range []string{"/admin/users/disable/", "/admin/users/delete/", "/admin/users/roles/"} {
+		res, _ := admin.postForm(path+id, url.Values{"role": {models.RoleAdmin}, "action": {"revoke"}})
+		expectRedirect(t, res, "/admin/users")
+	}
+
+	ada, err = admin.db.GetUserById(ada.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ada.Disabled || !ada.HasRole(models.RoleAdmin) {
+		t.Errorf("expected admin account to be unchanged, got %+v", ada)
+	}
+}
+
+func TestAdminUserRoles(t *testing.T) {
+	admin, user, julia := newAdminTestClients(t)
+	id := strconv.Itoa(julia.ID)
+
+	res, _ := admin.postForm("/admin/users/roles/"+id, url.Values{"role": {models.RoleAdmin}, "action": {"assign"}})
+	expectRedirect(t, res, "/admin/users")
+	res, _ = user.get("/admin/users")
+	expectStatus(t, res, http.StatusOK)
+
+	res, _ = admin.postForm("/admin/users/roles/"+id, url.Values{"role": {models.RoleAdmin}, "action": {"revoke"}})
+	expectRedirect(t, res, "/admin/users")
+	res, _ = user.get("/admin/users")
+	expectRedirect(t, res, "/")
+
+	// Unknown roles and actions are rejected
+	res, _ = admin.postForm("/admin/users/roles/"+id, url.Values{"role": {"chef"}, "action": {"assign"}})
+	expectRedirect(t, res, "/admin/users")
+	res, _ = admin.postForm("/admin/users/roles/"+id, url.Values{"role": {models.RoleEditor}, "action": {"promote"}})
+	expectRedirect(t, res, "/admin/users")
+	roles, err := admin.db.GetUserRoles(julia.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 0 {
+		t.Errorf("expected no roles, got %v", roles)
+	}
+}
+
+func TestAdminDeleteUser(t *testing.T) {
+	admin, user, julia := newAdminTestClients(t)
+	user.createRecipe(soupJson)
+
+	res, _ := admin.postForm("/admin/users/delete/"+strconv.Itoa(julia.ID), nil)
+	expectRedirect(t, res, "/admin/users")
+
+	_, body := admin.get("/admin/users")
+	if !strings.Contains(body, "Deleted julia@example.com") {
+		t.Error("expected a flash message")
+	}
+	_, body = admin.get("/admin/users")
+	if strings.Contains(body, "julia@example.com") {
+		t.Error("expected user to be deleted")
+	}
+	_, body = admin.get("/")
+	if strings.Contains(body, "Tomato Soup") {
+		t.Error("expected the user's recipes to be deleted")
+	}
+	res, _ = user.get("/recipe/new")
+	expectRedirect(t, res, "/user/login")
+
+	res, _ = admin.postForm("/admin/users/delete/999", nil)
+	expectRedirect(t, res, "/admin/users")
+	res, _ = admin.postForm("/admin/users/delete/abc", nil)
+	expectStatus(t, res, http.StatusBadRequest)
+}
+
+func TestAdminRecipes(t *testing.T) {
+	admin, user, _ := newAdminTestClients(t)
+	id := user.createRecipe(soupJson)
+
+	_, body := admin.get("/admin/recipes")
+	if !strings.Contains(body, "Tomato Soup") || !strings.Contains(body, "Created by: Julia") {
+		t.Error("expected the recipe to be listed")
+	}
+
+	// Recipes are listed a page at a time
+	for i := 1; i <= 12; i++ {
+		user.createRecipe(fmt.Sprintf(`{"title": "Recipe %d", "ingredients": [{"name": "water", "amount": "1"}],
+			"directions": [{"direction": "Boil"}]}`, i))
+	}
+	_, body = admin.get("/admin/recipes")
+	if strings.Contains(body, "Tomato Soup") || !strings.Contains(body, "Recipe 12") || !strings.Contains(body, "Page 1 of 2") ||
+		!strings.Contains(body, `href="/admin/recipes?page=2"`) {
+		t.Error("expected the first page of recipes")
+	}
+	_, body = admin.get("/admin/recipes?page=2")
+	if !strings.Contains(body, "Tomato Soup") || strings.Contains(body, "Recipe 12") {
+		t.Error("expected the oldest recipe on the second page")
+	}
+
+	res, _ := user.postForm("/admin/recipes/delete/"+id, nil)
+	expectStatus(t, res, http.StatusForbidden)
+
+	res, _ = admin.postForm("/admin/recipes/delete/"+id, nil)
+	expectRedirect(t, res, "/admin/recipes")
+	res, _ = user.get("/recipe/details/" + id)
+	expectStatus(t, res, http.StatusTemporaryRedirect)
+
+	res, _ = admin.postForm("/admin/recipes/delete/"+id, nil)
+	expectRedirect(t, res, "/admin/recipes")
+}
+
+func TestAdminAudit(t *testing.T) {
+	admin, user, julia := newAdminTestClients(t)
+	id := user.createRecipe(soupJson)
+
+	admin.postForm("/admin/users/roles/"+strconv.Itoa(julia.ID), url.Values{"role": {models.RoleEditor}, "action": {"assign"}})
+	admin.postForm("/admin/users/disable/"+strconv.Itoa(julia.ID), nil)
+	admin.postForm("/admin/recipes/delete/"+id, nil)
+
+	_, body := admin.get("/admin/audit")
+	for _, want := range []string{
+		"Ada - " + models.ActionAssignRole, "julia@example.com: editor",
+		"Ada - " + models.ActionDisableUser,
+		"Ada - " + models.ActionDeleteRecipe, "Tomato Soup by Julia",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected audit log to contain %q", want)
+		}
+	}
+	// Newest first
+	if strings.Index(body, models.ActionDeleteRecipe) > strings.Index(body, models.ActionAssignRole) {
+		t.Error("expected newest actions first")
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// api sends an API request with token as the Bearer token, if any, and no session cookie or CSRF token.
+// The response is checked against the OpenAPI document.
+func (c *testClient) api(method, path, token, body string) (*http.Response, string) {
+	c.t.Helper()
+
+	req, err := http.NewRequest(method, c.server.URL+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	checkResponse(c.t, res, string(b))
+	return res, string(b)
+}
+
+// apiToken creates an API token for a user that signed up before
+func (c *testClient) apiToken(email, password string) string {
+	c.t.Helper()
+
+	res, body := c.api(http.MethodPost, "/api/v1/tokens", "", fmt.Sprintf(`{"email": %q, "password": %q, "name": "test"}`, email, password))
+	expectStatus(c.t, res, http.StatusCreated)
+
+	var token models.JsonToken
+	decodeBody(c.t, body, &token)
+	if !strings.HasPrefix(token.Token, "rcp_") || token.Name != "test" {
+		c.t.Fatalf("unexpected token %+v", token)
+	}
+	return token.Token
+}
+
+// decodeBody decodes a JSON response body into v
+func decodeBody(t *testing.T, body string, v interface{}) {
+	t.Helper()
+	err := json.Unmarshal([]byte(body), v)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+}
+
+// expectFieldError fails the test when body is not a JSON error with a message for field
+func expectFieldError(t *testing.T, body, field string) {
+	t.Helper()
+	var apiError models.JsonError
+	decodeBody(t, body, &apiError)
+	if len(apiError.Fields[field]) == 0 {
+		t.Errorf("expected an error for %s, got %s", field, body)
+	}
+}
+
+func TestApiTokens(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+
+	res, body := c.api(http.MethodPost, "/api/v1/tokens", "", `{"email": "julia@example.com", "password": "wrong"}`)
+	expectStatus(t, res, http.StatusUnauthorized)
+	res, body = c.api(http.MethodPost, "/api/v1/tokens", "", `{"email": ""}`)
+	expectStatus(t, res, http.StatusBadRequest)
+	expectFieldError(t, body, "email")
+	expectFieldError(t, body, "password")
+	res, _ = c.api(http.MethodPost, "/api/v1/tokens", "", `{`)
+	expectStatus(t, res, http.StatusBadRequest)
+
+	token := c.apiToken("julia@example.com", "password")
+	res, body = c.api(http.MethodGet, "/api/v1/user", token, "")
+	expectStatus(t, res, http.StatusOK)
+	var user models.JsonUser
+	decodeBody(t, body, &user)
+	if user.Name != "Julia" || user.Email != "julia@example.com" || len(user.Roles) != 1 || user.Roles[0] != models.RoleAdmin {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	res, _ = c.api(http.MethodGet, "/api/v1/user", "", "")
+	expectStatus(t, res, http.StatusUnauthorized)
+	if res.Header.Get("WWW-Authenticate") == "" {
+		t.Error("expected a WWW-Authenticate header")
+	}
+	res, _ = c.api(http.MethodGet, "/api/v1/user", "rcp_not-a-token", "")
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	// Tokens stop working when the account is disabled
+	julia, err := c.db.GetUserByEmail("julia@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.db.SetUserDisabled(julia.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _ = c.api(http.MethodGet, "/api/v1/user", token, "")
+	expectStatus(t, res, http.StatusForbidden)
+	res, _ = c.api(http.MethodPost, "/api/v1/tokens", "", `{"email": "julia@example.com", "password": "password"}`)
+	expectStatus(t, res, http.StatusForbidden)
+}
+
+func TestApiRecipes(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	token := c.apiToken("julia@example.com", "password")
+
+	// Creating a recipe needs a token, not a session or CSRF token
+	res, _ := c.api(http.MethodPost, "/api/v1/recipes", "", soupJson)
+	expectStatus(t, res, http.StatusUnauthorized)
+	res, body := c.api(http.MethodPost, "/api/v1/recipes", token, soupJson)
+	expectStatus(t, res, http.StatusCreated)
+
+	var created models.JsonRecipeDetails
+	decodeBody(t, body, &created)
+	if created.ID == 0 || created.Title != "Tomato Soup" || created.Author.Name != "Julia" ||
+		len(created.Ingredients) != 2 || len(created.Directions) != 2 {
+		t.Errorf("unexpected recipe %+v", created)
+	}
+	location := fmt.Sprintf("/api/v1/recipes/%d", created.ID)
+	if got := res.Header.Get("Location"); got != location {
+		t.Errorf("expected Location %s, got %s", location, got)
+	}
+
+	res, body = c.api(http.MethodGet, location, "", "")
+	expectStatus(t, res, http.StatusOK)
+	var fetched models.JsonRecipeDetails
+	decodeBody(t, body, &fetched)
+	if fetched.ID != created.ID || fetched.Ingredients[1].Name != "salt" {
+		t.Errorf("unexpected recipe %+v", fetched)
+	}
+
+	res, body = c.api(http.MethodGet, "/api/v1/recipes", "", "")
+	expectStatus(t, res, http.StatusOK)
+	var list models.JsonRecipeList
+	decodeBody(t, body, &list)
+	if list.Total != 1 || list.Page != 1 || len(list.Recipes) != 1 || list.Recipes[0].Author.Name != "Julia" {
+		t.Errorf("unexpected list %+v", list)
+	}
+
+	var tests = []struct {
+		name  string
+		query string
+		field string
+	}{
+		{"page", "?page=0", "page"},
+		{"limit", "?limit=1000", "limit"},
+		{"sort", "?sort=random", "sort"},
+	}
+	for _, e := range tests {
+		t.Run(e.name, func(t *testing.T) {
+			res, body := c.api(http.MethodGet, "/api/v1/recipes"+e.query, "", "")
+			expectStatus(t, res, http.StatusBadRequest)
+			expectFieldError(t, body, e.field)
+		})
+	}
+
+	// Field errors are keyed by the path of the field
+	res, body = c.api(http.MethodPost, "/api/v1/recipes", token, `{"title": " ", "ingredients": [{"name": "salt"}, {"name": ""}]}`)
+	expectStatus(t, res, http.StatusBadRequest)
+	expectFieldError(t, body, "title")
+	expectFieldError(t, body, "ingredients[1].name")
+
+	// Updates answer with the saved recipe
+	update := fmt.Sprintf(`{"title": "Roasted Tomato Soup", "ingredients": [{"name": "tomatoes", "amount": "6"}],
+		"directions": [{"direction": "Roast"}], "updated_at": %q}`,
+		fetched.UpdatedAt.Format(time.RFC3339Nano))
+	res, body = c.api(http.MethodPut, location, token, update)
+	expectStatus(t, res, http.StatusOK)
+	var updated models.JsonRecipeDetails
+	decodeBody(t, body, &updated)
+	if updated.Title != "Roasted Tomato Soup" || len(updated.Directions) != 1 || len(updated.Ingredients) != 1 {
+		t.Errorf("unexpected recipe %+v", updated)
+	}
+
+	// Updating with a stale updated_at is a conflict
+	stale := fmt.Sprintf(`{"title": "Stale", "updated_at": %q}`, fetched.UpdatedAt.Add(-time.Hour).Format(time.RFC3339Nano))
+	res, _ = c.api(http.MethodPut, location, token, stale)
+	expectStatus(t, res, http.StatusConflict)
+	res, body = c.api(http.MethodPut, location, token, fmt.Sprintf(`{"id": %d, "title": "Soup"}`, created.ID+1))
+	expectStatus(t, res, http.StatusBadRequest)
+	expectFieldError(t, body, "id")
+
+	// Only the author may change or delete a recipe
+	other := newTestClientFor(t, c)
+	other.signup("Jules", "jules@example.com", "password")
+	otherToken := other.apiToken("jules@example.com", "password")
+	res, _ = c.api(http.MethodPut, location, otherToken, `{"title": "Mine now"}`)
+	expectStatus(t, res, http.StatusForbidden)
+	res, _ = c.api(http.MethodDelete, location, otherToken, "")
+	expectStatus(t, res, http.StatusForbidden)
+
+	res, _ = c.api(http.MethodDelete, location, token, "")
+	expectStatus(t, res, http.StatusNoContent)
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		res, _ = c.api(method, location, token, `{"title": "Gone"}`)
+		expectStatus(t, res, http.StatusNotFound)
+	}
+
+	res, body = c.api(http.MethodGet, "/api/v1/nowhere", "", "")
+	expectStatus(t, res, http.StatusNotFound)
+	if !strings.Contains(body, `"error"`) {
+		t.Errorf("expected a JSON error for an unknown API route, got %s", body)
+	}
+}
+
+func TestApiRecipeOrder(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	token := c.apiToken("julia@example.com", "password")
+
+	res, body := c.api(http.MethodPost, "/api/v1/recipes", token, `{"title": "Tomato Soup",
+		"ingredients": [{"name": "tomatoes"}, {"name": "salt"}],
+		"directions": [{"direction": "Chop"}, {"direction": "Simmer"}, {"direction": "Blend"}]}`)
+	expectStatus(t, res, http.StatusCreated)
+	var recipe models.JsonRecipeDetails
+	decodeBody(t, body, &recipe)
+	for i, direction := range recipe.Directions {
+		if direction.Position != i {
+			t.Errorf("expected direction %d at %d, got %+v", direction.Id, i, direction)
+		}
+	}
+	path := fmt.Sprintf("/api/v1/recipes/%d/order", recipe.ID)
+	directions := recipe.Directions
+
+	// Directions are moved without saving the recipe, ingredients that aren't listed keep their order
+	order := fmt.Sprintf(`{"directions": [%d, %d, %d]}`, directions[2].Id, directions[0].Id, directions[1].Id)
+	res, body = c.api(http.MethodPut, path, token, order)
+	expectStatus(t, res, http.StatusOK)
+	var reordered models.JsonRecipeDetails
+	decodeBody(t, body, &reordered)
+	var steps []string
+	for i, direction := range reordered.Directions {
+		steps = append(steps, direction.Direction)
+		if direction.Position != i {
+			t.Errorf("expected direction %d at %d, got %+v", direction.Id, i, direction)
+		}
+	}
+	if strings.Join(steps, ",") != "Blend,Chop,Simmer" || reordered.Directions[0].Id != directions[2].Id ||
+		reordered.Ingredients[0].Name != "tomatoes" {
+		t.Errorf("unexpected order %+v %+v", reordered.Directions, reordered.Ingredients)
+	}
+
+	tests := []struct {
+		name  string
+		body  string
+		field string
+	}{
+		{"missing direction", fmt.Sprintf(`{"directions": [%d, %d]}`, directions[2].Id, directions[0].Id), "directions"},
+		{"twice", fmt.Sprintf(`{"ingredients": [%d, %d]}`, recipe.Ingredients[0].Id, recipe.Ingredients[0].Id), "ingredients"},
+		{"other recipe", fmt.Sprintf(`{"ingredients": [%d, 999]}`, recipe.Ingredients[0].Id), "ingredients"},
+	}
+	for _, e := range tests {
+		t.Run(e.name, func(t *testing.T) {
+			res, body := c.api(http.MethodPut, path, token, e.body)
+			expectStatus(t, res, http.StatusBadRequest)
+			expectFieldError(t, body, e.field)
+		})
+	}
+
+	// Only the author or an admin may move steps
+	other := newTestClientFor(t, c)
+	other.signup("James", "james@example.com", "password")
+	res, _ = other.api(http.MethodPut, path, other.apiToken("james@example.com", "password"), order)
+	expectStatus(t, res, http.StatusForbidden)
+	res, _ = c.api(http.MethodPut, path, "", order)
+	expectStatus(t, res, http.StatusUnauthorized)
+	res, _ = c.api(http.MethodPut, "/api/v1/recipes/999/order", token, order)
+	expectStatus(t, res, http.StatusNotFound)
+}
+
+func TestApiIngredientQuantities(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	token := c.apiToken("julia@example.com", "password")
+
+	res, body := c.api(http.MethodPost, "/api/v1/recipes", token, `{"title": "Tomato Soup", "ingredients": [
+		{"name": "tomatoes", "amount": "1 1/2", "unit": "lb"}, {"name": "stock", "amount": "2-3", "unit": "cups"},
+		{"name": "salt", "amount": "to taste"}, {"name": "basil"}], "directions": [{"direction": "Simmer"}]}`)
+	expectStatus(t, res, http.StatusCreated)
+	var recipe models.JsonRecipeDetails
+	decodeBody(t, body, &recipe)
+
+	// The amount is kept as it was typed, along with the numbers it was parsed into
+	want := []*models.JsonQuantity{{Min: 1.5, Max: 1.5}, {Min: 2, Max: 3}, {ToTaste: true}, nil}
+	for i, ingredient := range recipe.Ingredients {
+		if (ingredient.Quantity == nil) != (want[i] == nil) || ingredient.Quantity != nil && *ingredient.Quantity != *want[i] {
+			t.Errorf("%s: expected %+v, got %+v", ingredient.Name, want[i], ingredient.Quantity)
+		}
+	}
+	if recipe.Ingredients[0].Amount != "1 1/2" {
+		t.Errorf("expected the amount as it was typed, got %q", recipe.Ingredients[0].Amount)
+	}
+
+	res, body = c.api(http.MethodPost, "/api/v1/recipes", token, `{"title": "Soup", "ingredients": [
+		{"name": "salt", "amount": "a pinch"}], "directions": [{"direction": "Simmer"}]}`)
+	expectStatus(t, res, http.StatusBadRequest)
+	expectFieldError(t, body, "ingredients[0].amount")
+}
+
+func TestApiRecipeUnits(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	token := c.apiToken("julia@example.com", "password")
+
+	res, body := c.api(http.MethodPost, "/api/v1/recipes", token, `{"title": "Tomato Soup", "ingredients": [
+		{"name": "tomatoes", "amount": "1 1/2", "unit": "lb"}, {"name": "stock", "amount": "2-3", "unit": "Cups"},
+		{"name": "salt", "amount": "to taste"}], "directions": [{"direction": "Simmer"}]}`)
+	expectStatus(t, res, http.StatusCreated)
+	var recipe models.JsonRecipeDetails
+	decodeBody(t, body, &recipe)
+	path := fmt.Sprintf("/api/v1/recipes/%d", recipe.ID)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"1 1/2 lb", "2-3 Cups", "to taste "}},
+		{"?units=metric", []string{"680 g", "475-710 ml", "to taste "}},
+		{"?units=imperial", []string{"1 1/2 lb", "2-3 Cups", "to taste "}},
+	}
+	for _, e := range tests {
+		res, body = c.api(http.MethodGet, path+e.query, "", "")
+		expectStatus(t, res, http.StatusOK)
+		decodeBody(t, body, &recipe)
+		var got []string
+		for _, ingredient := range recipe.Ingredients {
+			got = append(got, ingredient.Amount+" "+ingredient.Unit)
+		}
+		if !slices.Equal(got, e.want) {
+			t.Errorf("%s: expected %q, got %q", e.query, e.want, got)
+		}
+	}
+
+	// The quantity is converted with the amount
+	_, body = c.api(http.MethodGet, path+"?units=metric", "", "")
+	decodeBody(t, body, &recipe)
+	if quantity := recipe.Ingredients[1].Quantity; quantity == nil || math.Round(quantity.Max) != 710 {
+		t.Errorf("expected about 710 ml, got %+v", quantity)
+	}
+
+	res, body = c.api(http.MethodGet, path+"?units=kelvin", "", "")
+	expectStatus(t, res, http.StatusBadRequest)
+	expectFieldError(t, body, "units")
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/popnfresh234/recipe-app-golang/internal/handlers"
+	"github.com/popnfresh234/recipe-app-golang/internal/images"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var imageSrc = regexp.MustCompile(`src="/images/([^"]+)"`)
+var imageSrcset = regexp.MustCompile(`srcset="([^"]+)"`)
+
+// testPNG encodes an opaque width by height PNG
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRecipeImages(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+
+	upload := base64.StdEncoding.EncodeToString(testPNG(t, 1600, 800))
+	recipe := fmt.Sprintf(`{"title": "Tomato Soup", "ingredients": [{"name": "tomatoes"}], "directions": [{"direction": "Simmer"}],
+		"image": %q}`, upload)
+	id := c.createRecipe(recipe)
+
+	// The API answers with the key and the URL of the image, opaque images are stored as JPEGs
+	res, body := c.api(http.MethodGet, "/api/v1/recipes/"+id, "", "")
+	expectStatus(t, res, http.StatusOK)
+	var details models.JsonRecipeDetails
+	decodeBody(t, body, &details)
+	key := details.Image
+	if !images.ValidKey(key) || !strings.HasSuffix(key, ".jpg") || details.ImageURL != "/images/"+key {
+		t.Fatalf("expected the image key and URL, got %q %q", details.Image, details.ImageURL)
+	}
+
+	// The pages link to the resized copies instead of embedding the image
+	_, body = c.get("/recipe/details/" + id)
+	if matches := imageSrc.FindStringSubmatch(body); matches == nil || matches[1] != images.SizeKey(key, images.DetailWidth) {
+		t.Errorf("expected the details page to show the detail size, got %v", matches)
+	}
+	if strings.Contains(body, upload) {
+		t.Error("expected the image not to be embedded in the page")
+	}
+	srcset := fmt.Sprintf("/images/%s %dw, /images/%s %dw", images.SizeKey(key, images.ThumbWidth), images.ThumbWidth,
+		images.SizeKey(key, images.DetailWidth), images.DetailWidth)
+	for _, page := range []string{"/recipe/details/" + id, "/"} {
+		_, body = c.get(page)
+		if matches := imageSrcset.FindStringSubmatch(body); matches == nil || matches[1] != srcset {
+			t.Errorf("%s: expected the srcset %q, got %v", page, srcset, matches)
+		}
+	}
+
+	anonymous := newTestClientFor(t, c)
+	for key, width := range map[string]int{
+		key:                                     1600,
+		images.SizeKey(key, images.ThumbWidth):  images.ThumbWidth,
+		images.SizeKey(key, images.DetailWidth): images.DetailWidth,
+	} {
+		res, data := anonymous.get("/images/" + key)
+		expectStatus(t, res, http.StatusOK)
+		checkResponse(t, res, data)
+		config, err := jpeg.DecodeConfig(strings.NewReader(data))
+		if err != nil || config.Width != width || res.Header.Get("Content-Type") != "image/jpeg" {
+			t.Errorf("%s: expected a JPEG %d wide, got %+v %s %v", key, width, config, res.Header.Get("Content-Type"), err)
+		}
+		if !strings.Contains(res.Header.Get("Cache-Control"), "immutable") || res.Header.Get("ETag") != `"`+key+`"` {
+			t.Errorf("expected the image to be cacheable, got %v", res.Header)
+		}
+		if res.Header.Get("Set-Cookie") != "" {
+			t.Error("expected images to be served without a session")
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.server.URL+"/images/"+key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-None-Match", `"`+key+`"`)
+	res, _ = anonymous.send(req)
+	expectStatus(t, res, http.StatusNotModified)
+
+	for _, missing := range []string{
+		strings.Repeat("0", 64) + ".png",
+		images.SizeKey(strings.Repeat("0", 64)+".png", images.ThumbWidth),
+		images.SizeKey(key, 123),
+		"..%2Fsetup_test.go",
+		"nothing",
+	} {
+		res, body = anonymous.get("/images/" + missing)
+		expectStatus(t, res, http.StatusNotFound)
+		checkResponse(t, res, body)
+	}
+
+	// Saving the edit page with the key keeps the image, and the same upload is stored once
+	edited := fmt.Sprintf(`{"id": %s, "title": "Roasted Tomato Soup", "ingredients": [{"name": "tomatoes"}],
+		"directions": [{"direction": "Roast"}], "image": %q}`, id, key)
+	res, _ = c.postJSON("/recipe/edit/"+id, edited)
+	expectRedirect(t, res, "/")
+	second := c.createRecipe(recipe)
+	for _, recipeID := range []string{id, second} {
+		_, body = c.get("/recipe/details/" + recipeID)
+		if matches := imageSrc.FindStringSubmatch(body); matches == nil || matches[1] != images.SizeKey(key, images.DetailWidth) {
+			t.Errorf("recipe %s: expected image %s, got %v", recipeID, key, matches)
+		}
+	}
+
+	// Images that only look like images are refused
+	broken := fmt.Sprintf(`{"title": "Soup", "ingredients": [{"name": "tomatoes"}], "directions": [{"direction": "Simmer"}],
+		"image": %q}`, base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\ntomato soup")))
+	res, body = c.postJSON("/recipe/new", broken)
+	expectStatus(t, res, http.StatusBadRequest)
+	checkResponse(t, res, body)
+	var jsonError models.JsonError
+	decodeBody(t, body, &jsonError)
+	if len(jsonError.Fields["image"]) == 0 {
+		t.Errorf("expected an error for the image, got %+v", jsonError)
+	}
+}
+
+func TestResizedImagesOfOlderImages(t *testing.T) {
+	c := newTestClient(t)
+
+	// Images stored before there were resized copies get them when they are first asked for
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 900, 300)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := strings.Repeat("1", 64) + ".jpg"
+	err = app.Images.Put(context.Background(), key, buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, data := c.get("/images/" + images.SizeKey(key, images.ThumbWidth))
+	expectStatus(t, res, http.StatusOK)
+	config, err := jpeg.DecodeConfig(strings.NewReader(data))
+	if err != nil || config.Width != images.ThumbWidth {
+		t.Errorf("expected a thumbnail, got %+v %v", config, err)
+	}
+	_, err = app.Images.Get(context.Background(), images.SizeKey(key, images.ThumbWidth))
+	if err != nil {
+		t.Errorf("expected the thumbnail to be stored, got %v", err)
+	}
+}
+
+// upload posts data as a file in field of a multipart form, with token as the Bearer token
+// or, without one, with the session and its CSRF token like the page scripts
+func (c *testClient) upload(path, token, field string, data []byte) (*http.Response, string) {
+	c.t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile(field, "photo.jpg")
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	_, _ = part.Write(data)
+	_ = form.Close()
+
+	req, err := http.NewRequest(http.MethodPost, c.server.URL+path, &body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		req.Header.Set("X-CSRF-Token", c.csrfToken())
+	}
+	res, b := c.send(req)
+	checkResponse(c.t, res, b)
+	return res, b
+}
+
+func TestImageUpload(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	token := c.apiToken("julia@example.com", "password")
+	photo := testPNG(t, 1600, 800)
+
+	// The pages upload the image first and post the recipe with its id
+	res, body := c.upload("/recipe/images", "", "image", photo)
+	expectStatus(t, res, http.StatusCreated)
+	var uploaded models.JsonImage
+	decodeBody(t, body, &uploaded)
+	if !images.ValidKey(uploaded.ID) || uploaded.URL != "/images/"+uploaded.ID || res.Header.Get("Location") != uploaded.URL {
+		t.Fatalf("expected the id and URL of the image, got %+v %s", uploaded, res.Header.Get("Location"))
+	}
+	id := c.createRecipe(fmt.Sprintf(`{"title": "Tomato Soup", "ingredients": [{"name": "tomatoes"}],
+		"directions": [{"direction": "Simmer"}], "image": %q}`, uploaded.ID))
+	_, body = c.get("/recipe/details/" + id)
+	if matches := imageSrc.FindStringSubmatch(body); matches == nil || matches[1] != images.SizeKey(uploaded.ID, images.DetailWidth) {
+		t.Errorf("expected the recipe to show the uploaded image, got %v", matches)
+	}
+
+	// The API does the same with a token, and the same image has the same id
+	res, body = c.upload("/api/v1/images", token, "image", photo)
+	expectStatus(t, res, http.StatusCreated)
+	var again models.JsonImage
+	decodeBody(t, body, &again)
+	if again.ID != uploaded.ID {
+		t.Errorf("expected the same id, got %s and %s", uploaded.ID, again.ID)
+	}
+	res, body = c.api(http.MethodPost, "/api/v1/recipes", token, fmt.Sprintf(`{"title": "Gazpacho",
+		"ingredients": [{"name": "tomatoes"}], "directions": [{"direction": "Blend"}], "image": %q}`, again.ID))
+	expectStatus(t, res, http.StatusCreated)
+	var details models.JsonRecipeDetails
+	decodeBody(t, body, &details)
+	if details.Image != uploaded.ID {
+		t.Errorf("expected the recipe to reference the image, got %q", details.Image)
+	}
+
+	tests := []struct {
+		name   string
+		field  string
+		data   []byte
+		status int
+	}{
+		{"not an image", "image", []byte("tomato soup"), http.StatusUnsupportedMediaType},
+		{"gif", "image", []byte("GIF89a"), http.StatusUnsupportedMediaType},
+		{"broken png", "image", []byte("\x89PNG\r\n\x1a\ntomato soup"), http.StatusBadRequest},
+		{"other field", "photo", photo, http.StatusBadRequest},
+		{"too large", "image", append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, images.MaxUploadBytes)...), http.StatusRequestEntityTooLarge},
+	}
+	for _, e := range tests {
+		t.Run(e.name, func(t *testing.T) {
+			res, body := c.upload("/api/v1/images", token, e.field, e.data)
+			expectStatus(t, res, e.status)
+			var jsonError models.JsonError
+			decodeBody(t, body, &jsonError)
+			if len(jsonError.Fields["image"]) == 0 {
+				t.Errorf("expected an error for the image, got %+v", jsonError)
+			}
+		})
+	}
+
+	res, body = c.api(http.MethodPost, "/api/v1/images", token, `{"image": "aW1hZ2U="}`)
+	expectStatus(t, res, http.StatusBadRequest)
+
+	// Uploads need a user, and pages need the CSRF token
+	anonymous := newTestClient(t)
+	res, _ = anonymous.upload("/api/v1/images", "", "image", photo)
+	expectStatus(t, res, http.StatusUnauthorized)
+	res, _ = anonymous.upload("/recipe/images", "", "image", photo)
+	expectStatus(t, res, http.StatusUnauthorized)
+	res, body = c.do(http.MethodPost, "/recipe/images", "multipart/form-data; boundary=x", strings.NewReader("--x--"))
+	expectStatus(t, res, http.StatusForbidden)
+	checkResponse(t, res, body)
+}
+
+func TestUnusedUploads(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+
+	var keys []string
+	for _, width := range []int{700, 710} {
+		res, body := c.upload("/recipe/images", "", "image", testPNG(t, width, 300))
+		expectStatus(t, res, http.StatusCreated)
+		var uploaded models.JsonImage
+		decodeBody(t, body, &uploaded)
+		keys = append(keys, uploaded.ID)
+	}
+	c.createRecipe(fmt.Sprintf(`{"title": "Tomato Soup", "ingredients": [{"name": "tomatoes"}],
+		"directions": [{"direction": "Simmer"}], "image": %q}`, keys[0]))
+
+	// Uploads are kept for a day, then only the ones a recipe uses are left
+	handlers.Repo.RemoveUnusedUploads()
+	res, _ := c.get("/images/" + keys[1])
+	expectStatus(t, res, http.StatusOK)
+	removed, err := c.db.DeleteUploads(time.Now().Add(time.Minute))
+	if err != nil || removed != 1 {
+		t.Errorf("expected 1 image to be removed, got %d %v", removed, err)
+	}
+	res, _ = c.get("/images/" + keys[0])
+	expectStatus(t, res, http.StatusOK)
+	for _, key := range []string{keys[1], images.SizeKey(keys[1], images.ThumbWidth)} {
+		res, _ = c.get("/images/" + key)
+		expectStatus(t, res, http.StatusNotFound)
+	}
+
+	// Each user can upload a limited number of images a day
+	user, err := c.db.GetUserByEmail("julia@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < images.UploadsPerDay; i++ {
+		err = c.db.InsertUpload(user.ID, keys[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, body := c.upload("/recipe/images", "", "image", testPNG(t, 720, 300))
+	expectStatus(t, res, http.StatusTooManyRequests)
+	checkResponse(t, res, body)
+}
+
+func TestRecipePhotos(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	token := c.apiToken("julia@example.com", "password")
+
+	var keys []string
+	for _, width := range []int{800, 900, 1000} {
+		res, body := c.upload("/recipe/images", "", "image", testPNG(t, width, 600))
+		expectStatus(t, res, http.StatusCreated)
+		var uploaded models.JsonImage
+		decodeBody(t, body, &uploaded)
+		keys = append(keys, uploaded.ID)
+	}
+
+	id := c.createRecipe(fmt.Sprintf(`{"title": "Tomato Soup", "ingredients": [{"name": "tomatoes"}],
+		"directions": [{"direction": "Roast"}, {"direction": "Blend", "photos": [{"image": %q, "caption": "Smooth"}]}],
+		"photos": [{"image": %q, "caption": "Plated"}, {"image": %q, "caption": "With bread"}]}`, keys[2], keys[1], keys[0]))
+
+	// The photos are shown in the order they were posted in, the photos of directions as thumbnails
+	_, body := c.get("/recipe/details/" + id)
+	caption := func(text string) int { return strings.Index(body, `text-xs">`+text+"<") }
+	plated, bread, smooth := caption("Plated"), caption("With bread"), caption("Smooth")
+	if plated < 0 || bread < plated || smooth < bread {
+		t.Errorf("expected the photos in order, got %d %d %d", plated, bread, smooth)
+	}
+	for _, src := range []string{images.SizeKey(keys[1], images.DetailWidth), images.SizeKey(keys[0], images.DetailWidth),
+		images.SizeKey(keys[2], images.ThumbWidth)} {
+		if !strings.Contains(body, `src="/images/`+src+`"`) {
+			t.Errorf("expected the details page to show %s", src)
+		}
+	}
+
+	res, body := c.api(http.MethodGet, "/api/v1/recipes/"+id, token, "")
+	expectStatus(t, res, http.StatusOK)
+	var details models.JsonRecipeDetails
+	decodeBody(t, body, &details)
+	want := []models.JsonPhoto{
+		{Image: keys[1], Caption: "Plated", URL: "/images/" + keys[1]},
+		{Image: keys[0], Caption: "With bread", URL: "/images/" + keys[0]},
+	}
+	if !slices.Equal(details.Photos, want) {
+		t.Errorf("expected %+v, got %+v", want, details.Photos)
+	}
+	if len(details.Directions) != 2 || len(details.Directions[0].Photos) != 0 || len(details.Directions[1].Photos) != 1 ||
+		details.Directions[1].Photos[0].Caption != "Smooth" {
+		t.Errorf("expected the second direction to have a photo, got %+v", details.Directions)
+	}
+
+	// Editing replaces the photos with the posted ones, in their new order
+	res, _ = c.postJSON("/recipe/edit/"+id, fmt.Sprintf(`{"id": %s, "title": "Tomato Soup", "ingredients": [{"name": "tomatoes"}],
+		"directions": [{"direction": "Blend"}], "photos": [{"image": %q, "caption": "With bread"}, {"image": %q, "caption": "Plated"}]}`,
+		id, keys[0], keys[1]))
+	expectRedirect(t, res, "/")
+	_, body = c.api(http.MethodGet, "/api/v1/recipes/"+id, token, "")
+	details = models.JsonRecipeDetails{}
+	decodeBody(t, body, &details)
+	if len(details.Photos) != 2 || details.Photos[0].Image != keys[0] || details.Photos[1].Image != keys[1] ||
+		len(details.Directions[0].Photos) != 0 {
+		t.Errorf("expected the photos to be reordered, got %+v %+v", details.Photos, details.Directions)
+	}
+
+	// Photos must be uploaded first
+	res, body = c.api(http.MethodPost, "/api/v1/recipes", token, fmt.Sprintf(`{"title": "Gazpacho",
+		"ingredients": [{"name": "tomatoes"}], "directions": [{"direction": "Blend"}], "photos": [{"image": %q}]}`,
+		base64.StdEncoding.EncodeToString(testPNG(t, 10, 10))))
+	expectStatus(t, res, http.StatusBadRequest)
+	expectFieldError(t, body, "photos[0].image")
+
+	// Keys must be of uploaded images, not of their resized copies or of images that were never uploaded
+	res, body = c.api(http.MethodPost, "/api/v1/recipes", token, fmt.Sprintf(`{"title": "Gazpacho",
+		"ingredients": [{"name": "tomatoes"}], "directions": [{"direction": "Blend"}], "image": %q}`,
+		images.SizeKey(keys[0], images.ThumbWidth)))
+	expectStatus(t, res, http.StatusBadRequest)
+	expectFieldError(t, body, "image")
+	res, body = c.api(http.MethodPost, "/api/v1/recipes", token, fmt.Sprintf(`{"title": "Gazpacho",
+		"ingredients": [{"name": "tomatoes"}], "directions": [{"direction": "Blend", "photos": [{"image": %q}]}],
+		"photos": [{"image": %q}, {"image": %q}]}`, keys[0], keys[1], strings.Repeat("0", 64)+".jpg"))
+	expectStatus(t, res, http.StatusBadRequest)
+	expectFieldError(t, body, "photos[1].image")
+	var jsonError models.JsonError
+	decodeBody(t, body, &jsonError)
+	if len(jsonError.Fields) != 1 {
+		t.Errorf("expected only the missing photo to be an error, got %+v", jsonError.Fields)
+	}
+	res, _ = c.postJSON("/recipe/edit/"+id, fmt.Sprintf(`{"id": %s, "title": "Tomato Soup", "ingredients": [{"name": "tomatoes"}],
+		"directions": [{"direction": "Blend"}], "image": %q}`, id, strings.Repeat("0", 64)+".png"))
+	expectStatus(t, res, http.StatusBadRequest)
+}
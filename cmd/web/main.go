@@ -2,6 +2,8 @@ package main
 
 import (
 	"encoding/gob"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-sql-driver/mysql"
@@ -9,8 +11,10 @@ import (
 	"github.com/popnfresh234/recipe-app-golang/internal/driver"
 	"github.com/popnfresh234/recipe-app-golang/internal/handlers"
 	"github.com/popnfresh234/recipe-app-golang/internal/helpers"
+	"github.com/popnfresh234/recipe-app-golang/internal/images"
 	"github.com/popnfresh234/recipe-app-golang/internal/models"
 	"github.com/popnfresh234/recipe-app-golang/internal/renderer"
+	"github.com/popnfresh234/recipe-app-golang/repository/dbrepo"
 	"log"
 	"net/http"
 	"os"
@@ -20,61 +24,115 @@ import (
 var app config.AppConfig
 var session *scs.SessionManager
 
-const portNumber = ":3400"
-
 func main() {
-	dbHost := os.Getenv("DB_HOST")
-	if dbHost == "" {
-		dbHost = "localhost:3306"
+	err := config.Load(&app, os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal("Invalid configuration:\n", err)
 	}
-	fmt.Println("DB HOST:", dbHost)
-	run(dbHost)
+	fmt.Println("DB DRIVER:", app.DBDriver)
+	run()
 
 	src := &http.Server{
-		Addr:    portNumber,
+		Addr:    app.Addr(),
 		Handler: routes(),
 	}
 
-	fmt.Printf("Starting application on port %s\n", portNumber)
+	fmt.Printf("Starting application on port %s\n", app.Port)
 
-	err := src.ListenAndServe()
+	err = src.ListenAndServe()
 	if err != nil {
 		log.Fatal("Server failed, dying...")
 	}
 
 }
 
-func run(dbHost string) {
+func run() {
 
 	//Register models for session
 	gob.Register(models.User{})
 
 	session = scs.New()
-	session.Lifetime = 24 * time.Hour
+	session.Lifetime = app.SessionLifetime
 	session.Cookie.Persist = true
 	session.Cookie.SameSite = http.SameSiteLaxMode
 	session.Cookie.Secure = app.InProduction
 
 	app.Session = session
 
-	app.InProduction = false
-	app.UseCache = false
+	if app.UseCache {
+		templateCache, err := renderer.CreateTemplateCache()
+		if err != nil {
+			log.Fatal(err)
+		}
+		app.TemplateCache = templateCache
+	}
 
 	// Connect to DB
 	fmt.Println("Attempting DB connection...")
-	dbCfg := mysql.Config{
-		User:   "admin",
-		Passwd: "password",
-		Net:    "tcp",
-		Addr:   dbHost,
-		DBName: "recipe_go_db",
+	var db *driver.DB
+	var err error
+	switch app.DBDriver {
+	case driver.MySQL:
+		fmt.Println("DB HOST:", app.DBHost)
+		dbCfg := mysql.Config{
+			User:   app.DBUser,
+			Passwd: app.DBPassword,
+			Net:    "tcp",
+			Addr:   app.DBHost,
+			DBName: app.DBName,
+		}
+		db, err = driver.ConnectSQL(dbCfg.FormatDSN())
+	case driver.SQLite:
+		fmt.Println("DB PATH:", app.DBPath)
+		db, err = driver.ConnectSQLite(app.DBPath)
+		if err == nil {
+			err = dbrepo.MigrateSqlite(db.SQL)
+		}
+	default:
+		err = fmt.Errorf("unknown DB_DRIVER %q, expected %q or %q", app.DBDriver, driver.MySQL, driver.SQLite)
 	}
-	db, err := driver.ConnectSQL(dbCfg.FormatDSN())
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// Connect to image storage
+	switch app.ImagesDriver {
+	case images.DriverLocal:
+		fmt.Println("IMAGES DIR:", app.ImagesDir)
+		app.Images, err = images.NewLocal(app.ImagesDir)
+	case images.DriverS3:
+		fmt.Println("IMAGES BUCKET:", app.S3Endpoint, app.S3Bucket)
+		app.Images = images.NewS3(app.S3Endpoint, app.S3Bucket, app.S3Region, app.S3AccessKey, app.S3SecretKey)
+	default:
+		err = fmt.Errorf("unknown IMAGES_DRIVER %q, expected %q or %q", app.ImagesDriver, images.DriverLocal, images.DriverS3)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	moved, err := dbrepo.MoveImageBlobs(db.SQL, app.Images)
+	if err != nil {
+		log.Fatal("Error moving images to the image storage: ", err)
+	}
+	if moved > 0 {
+		fmt.Println("Moved", moved, "images to the image storage")
+	}
+	parsed, err := dbrepo.ParseQuantities(db.SQL)
+	if err != nil {
+		log.Fatal("Error parsing ingredient amounts: ", err)
+	}
+	if parsed > 0 {
+		fmt.Println("Parsed the amounts of", parsed, "ingredients")
+	}
+
 	repo := handlers.NewRepo(&app, db)
+	go func() {
+		for range time.Tick(time.Hour) {
+			repo.RemoveUnusedUploads()
+		}
+	}()
 	renderer.NewRenderer(&app)
 	handlers.NewHandlers(repo)
 	helpers.NewHelpers(&app)
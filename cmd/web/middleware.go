@@ -1,8 +1,17 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/popnfresh234/recipe-app-golang/internal/handlers"
 	"github.com/popnfresh234/recipe-app-golang/internal/helpers"
+	"log"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 // SessionLoad loads and saves the session on every request
@@ -10,18 +19,166 @@ func SessionLoad(next http.Handler) http.Handler {
 	return session.LoadAndSave(next)
 }
 
-// Auth checks if the user is authenticated
+// CSRF rejects POST, PUT, PATCH and DELETE requests without the CSRF token of the session.
+// Forms send the token in a csrf_token field, page scripts in an X-CSRF-Token header.
+// Only URL-encoded forms are parsed for the field. Multipart bodies are left to their handlers,
+// which cap their size, so uploads and JSON send the header.
+// Requests authenticated with an API token don't need one, a browser never sends the token on its own.
+func CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := helpers.TokenUser(r); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := r.Header.Get("X-CSRF-Token")
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if token == "" && mediaType == "application/x-www-form-urlencoded" {
+			token = r.PostFormValue("csrf_token")
+		}
+		if !helpers.ValidCSRFToken(r, token) {
+			http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Auth checks if the user is authenticated.
+// Pages redirect to the login page, other requests get a 401.
 func Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !helpers.IsAuthenticated(r) {
-			session.Put(r.Context(), "error", "Log in first!")
-			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		if _, ok := handlers.Repo.CurrentUser(r); !ok {
+			deny(w, r, http.StatusUnauthorized, "Log in first!", "/user/login")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Bearer authenticates requests with an API token in an Authorization: Bearer header, so handlers see
+// the token's user as the current user without a session. Requests without the header are passed on as they are,
+// requests with an invalid token get a 401 and disabled users a 403.
+func Bearer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_request"`)
+			helpers.WriteJSONError(w, http.StatusUnauthorized, "Expected an Authorization: Bearer header", nil)
+			return
+		}
+
+		user, err := handlers.Repo.DB.GetUserByApiToken(helpers.HashApiToken(token))
+		if errors.Is(err, sql.ErrNoRows) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			helpers.WriteJSONError(w, http.StatusUnauthorized, "Invalid API token", nil)
+			return
+		}
+		if err != nil {
+			log.Println("Error checking API token", err)
+			helpers.WriteJSONError(w, http.StatusInternalServerError, "Error checking API token", nil)
+			return
+		}
+		if user.Disabled {
+			helpers.WriteJSONError(w, http.StatusForbidden, "Your account has been disabled", nil)
+			return
+		}
+		next.ServeHTTP(w, helpers.WithTokenUser(r, user))
+	})
+}
+
+// ApiAuth requires an API token, it goes after Bearer. Requests without a token get a 401.
+func ApiAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := helpers.TokenUser(r); !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			helpers.WriteJSONError(w, http.StatusUnauthorized, "Missing API token", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SessionOnly rejects requests authenticated with an API token, so a leaked token can't be used to create
+// more tokens or revoke the owner's other tokens
+func SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := helpers.TokenUser(r); ok {
+			http.Error(w, "Log in to do that, API tokens can't", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RecipeAuthor checks if the logged-in user may modify the recipe in the {id} URL parameter.
+// Pages redirect with an error, other requests get a 400, 404 or 403.
+func RecipeAuthor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recipeID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			deny(w, r, http.StatusBadRequest, "Error getting recipe details", "/")
+			return
+		}
+
+		recipe, err := handlers.Repo.DB.GetRecipeDetails(recipeID)
+		if err != nil {
+			deny(w, r, http.StatusNotFound, "Error getting recipe details", "/")
+			return
+		}
+
+		user, _ := handlers.Repo.CurrentUser(r)
+		if !helpers.CanModifyRecipe(user, recipe) {
+			deny(w, r, http.StatusForbidden, "You can only change your own recipes", fmt.Sprintf("/recipe/details/%d", recipeID))
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// RequireRole checks if the logged-in user has at least one of roles.
+// Roles are read from the database on every request, so a revoked role takes effect right away.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := handlers.Repo.CurrentUser(r)
+			if !ok {
+				deny(w, r, http.StatusUnauthorized, "Log in first!", "/user/login")
+				return
+			}
+			for _, role := range roles {
+				if user.HasRole(role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			deny(w, r, http.StatusForbidden, "You are not allowed to do that", "/")
+		})
+	}
+}
+
+// deny rejects a request. A GET for a page is redirected to redirectTo with msg as an error,
+// anything else, like the JSON posts from the page scripts, gets status and msg.
+func deny(w http.ResponseWriter, r *http.Request, status int, msg, redirectTo string) {
+	if r.Method == http.MethodGet {
+		session.Put(r.Context(), "error", msg)
+		http.Redirect(w, r, redirectTo, http.StatusSeeOther)
+		return
+	}
+	http.Error(w, msg, status)
+}
+
 // CorsMiddleware handles cors
 func CorsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/popnfresh234/recipe-app-golang/internal/openapi"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pageRoutes are the routes that serve HTML pages or take form posts, so the OpenAPI document leaves them out.
+// Every other route must be in the document. A method of * stands for every method.
+var pageRoutes = map[string]bool{
+	"GET /":                                  true,
+	"GET /search":                            true,
+	"GET /cook":                              true,
+	"GET /user/login":                        true,
+	"POST /user/login":                       true,
+	"GET /user/signup":                       true,
+	"POST /user/signup":                      true,
+	"GET /user/logout":                       true,
+	"GET /recipe/details/{id}":               true,
+	"GET /user/settings/":                    true,
+	"POST /user/settings/tokens":             true,
+	"POST /user/settings/tokens/revoke/{id}": true,
+	"GET /recipe/new":                        true,
+	"GET /recipe/edit/{id}":                  true,
+	"GET /admin/users":                       true,
+	"POST /admin/users/disable/{id}":         true,
+	"POST /admin/users/enable/{id}":          true,
+	"POST /admin/users/delete/{id}":          true,
+	"POST /admin/users/roles/{id}":           true,
+	"GET /admin/recipes":                     true,
+	"POST /admin/recipes/delete/{id}":        true,
+	"GET /admin/audit":                       true,
+	"GET /shopping/":                         true,
+	"POST /shopping/new":                     true,
+	"GET /shopping/list/{id}":                true,
+	"POST /shopping/check/{id}/{item}":       true,
+	"GET /shopping/export/{id}":              true,
+	"POST /shopping/delete/{id}":             true,
+	"GET /planner/":                          true,
+	"POST /planner/meals":                    true,
+	"POST /planner/meals/delete/{id}":        true,
+	"POST /planner/feed":                     true,
+	"GET /calendar/{token}.ics":              true,
+	"* /static/*":                            true,
+}
+
+// spec is the OpenAPI document the responses in the tests are checked against
+var spec = openapi.Spec()
+
+func TestOpenApiCoversRoutes(t *testing.T) {
+	newTestClient(t)
+
+	registered := make(map[string]bool)
+	err := chi.Walk(routes().(chi.Routes), func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		registered[method+" "+route] = true
+		if pageRoutes[method+" "+route] || pageRoutes["* "+route] {
+			return nil
+		}
+		if _, ok := spec.Operation(method, route); !ok {
+			t.Errorf("%s %s is not in the OpenAPI document, add it to openapi.Spec or, if it serves a page, to pageRoutes", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, item := range spec.Paths {
+		for method := range *item {
+			if !registered[strings.ToUpper(method)+" "+path] {
+				t.Errorf("%s %s is in the OpenAPI document but not a route", strings.ToUpper(method), path)
+			}
+		}
+	}
+	for route := range pageRoutes {
+		if !registered[route] && !strings.HasPrefix(route, "* ") {
+			t.Errorf("%s is in pageRoutes but not a route", route)
+		}
+	}
+}
+
+func TestOpenApiServed(t *testing.T) {
+	c := newTestClient(t)
+
+	res, body := c.api(http.MethodGet, "/api/openapi.json", "", "")
+	expectStatus(t, res, http.StatusOK)
+	if got := res.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected application/json, got %s", got)
+	}
+
+	var served, built interface{}
+	decodeBody(t, body, &served)
+	b, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodeBody(t, string(b), &built)
+	if !reflect.DeepEqual(served, built) {
+		t.Error("expected the served document to be openapi.Spec")
+	}
+}
+
+// checkResponse fails the test when a documented operation answers with a status the document doesn't list,
+// or with a body that doesn't match the schema of the status
+func checkResponse(t *testing.T, res *http.Response, body string) {
+	t.Helper()
+
+	path, ok := spec.MatchPath(res.Request.URL.Path)
+	if !ok {
+		return
+	}
+	op, ok := spec.Operation(res.Request.Method, path)
+	if !ok {
+		return
+	}
+	schema, ok := op.ResponseSchema(res.StatusCode)
+	if !ok {
+		t.Errorf("%s %s: status %d is not in the OpenAPI document", res.Request.Method, path, res.StatusCode)
+		return
+	}
+	// Endpoints of the pages answer some errors in plain text and others in JSON
+	contentType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if contentType != "application/json" {
+		if _, ok := op.Responses[strconv.Itoa(res.StatusCode)].Content[contentType]; schema != nil && body != "" && !ok {
+			t.Errorf("%s %s: status %d should be JSON, got %q", res.Request.Method, path, res.StatusCode, contentType)
+		}
+		return
+	}
+	if schema == nil {
+		t.Errorf("%s %s: status %d has a JSON body that is not in the OpenAPI document", res.Request.Method, path, res.StatusCode)
+		return
+	}
+
+	var value interface{}
+	err := json.Unmarshal([]byte(body), &value)
+	if err != nil {
+		t.Errorf("%s %s: expected a JSON body, got %q", res.Request.Method, path, body)
+		return
+	}
+	err = spec.Validate(schema, value)
+	if err != nil {
+		t.Errorf("%s %s: status %d does not match the OpenAPI document:\n%v", res.Request.Method, path, res.StatusCode, err)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var feedURL = regexp.MustCompile(`value="(http://[^"]+/calendar/[^"]+\.ics)"`)
+
+var deleteMealForm = regexp.MustCompile(`action="/planner/meals/delete/(\d+)"`)
+
+func TestPlanner(t *testing.T) {
+	c := newTestClient(t)
+	res, _ := c.get("/planner")
+	expectRedirect(t, res, "/user/login")
+
+	c.signup("Julia", "julia@example.com", "password")
+	soup := c.createRecipe(`{"title": "Soup, with bread", "ingredients": [{"name": "leeks", "amount": "2"}],
+		"directions": [{"direction": "Simmer"}]}`)
+
+	res, body := c.get("/planner")
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(body, "Week of") || !strings.Contains(body, "Soup, with bread") {
+		t.Error("expected this week and the recipes to plan")
+	}
+	stew := c.createRecipe(`{"title": "Stew", "ingredients": [{"name": "beans", "amount": "1", "unit": "cup"}],
+		"directions": [{"direction": "Simmer"}]}`)
+	_, body = c.get("/planner?q=stew")
+	if !strings.Contains(body, `value="`+stew+`"`) || strings.Contains(body, `value="`+soup+`"`) {
+		t.Error("expected only the recipes found to be offered")
+	}
+	res, body = c.postForm("/planner/meals", url.Values{"recipe": {stew}, "date": {"13/04/2024"}, "slot": {"lunch"}})
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(body, `value="`+stew+`" selected`) {
+		t.Error("expected the recipe to stay picked")
+	}
+
+	res, body = c.postForm("/planner/meals", url.Values{"recipe": {soup}, "date": {"13/04/2024"}, "slot": {"brunch"}})
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(body, "Use a date like") || !strings.Contains(body, "Pick breakfast, lunch or dinner") {
+		t.Error("expected the date and slot to be checked")
+	}
+	res, body = c.postForm("/planner/meals", url.Values{"recipe": {"999"}, "date": {"2024-04-13"}, "slot": {"lunch"}})
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(body, "Pick a recipe from the list") {
+		t.Error("expected the recipe to be checked")
+	}
+
+	today := time.Now().Format("2006-01-02")
+	res, _ = c.postForm("/planner/meals", url.Values{"recipe": {soup}, "date": {today}, "slot": {"dinner"}, "view": {"month"}})
+	expectRedirect(t, res, "/planner?view=month&date="+today)
+	res, _ = c.postForm("/planner/meals", url.Values{"recipe": {soup}, "date": {"2024-04-13"}, "slot": {"lunch"}})
+	expectRedirect(t, res, "/planner?view=week&date=2024-04-13")
+
+	_, body = c.get("/planner?view=week&date=2024-04-10")
+	if !strings.Contains(body, "Week of 8 April 2024") || !strings.Contains(body, "Lunch") {
+		t.Error("expected the week of 8 April with the lunch")
+	}
+	_, body = c.get("/planner?view=month&date=2024-04-10")
+	if !strings.Contains(body, "April 2024") || !strings.Contains(body, "/recipe/details/"+soup) {
+		t.Error("expected April with the lunch")
+	}
+	_, body = c.get("/planner?view=month&date=2024-06-10")
+	if strings.Contains(body, "/recipe/details/"+soup) {
+		t.Error("expected nothing planned in June")
+	}
+
+	// The feed needs a URL made from the planner first, it works without a session
+	res, body = c.postForm("/planner/feed", nil)
+	expectStatus(t, res, http.StatusOK)
+	matches := feedURL.FindStringSubmatch(body)
+	if matches == nil {
+		t.Fatal("expected the new feed URL")
+	}
+	feed, err := url.Parse(html.UnescapeString(matches[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	calendar := newTestClientFor(t, c)
+	res, body = calendar.get(feed.Path)
+	expectStatus(t, res, http.StatusOK)
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/calendar") ||
+		!strings.Contains(body, "SUMMARY:Dinner: Soup\\, with bread\r\n") ||
+		!strings.Contains(body, "DTSTART:"+strings.ReplaceAll(today, "-", "")+"T180000\r\n") {
+		t.Errorf("unexpected feed %q", body)
+	}
+	if strings.Contains(body, "Lunch") {
+		t.Error("expected meals long past to be left out of the feed")
+	}
+	res, _ = calendar.get("/calendar/not-a-token.ics")
+	expectStatus(t, res, http.StatusNotFound)
+
+	// A new URL replaces the old one
+	_, body = c.postForm("/planner/feed", nil)
+	if next := feedURL.FindStringSubmatch(body); next == nil || next[1] == matches[1] {
+		t.Fatal("expected a different feed URL")
+	}
+	res, _ = calendar.get(feed.Path)
+	expectStatus(t, res, http.StatusNotFound)
+
+	// Meals are private
+	other := newTestClientFor(t, c)
+	other.signup("Jules", "jules@example.com", "password")
+	_, body = other.get("/planner?view=month&date=2024-04-10")
+	if strings.Contains(body, "/recipe/details/"+soup) {
+		t.Error("expected Julia's meals not to be shown to Jules")
+	}
+
+	_, body = c.get("/planner?date=2024-04-13")
+	meal := deleteMealForm.FindStringSubmatch(body)
+	if meal == nil {
+		t.Fatal("expected a form to remove the lunch")
+	}
+	res, _ = other.postForm("/planner/meals/delete/"+meal[1], url.Values{"view": {"week"}, "date": {"2024-04-13"}})
+	expectRedirect(t, res, "/planner?view=week&date=2024-04-13")
+	_, body = c.get("/planner?date=2024-04-13")
+	if !deleteMealForm.MatchString(body) {
+		t.Error("expected Jules not to remove Julia's lunch")
+	}
+	res, _ = c.postForm("/planner/meals/delete/"+meal[1], url.Values{"view": {"week"}, "date": {"2024-04-13"}})
+	expectRedirect(t, res, "/planner?view=week&date=2024-04-13")
+	_, body = c.get("/planner?date=2024-04-13")
+	if deleteMealForm.MatchString(body) {
+		t.Error("expected the lunch to be removed")
+	}
+}
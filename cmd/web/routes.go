@@ -3,33 +3,119 @@ package main
 import (
 	"github.com/go-chi/chi/v5"
 	"github.com/popnfresh234/recipe-app-golang/internal/handlers"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
 	"net/http"
 )
 
 func routes() http.Handler {
 	mux := chi.NewRouter()
-	mux.Use(SessionLoad)
 	mux.Use(CorsMiddleware)
-	mux.Get("/", handlers.Repo.Home)
-
-	mux.Get("/user/login", handlers.Repo.Login)
-	mux.Post("/user/login", handlers.Repo.PostLogin)
-
-	mux.Get("/user/signup", handlers.Repo.Signup)
-	mux.Post("/user/signup", handlers.Repo.PostSignup)
-	mux.Get("/user/logout", handlers.Repo.Logout)
-	mux.Get("/recipe/details/{id}", handlers.Repo.RecipeDetails)
-
-	mux.Route("/recipe", func(mux chi.Router) {
-		//mux.Use(Auth)
-		mux.Get("/new", handlers.Repo.NewRecipe)
-		mux.Post("/new", handlers.Repo.PostNewRecipe)
-		mux.Get("/edit/{id}", handlers.Repo.EditRecipe)
-		mux.Post("/edit/{id}", handlers.Repo.PostEditRecipe)
-		mux.Post("/delete/{id}", handlers.Repo.PostDeleteRecipe)
+
+	mux.Get("/api/openapi.json", handlers.ApiSpec)
+
+	// Images don't need the session, their responses are cached by browsers and proxies
+	mux.Get("/images/{key}", handlers.Repo.Image)
+
+	// Calendar apps can't log in, the token in the feed's URL authenticates them
+	mux.Get("/calendar/{token}.ics", handlers.Repo.CalendarFeed)
+
+	// The API authenticates with tokens instead of the session, so it needs neither the session nor CSRF tokens
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.Use(Bearer)
+		mux.NotFound(handlers.ApiNotFound)
+		mux.MethodNotAllowed(handlers.ApiMethodNotAllowed)
+		mux.Post("/tokens", handlers.Repo.ApiPostToken)
+		mux.Get("/recipes", handlers.Repo.ApiListRecipes)
+		mux.Get("/recipes/{id}", handlers.Repo.ApiRecipe)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(ApiAuth)
+			mux.Get("/user", handlers.Repo.ApiUser)
+			mux.Post("/images", handlers.Repo.PostImage)
+			mux.Post("/recipes", handlers.Repo.ApiPostRecipe)
+			mux.Put("/recipes/{id}", handlers.Repo.ApiPutRecipe)
+			mux.Put("/recipes/{id}/order", handlers.Repo.ApiPutRecipeOrder)
+			mux.Delete("/recipes/{id}", handlers.Repo.ApiDeleteRecipe)
+		})
 	})
 
-	fileServer := http.FileServer(http.Dir("./web/static/"))
-	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
+	// Pages work with an API token too, so scripts can use the same handlers without a session
+	mux.Group(func(mux chi.Router) {
+		mux.Use(SessionLoad)
+		mux.Use(Bearer)
+		mux.Use(CSRF)
+		mux.Get("/", handlers.Repo.Home)
+		mux.Get("/search", handlers.Repo.Search)
+		mux.Get("/cook", handlers.Repo.Cook)
+
+		mux.Get("/user/login", handlers.Repo.Login)
+		mux.Post("/user/login", handlers.Repo.PostLogin)
+
+		mux.Get("/user/signup", handlers.Repo.Signup)
+		mux.Post("/user/signup", handlers.Repo.PostSignup)
+		mux.Get("/user/logout", handlers.Repo.Logout)
+		mux.Get("/recipe/details/{id}", handlers.Repo.RecipeDetails)
+
+		mux.Route("/user/settings", func(mux chi.Router) {
+			mux.Use(SessionOnly)
+			mux.Use(Auth)
+			mux.Get("/", handlers.Repo.Settings)
+			mux.Post("/tokens", handlers.Repo.PostSettingsToken)
+			mux.Post("/tokens/revoke/{id}", handlers.Repo.PostSettingsRevokeToken)
+		})
+
+		mux.Route("/recipe", func(mux chi.Router) {
+			mux.Use(Auth)
+			mux.Get("/new", handlers.Repo.NewRecipe)
+			mux.Post("/new", handlers.Repo.PostNewRecipe)
+			mux.Post("/images", handlers.Repo.PostImage)
+
+			// Only the author may change a recipe
+			mux.Group(func(mux chi.Router) {
+				mux.Use(RecipeAuthor)
+				mux.Get("/edit/{id}", handlers.Repo.EditRecipe)
+				mux.Post("/edit/{id}", handlers.Repo.PostEditRecipe)
+				mux.Post("/delete/{id}", handlers.Repo.PostDeleteRecipe)
+			})
+		})
+
+		mux.Route("/shopping", func(mux chi.Router) {
+			mux.Use(Auth)
+			mux.Get("/", handlers.Repo.ShoppingLists)
+			mux.Post("/new", handlers.Repo.PostNewShoppingList)
+			mux.Get("/list/{id}", handlers.Repo.ShoppingList)
+			mux.Post("/check/{id}/{item}", handlers.Repo.PostCheckShoppingListItem)
+			mux.Get("/export/{id}", handlers.Repo.ExportShoppingList)
+			mux.Post("/delete/{id}", handlers.Repo.PostDeleteShoppingList)
+		})
+
+		mux.Route("/planner", func(mux chi.Router) {
+			mux.Use(Auth)
+			mux.Get("/", handlers.Repo.Planner)
+			mux.Post("/meals", handlers.Repo.PostPlannerMeal)
+			mux.Post("/meals/delete/{id}", handlers.Repo.PostPlannerDeleteMeal)
+
+			// Feed URLs give access without logging in, so scripts with an API token can't make them
+			mux.Group(func(mux chi.Router) {
+				mux.Use(SessionOnly)
+				mux.Post("/feed", handlers.Repo.PostPlannerFeed)
+			})
+		})
+
+		mux.Route("/admin", func(mux chi.Router) {
+			mux.Use(RequireRole(models.RoleAdmin))
+			mux.Get("/users", handlers.Repo.AdminUsers)
+			mux.Post("/users/disable/{id}", handlers.Repo.PostAdminDisableUser)
+			mux.Post("/users/enable/{id}", handlers.Repo.PostAdminEnableUser)
+			mux.Post("/users/delete/{id}", handlers.Repo.PostAdminDeleteUser)
+			mux.Post("/users/roles/{id}", handlers.Repo.PostAdminUserRoles)
+			mux.Get("/recipes", handlers.Repo.AdminRecipes)
+			mux.Post("/recipes/delete/{id}", handlers.Repo.PostAdminDeleteRecipe)
+			mux.Get("/audit", handlers.Repo.AdminAudit)
+		})
+
+		fileServer := http.FileServer(http.Dir("./web/static/"))
+		mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
+	})
 	return mux
 }
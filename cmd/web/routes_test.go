@@ -0,0 +1,617 @@
+package main
+
+import (
+	"fmt"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var recipeLink = regexp.MustCompile(`/recipe/details/(\d+)`)
+
+const soupJson = `{
+	"title": "Tomato Soup",
+	"ingredients": [{"name": "tomatoes", "amount": "4", "unit": "whole"}, {"name": "salt", "amount": "1/2", "unit": "tsp"}],
+	"directions": [{"direction": "Chop the tomatoes"}, {"direction": "Simmer for 20 minutes"}],
+	"image": ""
+}`
+
+// minimalRecipe is the JSON of the smallest valid recipe with title
+func minimalRecipe(title string) string {
+	return fmt.Sprintf(`{"title": %q, "ingredients": [{"name": "water"}], "directions": [{"direction": "Boil"}]}`, title)
+}
+
+var theTests = []struct {
+	name               string
+	url                string
+	expectedStatusCode int
+}{
+	{"home", "/", http.StatusOK},
+	{"login", "/user/login", http.StatusOK},
+	{"signup", "/user/signup", http.StatusOK},
+	{"logout", "/user/logout", http.StatusSeeOther},
+	{"static", "/static/main.css", http.StatusOK},
+	{"missing static", "/static/missing.css", http.StatusNotFound},
+	{"unknown route", "/nowhere", http.StatusNotFound},
+}
+
+func TestPublicPages(t *testing.T) {
+	c := newTestClient(t)
+	for _, e := range theTests {
+		t.Run(e.name, func(t *testing.T) {
+			res, _ := c.get(e.url)
+			expectStatus(t, res, e.expectedStatusCode)
+		})
+	}
+}
+
+func TestSignup(t *testing.T) {
+	c := newTestClient(t)
+
+	// Invalid form renders the page again with errors
+	res, body := c.postForm("/user/signup", url.Values{"name": {""}, "email": {"not-an-email"}, "password": {"123"}})
+	expectStatus(t, res, http.StatusOK)
+	for _, msg := range []string{"This field cannot be empty", "Invalid email address", "at least 6 characters"} {
+		if !strings.Contains(body, msg) {
+			t.Errorf("expected signup page to contain %q", msg)
+		}
+	}
+
+	// Valid form logs the new user in
+	c.signup("Julia", "julia@example.com", "password")
+	_, body = c.get("/")
+	if !strings.Contains(body, "Welcome Julia") {
+		t.Error("expected home page to welcome the new user")
+	}
+
+	// Email addresses are unique
+	other := newTestClientFor(t, c)
+	res, _ = other.postForm("/user/signup", url.Values{"name": {"Jules"}, "email": {"julia@example.com"}, "password": {"password"}})
+	expectRedirect(t, res, "/user/signup")
+}
+
+func TestLoginAndLogout(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	c.get("/user/logout")
+
+	_, body := c.get("/")
+	if strings.Contains(body, "Welcome Julia") {
+		t.Fatal("expected user to be logged out")
+	}
+
+	// Invalid form renders the page again with errors
+	res, body := c.postForm("/user/login", url.Values{"email": {"julia"}, "password": {""}})
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(body, "Invalid email address") || !strings.Contains(body, "This field cannot be empty") {
+		t.Error("expected login page to show form errors")
+	}
+
+	// Wrong password flashes an error on the home page
+	res, _ = c.postForm("/user/login", url.Values{"email": {"julia@example.com"}, "password": {"wrong-password"}})
+	expectRedirect(t, res, "/")
+	_, body = c.get("/")
+	if !strings.Contains(body, "Error signing in") || strings.Contains(body, "Welcome Julia") {
+		t.Error("expected failed login to show an error")
+	}
+
+	// Correct password logs in, and the login page then redirects home
+	res, _ = c.postForm("/user/login", url.Values{"email": {"julia@example.com"}, "password": {"password"}})
+	expectRedirect(t, res, "/")
+	_, body = c.get("/")
+	if !strings.Contains(body, "Welcome Julia") {
+		t.Error("expected user to be logged in")
+	}
+	res, _ = c.get("/user/login")
+	expectRedirect(t, res, "/")
+}
+
+func TestRecipeCRUD(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+
+	res, _ := c.get("/recipe/new")
+	expectStatus(t, res, http.StatusOK)
+
+	// Create
+	res, _ = c.postJSON("/recipe/new", soupJson)
+	expectRedirect(t, res, "/")
+
+	_, body := c.get("/")
+	if !strings.Contains(body, "Tomato Soup") || !strings.Contains(body, "Created by: Julia") {
+		t.Fatal("expected new recipe on the home page")
+	}
+	id := recipeLink.FindStringSubmatch(body)[1]
+
+	// Details
+	res, body = c.get("/recipe/details/" + id)
+	expectStatus(t, res, http.StatusOK)
+	for _, want := range []string{"Tomato Soup", "tomatoes", "Simmer for 20 minutes", "Edit Recipe"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected details page to contain %q", want)
+		}
+	}
+
+	// Edit
+	res, body = c.get("/recipe/edit/" + id)
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(body, `value="Tomato Soup"`) {
+		t.Error("expected edit page to be filled in")
+	}
+
+	edited := fmt.Sprintf(`{"id": %s, "title": "Roasted Tomato Soup",
+		"ingredients": [{"name": "tomatoes", "amount": "6", "unit": "whole"}],
+		"directions": [{"direction": "Roast the tomatoes"}], "image": ""}`, id)
+	res, _ = c.postJSON("/recipe/edit/"+id, edited)
+	expectRedirect(t, res, "/")
+
+	_, body = c.get("/recipe/details/" + id)
+	if !strings.Contains(body, "Roasted Tomato Soup") || !strings.Contains(body, "Roast the tomatoes") {
+		t.Error("expected details page to show the edited recipe")
+	}
+	if strings.Contains(body, "Simmer for 20 minutes") || strings.Contains(body, "salt") {
+		t.Error("expected old ingredients and directions to be replaced")
+	}
+
+	// Delete
+	res, _ = c.postJSON("/recipe/delete/"+id, "")
+	expectRedirect(t, res, "/")
+
+	_, body = c.get("/")
+	if strings.Contains(body, "Tomato Soup") {
+		t.Error("expected recipe to be deleted")
+	}
+	res, _ = c.get("/recipe/details/" + id)
+	expectStatus(t, res, http.StatusTemporaryRedirect)
+}
+
+func TestRecipeErrors(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	id := c.createRecipe(soupJson)
+
+	res, _ := c.postJSON("/recipe/new", "{not json")
+	expectStatus(t, res, http.StatusBadRequest)
+
+	res, _ = c.postJSON("/recipe/edit/"+id, `{"id": 999, "title": "Wrong ID"}`)
+	expectStatus(t, res, http.StatusBadRequest)
+
+	res, _ = c.postJSON("/recipe/edit/999", `{"id": 999, "title": "Missing"}`)
+	expectStatus(t, res, http.StatusNotFound)
+
+	res, _ = c.postJSON("/recipe/delete/abc", "")
+	expectStatus(t, res, http.StatusBadRequest)
+
+	res, _ = c.get("/recipe/details/abc")
+	expectStatus(t, res, http.StatusTemporaryRedirect)
+
+	res, _ = c.get("/recipe/edit/999")
+	expectRedirect(t, res, "/")
+}
+
+func TestRecipeAuthorization(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	id := c.createRecipe(soupJson)
+
+	// Anonymous users are sent to the login page or get a 401
+	anonymous := newTestClientFor(t, c)
+	res, _ := anonymous.get("/recipe/new")
+	expectRedirect(t, res, "/user/login")
+	res, _ = anonymous.get("/recipe/edit/" + id)
+	expectRedirect(t, res, "/user/login")
+	res, _ = anonymous.postJSON("/recipe/new", soupJson)
+	expectStatus(t, res, http.StatusUnauthorized)
+	res, _ = anonymous.postJSON("/recipe/edit/"+id, soupJson)
+	expectStatus(t, res, http.StatusUnauthorized)
+	res, _ = anonymous.postJSON("/recipe/delete/"+id, "")
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	// Other users are sent back to the recipe or get a 403
+	other := newTestClientFor(t, c)
+	other.signup("Jacques", "jacques@example.com", "password")
+	res, _ = other.get("/recipe/edit/" + id)
+	expectRedirect(t, res, "/recipe/details/"+id)
+	res, _ = other.postJSON("/recipe/edit/"+id, `{"title": "Stolen Soup"}`)
+	expectStatus(t, res, http.StatusForbidden)
+	res, _ = other.postJSON("/recipe/delete/"+id, "")
+	expectStatus(t, res, http.StatusForbidden)
+
+	res, body := c.get("/recipe/details/" + id)
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(body, "Tomato Soup") || strings.Contains(body, "Stolen Soup") {
+		t.Error("expected recipe to be unchanged")
+	}
+}
+
+func TestRecipeValidation(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	id := c.createRecipe(soupJson)
+
+	// The page scripts get the errors keyed by the path of the field, to show them inline
+	invalid := `{"title": "", "ingredients": [{"name": "tomatoes", "amount": "4"}, {"name": "cream", "amount": "1.5"},
+		{"name": "salt", "amount": "a pinch"}], "directions": [], "image": "R0lGODlh"}`
+	for _, path := range []string{"/recipe/new", "/recipe/edit/" + id} {
+		res, body := c.postJSON(path, invalid)
+		expectStatus(t, res, http.StatusBadRequest)
+		for _, field := range []string{"title", "ingredients[2].amount", "directions", "image"} {
+			expectFieldError(t, body, field)
+		}
+	}
+
+	_, body := c.get("/recipe/details/" + id)
+	if !strings.Contains(body, "Tomato Soup") {
+		t.Error("expected the invalid edit not to be saved")
+	}
+
+	// Bodies larger than any valid recipe are cut off
+	large := fmt.Sprintf(`{"title": "Soup", "image": %q}`, strings.Repeat("A", 5<<20))
+	res, _ := c.postJSON("/recipe/new", large)
+	expectStatus(t, res, http.StatusRequestEntityTooLarge)
+}
+
+func TestRecipeDetailsForOtherUsers(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	id := c.createRecipe(soupJson)
+
+	other := newTestClientFor(t, c)
+	other.signup("Jacques", "jacques@example.com", "password")
+	res, body := other.get("/recipe/details/" + id)
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(body, "Tomato Soup") {
+		t.Error("expected recipe to be visible to other users")
+	}
+	if strings.Contains(body, "Edit Recipe") {
+		t.Error("expected edit button to be hidden from other users")
+	}
+}
+
+func TestAdminCanModifyAnyRecipe(t *testing.T) {
+	// The first user to sign up is the admin
+	admin := newTestClient(t)
+	admin.signup("Ada", "ada@example.com", "password")
+
+	author := newTestClientFor(t, admin)
+	author.signup("Julia", "julia@example.com", "password")
+	id := author.createRecipe(soupJson)
+
+	_, body := admin.get("/recipe/details/" + id)
+	if !strings.Contains(body, "Edit Recipe") {
+		t.Error("expected edit button to be shown to the admin")
+	}
+	res, _ := admin.get("/recipe/edit/" + id)
+	expectStatus(t, res, http.StatusOK)
+	res, _ = admin.postJSON("/recipe/edit/"+id, minimalRecipe("Moderated Soup"))
+	expectRedirect(t, res, "/")
+
+	// Revoking the role applies to the existing session
+	adminUser, err := admin.db.GetUserByEmail("ada@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = admin.db.RevokeRole(adminUser.ID, models.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _ = admin.postJSON("/recipe/delete/"+id, "")
+	expectStatus(t, res, http.StatusForbidden)
+
+	err = admin.db.AssignRole(adminUser.ID, models.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _ = admin.postJSON("/recipe/delete/"+id, "")
+	expectRedirect(t, res, "/")
+
+	res, _ = author.get("/recipe/details/" + id)
+	expectStatus(t, res, http.StatusTemporaryRedirect)
+}
+
+func TestCSRF(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	other := newTestClientFor(t, c)
+
+	login := url.Values{"email": {"julia@example.com"}, "password": {"password"}}.Encode()
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		header      string
+	}{
+		{"form without token", "/user/login", "application/x-www-form-urlencoded", login, ""},
+		{"form with wrong token", "/user/login", "application/x-www-form-urlencoded", login + "&csrf_token=wrong", ""},
+		{"form with other session's token", "/user/login", "application/x-www-form-urlencoded", login + "&csrf_token=" + other.csrfToken(), ""},
+		{"json without token", "/recipe/new", "application/json", soupJson, ""},
+		{"json with wrong token", "/recipe/new", "application/json", soupJson, "wrong"},
+		{"json with other session's token", "/recipe/new", "application/json", soupJson, other.csrfToken()},
+		// Multipart bodies aren't parsed for the token, uploads send it in the header
+		{"multipart with token field", "/recipe/images", "multipart/form-data; boundary=x",
+			"--x\r\nContent-Disposition: form-data; name=\"csrf_token\"\r\n\r\n" + c.csrfToken() + "\r\n--x--\r\n", ""},
+	}
+	for _, e := range tests {
+		t.Run(e.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, c.server.URL+e.path, strings.NewReader(e.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", e.contentType)
+			if e.header != "" {
+				req.Header.Set("X-CSRF-Token", e.header)
+			}
+			res, _ := c.send(req)
+			expectStatus(t, res, http.StatusForbidden)
+		})
+	}
+
+	_, body := c.get("/")
+	if strings.Contains(body, "Tomato Soup") {
+		t.Error("expected forged recipe to be rejected")
+	}
+
+	// The token is accepted in a header for forms too
+	req, err := http.NewRequest(http.MethodPost, c.server.URL+"/user/login", strings.NewReader(login))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-CSRF-Token", c.csrfToken())
+	res, _ := c.send(req)
+	expectRedirect(t, res, "/")
+
+	// The token stays the same for the session
+	_, body = c.get("/recipe/new")
+	if !strings.Contains(body, c.csrfToken()) {
+		t.Error("expected every page to carry the session's token")
+	}
+}
+
+func TestHomePagination(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	for i := 1; i <= 14; i++ {
+		c.postJSON("/recipe/new", minimalRecipe(fmt.Sprintf("Soup %02d", i)))
+	}
+
+	// Newest first, 12 to a page
+	_, body := c.get("/")
+	if n := len(recipeLink.FindAllString(body, -1)); n != 12 {
+		t.Errorf("expected 12 recipes on the first page, got %d", n)
+	}
+	if !strings.Contains(body, "Soup 14") || strings.Contains(body, "Soup 02") {
+		t.Error("expected the newest recipes on the first page")
+	}
+	if !strings.Contains(body, "Page 1 of 2") || !strings.Contains(body, "/?page=2&amp;sort=newest") || strings.Contains(body, "Previous") {
+		t.Error("expected a link to the next page only")
+	}
+
+	_, body = c.get("/?page=2")
+	if n := len(recipeLink.FindAllString(body, -1)); n != 2 {
+		t.Errorf("expected 2 recipes on the second page, got %d", n)
+	}
+	if !strings.Contains(body, "Soup 01") || !strings.Contains(body, "/?page=1&amp;sort=newest") || strings.Contains(body, "Next") {
+		t.Error("expected the oldest recipes and a link to the previous page only")
+	}
+
+	// Sorting by title
+	_, body = c.get("/?sort=title")
+	if strings.Index(body, "Soup 01") > strings.Index(body, "Soup 02") || strings.Contains(body, "Soup 13") {
+		t.Error("expected recipes sorted by title")
+	}
+	if !strings.Contains(body, `value="title" selected`) {
+		t.Error("expected the sort to be selected")
+	}
+
+	// Bad parameters fall back to the first page, newest first
+	for _, query := range []string{"?page=abc", "?page=-1", "?sort=bogus"} {
+		res, body := c.get("/" + query)
+		expectStatus(t, res, http.StatusOK)
+		if !strings.Contains(body, "Soup 14") {
+			t.Errorf("%s: expected the first page", query)
+		}
+	}
+
+	// Pages past the end are empty
+	_, body = c.get("/?page=5")
+	if recipeLink.MatchString(body) {
+		t.Error("expected no recipes past the last page")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	c.postJSON("/recipe/new", `{"title": "Tomato Soup", "ingredients": [{"name": "tomatoes"}], "directions": [{"direction": "Simmer the tomatoes"}]}`)
+	c.postJSON("/recipe/new", `{"title": "Basil Pasta", "ingredients": [{"name": "basil"}, {"name": "tomato"}], "directions": [{"direction": "Boil the pasta"}]}`)
+	c.postJSON("/recipe/new", `{"title": "Bread", "ingredients": [{"name": "flour"}], "directions": [{"direction": "Serve with tomato soup"}]}`)
+
+	res, body := c.get("/search")
+	expectStatus(t, res, http.StatusOK)
+	if recipeLink.MatchString(body) {
+		t.Error("expected no results without a query")
+	}
+
+	// Title matches rank above ingredient matches, which rank above direction matches
+	_, body = c.get("/search?q=" + url.QueryEscape("Tomato!"))
+	if !strings.Contains(body, "3 recipes found") {
+		t.Error("expected 3 results")
+	}
+	soup, pasta, bread := strings.Index(body, "Tomato Soup</p>"), strings.Index(body, "Basil Pasta</p>"), strings.Index(body, "Bread</p>")
+	if soup == -1 || soup > pasta || pasta > bread {
+		t.Error("expected results ordered by where they matched")
+	}
+
+	_, body = c.get("/search?q=flour")
+	if !strings.Contains(body, "Bread</p>") || strings.Contains(body, "Tomato Soup</p>") {
+		t.Error("expected ingredient names to be searched")
+	}
+	_, body = c.get("/search?q=boil")
+	if !strings.Contains(body, "Basil Pasta</p>") {
+		t.Error("expected directions to be searched")
+	}
+
+	_, body = c.get("/search?q=" + url.QueryEscape(`"lasagna" OR *`))
+	if !strings.Contains(body, "No recipes match") {
+		t.Error("expected no results")
+	}
+}
+
+func TestSearchPagination(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	for i := 1; i <= 13; i++ {
+		c.postJSON("/recipe/new", minimalRecipe(fmt.Sprintf("Soup %02d", i)))
+	}
+
+	_, body := c.get("/search?q=soup")
+	if n := len(recipeLink.FindAllString(body, -1)); n != 12 {
+		t.Errorf("expected 12 results on the first page, got %d", n)
+	}
+	if !strings.Contains(body, "13 recipes found") || !strings.Contains(body, "/search?page=2&amp;q=soup") {
+		t.Error("expected a link to the second page")
+	}
+
+	_, body = c.get("/search?q=soup&page=2")
+	if n := len(recipeLink.FindAllString(body, -1)); n != 1 {
+		t.Errorf("expected 1 result on the second page, got %d", n)
+	}
+}
+
+func TestCook(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	c.postJSON("/recipe/new", `{"title": "Chicken and Rice", "ingredients": [{"name": "Chicken Thighs"}, {"name": "rice"}, {"name": "garlic cloves"}],
+		"directions": [{"direction": "Cook the rice"}]}`)
+	c.postJSON("/recipe/new", `{"title": "Beef Stew", "ingredients": [{"name": "beef"}, {"name": "carrots"}], "directions": [{"direction": "Stew"}]}`)
+
+	res, body := c.get("/cook")
+	expectStatus(t, res, http.StatusOK)
+	if recipeLink.MatchString(body) {
+		t.Error("expected no results without ingredients")
+	}
+
+	_, body = c.get("/cook?ingredients=" + url.QueryEscape("chicken, Rice"))
+	for _, want := range []string{"Chicken and Rice", "66%", "You have 2 of 3 ingredients", "Missing: garlic cloves"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected results to contain %q", want)
+		}
+	}
+	if strings.Contains(body, "Beef Stew") {
+		t.Error("expected recipes without any of the ingredients to be left out")
+	}
+
+	_, body = c.get("/cook?ingredients=tofu")
+	if !strings.Contains(body, "No recipes use those ingredients") {
+		t.Error("expected no results")
+	}
+
+	// Large pantries aren't matched
+	pantry := []string{"chicken"}
+	for i := range 30 {
+		pantry = append(pantry, "spice "+string(rune('a'+i/26))+string(rune('a'+i%26)))
+	}
+	_, body = c.get("/cook?ingredients=" + url.QueryEscape(strings.Join(pantry, ", ")))
+	if !strings.Contains(body, "Enter at most 30 ingredients") || strings.Contains(body, "You have") {
+		t.Error("expected too many ingredients to be rejected")
+	}
+}
+
+func TestRecipeServings(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	id := c.createRecipe(`{"title": "Tomato Soup", "servings": 4, "ingredients": [
+		{"name": "tomatoes", "amount": "3", "unit": "lb"}, {"name": "cream", "amount": "1 1/2", "unit": "cups"},
+		{"name": "basil", "amount": "1", "unit": "cup"}, {"name": "salt", "amount": "to taste"}],
+		"directions": [{"direction": "Simmer"}]}`)
+
+	amount := regexp.MustCompile(`id="amount-\d+">([^<]*)<`)
+	amounts := func(body string) []string {
+		var amounts []string
+		for _, matches := range amount.FindAllStringSubmatch(body, -1) {
+			amounts = append(amounts, matches[1])
+		}
+		return amounts
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"3", "1 1/2", "1", "to taste"}},
+		{"?servings=6", []string{"4½", "2¼", "1½", "to taste"}},
+		{"?servings=3", []string{"2¼", "1⅛", "¾", "to taste"}},
+		{"?servings=-1", []string{"3", "1 1/2", "1", "to taste"}},
+		{"?servings=many", []string{"3", "1 1/2", "1", "to taste"}},
+	}
+	for _, e := range tests {
+		res, body := c.get("/recipe/details/" + id + e.query)
+		expectStatus(t, res, http.StatusOK)
+		if got := amounts(body); !slices.Equal(got, e.want) {
+			t.Errorf("%s: expected %q, got %q", e.query, e.want, got)
+		}
+	}
+	_, body := c.get("/recipe/details/" + id + "?servings=6")
+	if !strings.Contains(body, "Scaled from 4 servings") || !strings.Contains(body, `name="servings" type="number"`) {
+		t.Error("expected the page to say the recipe was scaled")
+	}
+
+	// Recipes without servings can't be scaled
+	other := c.createRecipe(minimalRecipe("Water"))
+	_, body = c.get("/recipe/details/" + other + "?servings=6")
+	if strings.Contains(body, `name="servings"`) || strings.Contains(body, "Scaled from") {
+		t.Error("expected no servings on a recipe without them")
+	}
+
+	res, _ := c.postJSON("/recipe/new", `{"title": "Soup", "servings": -4, "ingredients": [{"name": "water"}],
+		"directions": [{"direction": "Boil"}]}`)
+	expectStatus(t, res, http.StatusBadRequest)
+}
+
+func TestRecipeUnits(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	id := c.createRecipe(`{"title": "Pancakes", "servings": 4, "ingredients": [
+		{"name": "all-purpose flour", "amount": "2", "unit": "cups"}, {"name": "milk", "amount": "1", "unit": "C"},
+		{"name": "butter", "amount": "100", "unit": "g"}, {"name": "eggs", "amount": "2", "unit": "whole"}],
+		"directions": [{"direction": "Whisk"}]}`)
+
+	ingredient := regexp.MustCompile(`id="amount-\d+">([^<]*)</p>\s*<p[^>]*>&nbsp;([^<]*)<`)
+	ingredients := func(body string) []string {
+		var ingredients []string
+		for _, matches := range ingredient.FindAllStringSubmatch(body, -1) {
+			ingredients = append(ingredients, matches[1]+" "+matches[2])
+		}
+		return ingredients
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"2 cups", "1 C", "100 g", "2 whole"}},
+		{"?units=metric", []string{"240 g", "235 ml", "100 g", "2 whole"}},
+		{"?units=imperial", []string{"2 cups", "1 C", "0.44 cup", "2 whole"}},
+		{"?units=metric&servings=2", []string{"120 g", "120 ml", "50 g", "1 whole"}},
+		{"?units=kelvin", []string{"2 cups", "1 C", "100 g", "2 whole"}},
+	}
+	for _, e := range tests {
+		res, body := c.get("/recipe/details/" + id + e.query)
+		expectStatus(t, res, http.StatusOK)
+		if got := ingredients(body); !slices.Equal(got, e.want) {
+			t.Errorf("%s: expected %q, got %q", e.query, e.want, got)
+		}
+	}
+
+	// The toggle and the servings form keep each other
+	_, body := c.get("/recipe/details/" + id + "?servings=2&units=metric")
+	if !strings.Contains(body, "servings=2&amp;units=imperial") || !strings.Contains(body, `name="units" value="metric"`) {
+		t.Error("expected the toggle to keep the servings and the form to keep the units")
+	}
+}
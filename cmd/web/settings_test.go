@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var newTokenInput = regexp.MustCompile(`value="(rcp_[^"]+)" readonly`)
+
+var revokeForm = regexp.MustCompile(`/user/settings/tokens/revoke/(\d+)`)
+
+// createToken creates a named API token on the settings page and returns it
+func (c *testClient) createToken(name string) string {
+	c.t.Helper()
+
+	res, body := c.postForm("/user/settings/tokens", url.Values{"name": {name}})
+	expectStatus(c.t, res, http.StatusOK)
+	if res.Header.Get("Cache-Control") != "no-store" {
+		c.t.Error("expected the page showing a new token not to be cached")
+	}
+	matches := newTokenInput.FindStringSubmatch(body)
+	if matches == nil {
+		c.t.Fatal("expected the new token on the settings page")
+	}
+	return matches[1]
+}
+
+func TestSettingsTokens(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+
+	_, body := c.get("/user/settings")
+	if !strings.Contains(body, "No tokens yet") {
+		t.Error("expected no tokens")
+	}
+	res, body := c.postForm("/user/settings/tokens", url.Values{"name": {" "}})
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(body, "This field cannot be empty") {
+		t.Error("expected a token name to be required")
+	}
+	_, body = c.postForm("/user/settings/tokens", url.Values{"name": {strings.Repeat("x", 101)}})
+	if !strings.Contains(body, "at most 100 characters") {
+		t.Error("expected long token names to be rejected")
+	}
+
+	token := c.createToken("Recipe import")
+	res, _ = c.api(http.MethodGet, "/api/v1/user", token, "")
+	expectStatus(t, res, http.StatusOK)
+
+	// The token is listed by name, but never shown again
+	_, body = c.get("/user/settings")
+	if !strings.Contains(body, "Recipe import") || !strings.Contains(body, "Last used") {
+		t.Error("expected the used token to be listed")
+	}
+	if strings.Contains(body, token) {
+		t.Error("expected the token to be shown only once")
+	}
+	matches := revokeForm.FindStringSubmatch(body)
+	if matches == nil {
+		t.Fatal("expected a revoke button")
+	}
+
+	// Users can only revoke their own tokens
+	other := newTestClientFor(t, c)
+	other.signup("Jules", "jules@example.com", "password")
+	res, _ = other.postForm("/user/settings/tokens/revoke/"+matches[1], nil)
+	expectRedirect(t, res, "/user/settings")
+	res, _ = c.api(http.MethodGet, "/api/v1/user", token, "")
+	expectStatus(t, res, http.StatusOK)
+
+	res, _ = c.postForm("/user/settings/tokens/revoke/"+matches[1], nil)
+	expectRedirect(t, res, "/user/settings")
+	res, _ = c.api(http.MethodGet, "/api/v1/user", token, "")
+	expectStatus(t, res, http.StatusUnauthorized)
+	_, body = c.get("/user/settings")
+	if !strings.Contains(body, "No tokens yet") {
+		t.Error("expected the token to be revoked")
+	}
+
+	anonymous := newTestClientFor(t, c)
+	res, _ = anonymous.get("/user/settings")
+	expectRedirect(t, res, "/user/login")
+}
+
+func TestBearerTokenOnPages(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("Julia", "julia@example.com", "password")
+	token := c.createToken("script")
+
+	// A script posts a recipe with the token, without a session cookie or CSRF token
+	script := newTestClientFor(t, c)
+	req, err := http.NewRequest(http.MethodPost, c.server.URL+"/recipe/new", strings.NewReader(soupJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, body := script.send(req)
+	expectRedirect(t, res, "/")
+	checkResponse(t, res, body)
+
+	_, body = c.get("/")
+	if !strings.Contains(body, "Tomato Soup") {
+		t.Fatal("expected the recipe posted with the token")
+	}
+
+	// Invalid tokens are rejected rather than treated as anonymous
+	req, err = http.NewRequest(http.MethodGet, c.server.URL+"/recipe/new", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer rcp_not-a-token")
+	res, _ = script.send(req)
+	expectStatus(t, res, http.StatusUnauthorized)
+
+	// Tokens can't be used to manage tokens
+	req, err = http.NewRequest(http.MethodPost, c.server.URL+"/user/settings/tokens", strings.NewReader("name=more"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, _ = script.send(req)
+	expectStatus(t, res, http.StatusForbidden)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/gob"
+	"github.com/alexedwards/scs/v2"
+	"github.com/popnfresh234/recipe-app-golang/internal/handlers"
+	"github.com/popnfresh234/recipe-app-golang/internal/helpers"
+	"github.com/popnfresh234/recipe-app-golang/internal/images"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"github.com/popnfresh234/recipe-app-golang/internal/renderer"
+	"github.com/popnfresh234/recipe-app-golang/repository"
+	"github.com/popnfresh234/recipe-app-golang/repository/dbrepo"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var csrfMeta = regexp.MustCompile(`<meta name="csrf-token" content="([^"]+)">`)
+
+func TestMain(m *testing.M) {
+	// Templates and static files are resolved relative to the repository root, like in the Dockerfile
+	err := os.Chdir("../..")
+	if err != nil {
+		panic(err)
+	}
+
+	gob.Register(models.User{})
+
+	session = scs.New()
+	session.Lifetime = 24 * time.Hour
+	session.Cookie.Persist = true
+	session.Cookie.SameSite = http.SameSiteLaxMode
+	session.Cookie.Secure = false
+
+	app.Session = session
+	app.InProduction = false
+	app.UseCache = false
+
+	imagesDir, err := os.MkdirTemp("", "images")
+	if err != nil {
+		panic(err)
+	}
+	app.Images, err = images.NewLocal(imagesDir)
+	if err != nil {
+		panic(err)
+	}
+
+	renderer.NewRenderer(&app)
+	helpers.NewHelpers(&app)
+
+	code := m.Run()
+	_ = os.RemoveAll(imagesDir)
+	os.Exit(code)
+}
+
+// testClient talks to a test server through a cookie jar so sessions work like in a browser
+type testClient struct {
+	t      *testing.T
+	server *httptest.Server
+	client *http.Client
+	db     repository.DatabaseRepo
+	csrf   string
+}
+
+// newTestClient starts the real routes on a fresh in-memory database
+func newTestClient(t *testing.T) *testClient {
+	t.Helper()
+
+	db := dbrepo.NewTestingRepo(&app)
+	handlers.NewHandlers(handlers.NewRepoWithDB(&app, db))
+
+	server := httptest.NewServer(routes())
+	t.Cleanup(server.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testClient{
+		t:      t,
+		server: server,
+		db:     db,
+		client: &http.Client{
+			Jar: jar,
+			// Return redirects to the test instead of following them
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// newTestClientFor creates a second browser, with its own cookies, for the server used by c
+func newTestClientFor(t *testing.T, c *testClient) *testClient {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := *c.client
+	client.Jar = jar
+	return &testClient{t: t, server: c.server, db: c.db, client: &client}
+}
+
+// do sends a request and returns the response along with its body
+func (c *testClient) do(method, path, contentType string, body io.Reader) (*http.Response, string) {
+	c.t.Helper()
+
+	req, err := http.NewRequest(method, c.server.URL+path, body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.send(req)
+}
+
+// send sends req and returns the response along with its body
+func (c *testClient) send(req *http.Request) (*http.Response, string) {
+	c.t.Helper()
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return res, string(b)
+}
+
+func (c *testClient) get(path string) (*http.Response, string) {
+	c.t.Helper()
+	return c.do(http.MethodGet, path, "", nil)
+}
+
+// postForm posts form with the CSRF token in a form field, like the forms on the pages
+func (c *testClient) postForm(path string, form url.Values) (*http.Response, string) {
+	c.t.Helper()
+
+	values := url.Values{"csrf_token": {c.csrfToken()}}
+	for key, value := range form {
+		values[key] = value
+	}
+	return c.do(http.MethodPost, path, "application/x-www-form-urlencoded", strings.NewReader(values.Encode()))
+}
+
+// postJSON posts body with the CSRF token in a header, like the page scripts
+func (c *testClient) postJSON(path, body string) (*http.Response, string) {
+	c.t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, c.server.URL+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-CSRF-Token", c.csrfToken())
+	res, body := c.send(req)
+	checkResponse(c.t, res, body)
+	return res, body
+}
+
+// csrfToken reads the CSRF token of the session from the home page the first time it is needed
+func (c *testClient) csrfToken() string {
+	c.t.Helper()
+
+	if c.csrf == "" {
+		_, body := c.get("/")
+		matches := csrfMeta.FindStringSubmatch(body)
+		if matches == nil {
+			c.t.Fatal("expected a CSRF token on the home page")
+		}
+		c.csrf = matches[1]
+	}
+	return c.csrf
+}
+
+// signup creates a user through the signup form, which also logs them in
+func (c *testClient) signup(name, email, password string) {
+	c.t.Helper()
+
+	res, _ := c.postForm("/user/signup", url.Values{
+		"name":     {name},
+		"email":    {email},
+		"password": {password},
+	})
+	expectRedirect(c.t, res, "/")
+}
+
+// createRecipe posts a new recipe and returns its ID, read back from the home page where the newest recipe is first
+func (c *testClient) createRecipe(recipeJson string) string {
+	c.t.Helper()
+
+	res, _ := c.postJSON("/recipe/new", recipeJson)
+	expectRedirect(c.t, res, "/")
+
+	_, body := c.get("/")
+	matches := recipeLink.FindAllStringSubmatch(body, -1)
+	if len(matches) == 0 {
+		c.t.Fatal("expected a recipe on the home page")
+	}
+	return matches[0][1]
+}
+
+// expectStatus fails the test when res does not have the wanted status code
+func expectStatus(t *testing.T, res *http.Response, want int) {
+	t.Helper()
+	if res.StatusCode != want {
+		t.Fatalf("%s %s: expected status %d, got %d", res.Request.Method, res.Request.URL.Path, want, res.StatusCode)
+	}
+}
+
+// expectRedirect fails the test when res is not a 303 redirect to location
+func expectRedirect(t *testing.T, res *http.Response, location string) {
+	t.Helper()
+	expectStatus(t, res, http.StatusSeeOther)
+	if got := res.Header.Get("Location"); got != location {
+		t.Fatalf("%s %s: expected redirect to %s, got %s", res.Request.Method, res.Request.URL.Path, location, got)
+	}
+}
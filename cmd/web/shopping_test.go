@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var shoppingListLink = regexp.MustCompile(`^/shopping/list/(\d+)$`)
+
+var checkForm = regexp.MustCompile(`action="/shopping/check/\d+/(\d+)">\s*<input[^>]*>\s*<input[^>]*?(checked )?onchange[^>]*>\s*<label[^>]*>([^<]*)<`)
+
+// shoppingItems reads the items of a shopping list page, with a ✓ in front of those that are checked
+func shoppingItems(body string) []string {
+	var items []string
+	for _, matches := range checkForm.FindAllStringSubmatch(body, -1) {
+		item := matches[3]
+		if matches[2] != "" {
+			item = "✓ " + item
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func TestShoppingLists(t *testing.T) {
+	c := newTestClient(t)
+	res, _ := c.get("/shopping")
+	expectRedirect(t, res, "/user/login")
+
+	c.signup("Julia", "julia@example.com", "password")
+	pancakes := c.createRecipe(`{"title": "Pancakes", "ingredients": [{"name": "flour", "amount": "1", "unit": "cup"},
+		{"name": "eggs", "amount": "2"}, {"name": "milk", "amount": "1", "unit": "cup"}],
+		"directions": [{"direction": "Whisk"}]}`)
+	crepes := c.createRecipe(`{"title": "Crepes", "ingredients": [{"name": "Flour", "amount": "2", "unit": "tbsp"},
+		{"name": "egg", "amount": "1"}, {"name": "salt", "amount": "to taste"}], "directions": [{"direction": "Fry"}]}`)
+
+	_, body := c.get("/shopping")
+	if !strings.Contains(body, "No shopping lists yet") || !strings.Contains(body, "Pancakes") || !strings.Contains(body, "Crepes") {
+		t.Error("expected no lists and the recipes to pick from")
+	}
+	if !strings.Contains(body, `href="/shopping?recipe=`+pancakes+`"`) || !strings.Contains(body, "No recipes picked yet") {
+		t.Error("expected a link to pick pancakes")
+	}
+
+	// Picked recipes are kept while searching for more
+	_, body = c.get("/shopping?q=crepes&recipe=" + pancakes)
+	if !strings.Contains(body, `name="recipe" value="`+pancakes+`" checked`) || !strings.Contains(body, "Crepes") ||
+		!strings.Contains(body, `href="/shopping?q=crepes&amp;recipe=`+pancakes+`&amp;recipe=`+crepes+`"`) {
+		t.Error("expected pancakes to be picked and crepes to be found")
+	}
+	if strings.Contains(body, `href="/shopping?q=crepes&amp;recipe=`+pancakes+`&amp;recipe=`+pancakes+`"`) {
+		t.Error("expected a picked recipe not to be picked again")
+	}
+
+	res, body = c.postForm("/shopping/new", url.Values{"name": {"Weekend"}})
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(body, "Pick at least one recipe") {
+		t.Error("expected a recipe to be required")
+	}
+	res, body = c.postForm("/shopping/new", url.Values{"name": {"Weekend"}, "recipe": {pancakes}, "multiplier-" + pancakes: {"0"}})
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(body, "Use a number above 0") || !strings.Contains(body, `value="`+pancakes+`" checked`) {
+		t.Error("expected the multiplier to be checked and the recipe to stay picked")
+	}
+
+	tooMany := url.Values{"name": {"Weekend"}}
+	for i := 1; i <= 21; i++ {
+		tooMany.Add("recipe", strconv.Itoa(i))
+	}
+	res, body = c.postForm("/shopping/new", tooMany)
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(body, "Pick at most 20 recipes") {
+		t.Error("expected the number of recipes to be capped")
+	}
+
+	res, body = c.postForm("/shopping/new", url.Values{"name": {"Weekend"}, "recipe": {pancakes}, "multiplier-" + pancakes: {"NaN"}})
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(body, "Use a number above 0") {
+		t.Error("expected a multiplier that isn't a number to be rejected")
+	}
+
+	res, _ = c.postForm("/shopping/new", url.Values{
+		"name":                   {"Weekend"},
+		"recipe":                 {pancakes, crepes},
+		"multiplier-" + pancakes: {"2"},
+		"multiplier-" + crepes:   {"1"},
+	})
+	expectStatus(t, res, http.StatusSeeOther)
+	location := res.Header.Get("Location")
+	matches := shoppingListLink.FindStringSubmatch(location)
+	if matches == nil {
+		t.Fatalf("expected a redirect to the new list, got %s", location)
+	}
+	listID := matches[1]
+
+	// Eggs and flour are added up, the sections are in store order
+	_, body = c.get(location)
+	want := []string{"5 eggs", "2 cup milk", "2⅛ cup flour", "to taste salt"}
+	if got := shoppingItems(body); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if strings.Index(body, "Dairy &amp; Eggs") > strings.Index(body, "Baking") {
+		t.Error("expected dairy before baking")
+	}
+
+	items := checkForm.FindAllStringSubmatch(body, -1)
+	res, _ = c.postForm("/shopping/check/"+listID+"/"+items[0][1], url.Values{"checked": {"true"}})
+	expectRedirect(t, res, location)
+	_, body = c.get(location)
+	if got := shoppingItems(body); len(got) != 4 || got[0] != "✓ 5 eggs" || got[1] != "2 cup milk" {
+		t.Errorf("expected the eggs to be checked, got %q", got)
+	}
+
+	res, body = c.get("/shopping/export/" + listID)
+	expectStatus(t, res, http.StatusOK)
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/plain") ||
+		body != "Weekend\n\nDairy & Eggs\n[x] 5 eggs\n[ ] 2 cup milk\n\nBaking\n[ ] 2⅛ cup flour\n\nSpices\n[ ] to taste salt\n" {
+		t.Errorf("unexpected text export %q", body)
+	}
+	res, body = c.get("/shopping/export/" + listID + "?format=markdown")
+	expectStatus(t, res, http.StatusOK)
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/markdown") || !strings.HasPrefix(body, "# Weekend\n\n## Dairy & Eggs\n\n- [x] 5 eggs\n") {
+		t.Errorf("unexpected Markdown export %q", body)
+	}
+	res, _ = c.get("/shopping/export/" + listID + "?format=pdf")
+	expectStatus(t, res, http.StatusBadRequest)
+
+	// Lists are private
+	other := newTestClientFor(t, c)
+	other.signup("Jules", "jules@example.com", "password")
+	res, _ = other.get(location)
+	expectRedirect(t, res, "/shopping")
+	res, _ = other.get("/shopping/export/" + listID)
+	expectRedirect(t, res, "/shopping")
+	res, _ = other.postForm("/shopping/check/"+listID+"/"+items[1][1], url.Values{"checked": {"true"}})
+	expectRedirect(t, res, location)
+	res, _ = other.postForm("/shopping/delete/"+listID, nil)
+	expectRedirect(t, res, "/shopping")
+	_, body = other.get("/shopping")
+	if strings.Contains(body, "Weekend") {
+		t.Error("expected Julia's list not to be listed for Jules")
+	}
+
+	_, body = c.get(location)
+	if got := shoppingItems(body); len(got) != 4 || got[1] != "2 cup milk" {
+		t.Errorf("expected Jules not to check Julia's items, got %q", got)
+	}
+	_, body = c.get("/shopping")
+	if !strings.Contains(body, "Weekend") {
+		t.Error("expected the list to be listed")
+	}
+	res, _ = c.postForm("/shopping/delete/"+listID, nil)
+	expectRedirect(t, res, "/shopping")
+	res, _ = c.get(location)
+	expectRedirect(t, res, "/shopping")
+}
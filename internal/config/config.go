@@ -2,8 +2,10 @@ package config
 
 import (
 	"github.com/alexedwards/scs/v2"
+	"github.com/popnfresh234/recipe-app-golang/internal/images"
 	"html/template"
 	"log"
+	"time"
 )
 
 type AppConfig struct {
@@ -11,6 +13,24 @@ type AppConfig struct {
 	TemplateCache map[string]*template.Template
 	InProduction  bool
 	Session       *scs.SessionManager
+	Images        images.Store
 	InfoLog       *log.Logger
 	ErrorLog      *log.Logger
+
+	// Settings read by Load
+	Port            string
+	SessionLifetime time.Duration
+	DBDriver        string
+	DBHost          string
+	DBUser          string
+	DBPassword      string
+	DBName          string
+	DBPath          string
+	ImagesDriver    string
+	ImagesDir       string
+	S3Endpoint      string
+	S3Bucket        string
+	S3Region        string
+	S3AccessKey     string
+	S3SecretKey     string
 }
@@ -0,0 +1,332 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// fileConfig is the layout of the YAML config file
+type fileConfig struct {
+	Port            string `yaml:"port"`
+	InProduction    string `yaml:"in_production"`
+	UseCache        string `yaml:"use_cache"`
+	SessionLifetime string `yaml:"session_lifetime"`
+	DB              struct {
+		Driver   string `yaml:"driver"`
+		Host     string `yaml:"host"`
+		User     string `yaml:"user"`
+		Password string `yaml:"password"`
+		Name     string `yaml:"name"`
+		Path     string `yaml:"path"`
+	} `yaml:"db"`
+	Images struct {
+		Driver      string `yaml:"driver"`
+		Dir         string `yaml:"dir"`
+		S3Endpoint  string `yaml:"s3_endpoint"`
+		S3Bucket    string `yaml:"s3_bucket"`
+		S3Region    string `yaml:"s3_region"`
+		S3AccessKey string `yaml:"s3_access_key"`
+		S3SecretKey string `yaml:"s3_secret_key"`
+	} `yaml:"images"`
+}
+
+// option is a single setting and the places it can be read from
+type option struct {
+	flag  string
+	env   string
+	key   string
+	usage string
+	def   string
+	bool  bool
+	file  func(f *fileConfig) string
+	set   func(app *AppConfig, value string) error
+
+	// required reports if the setting must be given, now that the other settings are known
+	required func(app *AppConfig) bool
+}
+
+// usesMySQL is true when the MySQL settings are required
+func usesMySQL(app *AppConfig) bool {
+	return app.DBDriver == "mysql"
+}
+
+// usesS3 is true when the S3 settings are required
+func usesS3(app *AppConfig) bool {
+	return app.ImagesDriver == "s3"
+}
+
+// options are every setting that is read at startup
+var options = []option{
+	{
+		flag: "port", env: "PORT", key: "port", def: "3400",
+		usage: "port to listen on",
+		file:  func(f *fileConfig) string { return f.Port },
+		set: func(app *AppConfig, value string) error {
+			_, err := strconv.ParseUint(value, 10, 16)
+			app.Port = value
+			return err
+		},
+	},
+	{
+		flag: "in-production", env: "IN_PRODUCTION", key: "in_production", def: "false", bool: true,
+		usage: "serve secure cookies",
+		file:  func(f *fileConfig) string { return f.InProduction },
+		set: func(app *AppConfig, value string) (err error) {
+			app.InProduction, err = strconv.ParseBool(value)
+			return err
+		},
+	},
+	{
+		flag: "use-cache", env: "USE_CACHE", key: "use_cache", def: "false", bool: true,
+		usage: "parse the templates once at startup",
+		file:  func(f *fileConfig) string { return f.UseCache },
+		set: func(app *AppConfig, value string) (err error) {
+			app.UseCache, err = strconv.ParseBool(value)
+			return err
+		},
+	},
+	{
+		flag: "session-lifetime", env: "SESSION_LIFETIME", key: "session_lifetime", def: "24h",
+		usage: "how long a login lasts, like 24h or 30m",
+		file:  func(f *fileConfig) string { return f.SessionLifetime },
+		set: func(app *AppConfig, value string) (err error) {
+			app.SessionLifetime, err = time.ParseDuration(value)
+			return err
+		},
+	},
+	{
+		flag: "db-driver", env: "DB_DRIVER", key: "db.driver", def: "mysql",
+		usage: "database driver, mysql or sqlite",
+		file:  func(f *fileConfig) string { return f.DB.Driver },
+		set: func(app *AppConfig, value string) error {
+			app.DBDriver = value
+			return nil
+		},
+	},
+	{
+		flag: "db-host", env: "DB_HOST", key: "db.host", def: "localhost:3306",
+		usage: "MySQL host and port",
+		file:  func(f *fileConfig) string { return f.DB.Host },
+		set: func(app *AppConfig, value string) error {
+			app.DBHost = value
+			return nil
+		},
+	},
+	{
+		flag: "db-user", env: "DB_USER", key: "db.user",
+		usage: "MySQL user, required for mysql",
+		file:  func(f *fileConfig) string { return f.DB.User },
+		set: func(app *AppConfig, value string) error {
+			app.DBUser = value
+			return nil
+		},
+		required: usesMySQL,
+	},
+	{
+		flag: "db-password", env: "DB_PASSWORD", key: "db.password",
+		usage: "MySQL password, required for mysql",
+		file:  func(f *fileConfig) string { return f.DB.Password },
+		set: func(app *AppConfig, value string) error {
+			app.DBPassword = value
+			return nil
+		},
+		required: usesMySQL,
+	},
+	{
+		flag: "db-name", env: "DB_NAME", key: "db.name", def: "recipe_go_db",
+		usage: "MySQL database name",
+		file:  func(f *fileConfig) string { return f.DB.Name },
+		set: func(app *AppConfig, value string) error {
+			app.DBName = value
+			return nil
+		},
+	},
+	{
+		flag: "db-path", env: "DB_PATH", key: "db.path", def: "./recipe_go_db.sqlite",
+		usage: "SQLite database file",
+		file:  func(f *fileConfig) string { return f.DB.Path },
+		set: func(app *AppConfig, value string) error {
+			app.DBPath = value
+			return nil
+		},
+	},
+	{
+		flag: "images-driver", env: "IMAGES_DRIVER", key: "images.driver", def: "local",
+		usage: "where recipe images are stored, local or s3",
+		file:  func(f *fileConfig) string { return f.Images.Driver },
+		set: func(app *AppConfig, value string) error {
+			app.ImagesDriver = value
+			return nil
+		},
+	},
+	{
+		flag: "images-dir", env: "IMAGES_DIR", key: "images.dir", def: "./images",
+		usage: "directory of the local image storage",
+		file:  func(f *fileConfig) string { return f.Images.Dir },
+		set: func(app *AppConfig, value string) error {
+			app.ImagesDir = value
+			return nil
+		},
+	},
+	{
+		flag: "s3-endpoint", env: "S3_ENDPOINT", key: "images.s3_endpoint",
+		usage: "URL of the S3-compatible service, like http://localhost:9000, required for s3",
+		file:  func(f *fileConfig) string { return f.Images.S3Endpoint },
+		set: func(app *AppConfig, value string) error {
+			app.S3Endpoint = value
+			if value == "" {
+				return nil
+			}
+			u, err := url.Parse(value)
+			if err == nil && (u.Scheme != "http" && u.Scheme != "https" || u.Host == "") {
+				err = errors.New("expected an http or https URL")
+			}
+			return err
+		},
+		required: usesS3,
+	},
+	{
+		flag: "s3-bucket", env: "S3_BUCKET", key: "images.s3_bucket",
+		usage: "bucket to store images in, required for s3",
+		file:  func(f *fileConfig) string { return f.Images.S3Bucket },
+		set: func(app *AppConfig, value string) error {
+			app.S3Bucket = value
+			return nil
+		},
+		required: usesS3,
+	},
+	{
+		flag: "s3-region", env: "S3_REGION", key: "images.s3_region", def: "us-east-1",
+		usage: "region of the bucket",
+		file:  func(f *fileConfig) string { return f.Images.S3Region },
+		set: func(app *AppConfig, value string) error {
+			app.S3Region = value
+			return nil
+		},
+	},
+	{
+		flag: "s3-access-key", env: "S3_ACCESS_KEY", key: "images.s3_access_key",
+		usage: "access key of the bucket, required for s3",
+		file:  func(f *fileConfig) string { return f.Images.S3AccessKey },
+		set: func(app *AppConfig, value string) error {
+			app.S3AccessKey = value
+			return nil
+		},
+		required: usesS3,
+	},
+	{
+		flag: "s3-secret-key", env: "S3_SECRET_KEY", key: "images.s3_secret_key",
+		usage: "secret key of the bucket, required for s3",
+		file:  func(f *fileConfig) string { return f.Images.S3SecretKey },
+		set: func(app *AppConfig, value string) error {
+			app.S3SecretKey = value
+			return nil
+		},
+		required: usesS3,
+	},
+}
+
+// flagValue records the raw value of a flag and whether it was given at all
+type flagValue struct {
+	value  string
+	set    bool
+	isBool bool
+}
+
+func (v *flagValue) String() string { return v.value }
+
+func (v *flagValue) Set(value string) error {
+	v.value = value
+	v.set = true
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool { return v.isBool }
+
+// Load reads the settings into app. Command-line flags win over environment variables,
+// which win over the config file, which wins over the defaults. The config file is
+// given with -config or CONFIG_FILE.
+func Load(app *AppConfig, args []string, getenv func(string) string) error {
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	configFile := flags.String("config", getenv("CONFIG_FILE"), "YAML config file, can also be set with CONFIG_FILE")
+	values := make([]*flagValue, len(options))
+	for i, o := range options {
+		values[i] = &flagValue{isBool: o.bool}
+		usage := fmt.Sprintf("%s (env %s, config file %s)", o.usage, o.env, o.key)
+		if o.def != "" {
+			usage = fmt.Sprintf("%s (env %s, config file %s, default %s)", o.usage, o.env, o.key, o.def)
+		}
+		flags.Var(values[i], o.flag, usage)
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	var file fileConfig
+	if *configFile != "" {
+		file, err = readConfigFile(*configFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	resolved := make([]string, len(options))
+	for i, o := range options {
+		value, source := o.def, "default"
+		if v := o.file(&file); v != "" {
+			value, source = v, "config file "+o.key
+		}
+		if v := getenv(o.env); v != "" {
+			value, source = v, "env "+o.env
+		}
+		if values[i].set {
+			value, source = values[i].value, "flag -"+o.flag
+		}
+
+		resolved[i] = value
+		err = o.set(app, value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q from %s: %w", value, source, err))
+		}
+	}
+
+	for i, o := range options {
+		if resolved[i] == "" && o.required != nil && o.required(app) {
+			errs = append(errs, fmt.Errorf("missing required setting %s: set env %s, flag -%s or %s in the config file", o.key, o.env, o.flag, o.key))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// readConfigFile reads a YAML config file, unknown keys are an error so typos don't go unnoticed
+func readConfigFile(path string) (fileConfig, error) {
+	var file fileConfig
+
+	f, err := os.Open(path)
+	if err != nil {
+		return file, fmt.Errorf("reading config file: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	err = decoder.Decode(&file)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return file, fmt.Errorf("reading config file %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// Addr is the address the server listens on
+func (app *AppConfig) Addr() string {
+	return ":" + app.Port
+}
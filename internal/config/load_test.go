@@ -0,0 +1,144 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env returns a getenv function backed by vars
+func env(vars map[string]string) func(string) string {
+	return func(key string) string {
+		return vars[key]
+	}
+}
+
+// writeConfigFile writes contents to a config file in a temporary directory
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	err := os.WriteFile(path, []byte(contents), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	var app AppConfig
+	err := Load(&app, nil, env(map[string]string{"DB_DRIVER": "sqlite"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if app.Addr() != ":3400" || app.SessionLifetime != 24*time.Hour || app.InProduction || app.UseCache {
+		t.Errorf("unexpected defaults %+v", app)
+	}
+	if app.DBDriver != "sqlite" || app.DBPath != "./recipe_go_db.sqlite" || app.DBName != "recipe_go_db" {
+		t.Errorf("unexpected database defaults %+v", app)
+	}
+	if app.ImagesDriver != "local" || app.ImagesDir != "./images" || app.S3Region != "us-east-1" {
+		t.Errorf("unexpected image storage defaults %+v", app)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+port: 8000
+session_lifetime: 1h
+in_production: true
+db:
+  host: file-host:3306
+  user: file-user
+  password: file-password
+  name: file-db
+`)
+
+	var app AppConfig
+	err := Load(&app, []string{"-config", path, "-port", "9000", "-use-cache"}, env(map[string]string{
+		"PORT":        "8500",
+		"DB_HOST":     "env-host:3306",
+		"DB_PASSWORD": "env-password",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"flag over env and file", app.Port, "9000"},
+		{"bool flag without a value", app.UseCache, true},
+		{"env over file", app.DBHost, "env-host:3306"},
+		{"env over file", app.DBPassword, "env-password"},
+		{"file over default", app.DBUser, "file-user"},
+		{"file over default", app.DBName, "file-db"},
+		{"file over default", app.SessionLifetime, time.Hour},
+		{"file over default", app.InProduction, true},
+		{"default", app.DBDriver, "mysql"},
+	}
+	for _, e := range tests {
+		if e.got != e.want {
+			t.Errorf("%s: expected %v, got %v", e.name, e.want, e.got)
+		}
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	path := writeConfigFile(t, "db:\n  driver: sqlite\n  path: /data/recipes.sqlite\n")
+
+	var app AppConfig
+	err := Load(&app, nil, env(map[string]string{"CONFIG_FILE": path}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.DBPath != "/data/recipes.sqlite" {
+		t.Errorf("expected config file from CONFIG_FILE to be read, got %+v", app)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		file string
+		want []string
+	}{
+		{"missing mysql credentials", nil, nil, "", []string{"missing required setting db.user", "DB_USER", "-db-user", "missing required setting db.password"}},
+		{"invalid port", []string{"-port", "http"}, map[string]string{"DB_DRIVER": "sqlite"}, "", []string{`invalid value "http" from flag -port`}},
+		{"invalid duration", nil, map[string]string{"DB_DRIVER": "sqlite", "SESSION_LIFETIME": "forever"}, "", []string{`invalid value "forever" from env SESSION_LIFETIME`}},
+		{"invalid bool", nil, map[string]string{"DB_DRIVER": "sqlite"}, "in_production: sometimes\n", []string{`invalid value "sometimes" from config file in_production`}},
+		{"missing s3 settings", nil, map[string]string{"DB_DRIVER": "sqlite", "IMAGES_DRIVER": "s3"}, "",
+			[]string{"missing required setting images.s3_endpoint", "missing required setting images.s3_bucket", "S3_ACCESS_KEY", "S3_SECRET_KEY"}},
+		{"invalid s3 endpoint", nil, map[string]string{"DB_DRIVER": "sqlite"}, "images:\n  s3_endpoint: localhost:9000\n",
+			[]string{`invalid value "localhost:9000" from config file images.s3_endpoint`}},
+		{"unknown key", nil, nil, "prot: 3400\n", []string{"field prot not found"}},
+		{"unknown flag", []string{"-prot", "3400"}, nil, "", []string{"flag provided but not defined: -prot"}},
+		{"missing config file", []string{"-config", "missing.yml"}, nil, "", []string{"reading config file"}},
+	}
+	for _, e := range tests {
+		t.Run(e.name, func(t *testing.T) {
+			args := e.args
+			if e.file != "" {
+				args = append([]string{"-config", writeConfigFile(t, e.file)}, args...)
+			}
+
+			var app AppConfig
+			err := Load(&app, args, env(e.env))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range e.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected %q in error %q", want, err)
+				}
+			}
+		})
+	}
+}
@@ -2,11 +2,20 @@ package driver
 
 import (
 	"database/sql"
+	"fmt"
+	_ "modernc.org/sqlite"
 	"time"
 )
 
+// Supported database drivers
+const (
+	MySQL  = "mysql"
+	SQLite = "sqlite"
+)
+
 type DB struct {
-	SQL *sql.DB
+	SQL    *sql.DB
+	Driver string
 }
 
 var dbConn = &DB{}
@@ -15,8 +24,8 @@ const maxOpenDbConn = 10
 const maxIdleDbConn = 5
 const maxDbLifetime = 5 * time.Minute
 
-func NewDatabase(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn)
+func NewDatabase(driverName, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -34,11 +43,30 @@ func testDB(d *sql.DB) error {
 }
 
 func ConnectSQL(dsn string) (*DB, error) {
-	d, err := NewDatabase(dsn)
+	d, err := NewDatabase(MySQL, dsn)
+	if err != nil {
+		return nil, err
+	}
+	dbConn.SQL = d
+	dbConn.Driver = MySQL
+	err = testDB(dbConn.SQL)
+	if err != nil {
+		return nil, err
+	}
+	return dbConn, nil
+}
+
+// ConnectSQLite opens the SQLite database file at path, creating it if it does not exist
+func ConnectSQLite(path string) (*DB, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite", path)
+	d, err := NewDatabase(SQLite, dsn)
 	if err != nil {
 		return nil, err
 	}
+	// SQLite only allows one writer, and every connection to :memory: is a separate database
+	d.SetMaxOpenConns(1)
 	dbConn.SQL = d
+	dbConn.Driver = SQLite
 	err = testDB(dbConn.SQL)
 	if err != nil {
 		return nil, err
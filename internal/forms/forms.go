@@ -54,6 +54,16 @@ func (f *Form) MinLength(field string, length int) bool {
 	return true
 }
 
+// MaxLength checks for max length of a field
+func (f *Form) MaxLength(field string, length int) bool {
+	input := f.Get(field)
+	if len([]rune(input)) > length {
+		f.Errors.Add(field, fmt.Sprintf("This field must be at most %d characters long", length))
+		return false
+	}
+	return true
+}
+
 // IsEmail Checks for valid Email address
 func (f *Form) IsEmail(field string) {
 	if !govalidator.IsEmail(f.Get(field)) {
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"github.com/popnfresh234/recipe-app-golang/internal/renderer"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// adminAuditLimit is how many admin actions the audit page shows
+const adminAuditLimit = 200
+
+// AdminUsers lists users, filtered by the q query parameter
+func (repo *Repository) AdminUsers(w http.ResponseWriter, r *http.Request) {
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+	users, err := repo.DB.ListUsers(search)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error getting users")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	admin, _ := repo.CurrentUser(r)
+	data := make(map[string]interface{})
+	data["users"] = users
+	data["search"] = search
+	data["admin"] = admin
+	data["roles"] = []string{models.RoleAdmin, models.RoleEditor}
+	_ = renderer.Template(w, r, "admin-users.page.tmpl", &models.TemplateData{Data: data})
+}
+
+// PostAdminDisableUser disables a user account, the user is logged out on their next request
+func (repo *Repository) PostAdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	repo.setUserDisabled(w, r, true)
+}
+
+// PostAdminEnableUser re-enables a disabled user account
+func (repo *Repository) PostAdminEnableUser(w http.ResponseWriter, r *http.Request) {
+	repo.setUserDisabled(w, r, false)
+}
+
+// setUserDisabled handles disabling and enabling users
+func (repo *Repository) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	admin, target, ok := repo.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	action := models.ActionEnableUser
+	if disabled {
+		action = models.ActionDisableUser
+	}
+
+	err := repo.DB.SetUserDisabled(target.ID, disabled)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error updating user")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	repo.recordAdminAction(r, admin, action, "user", target.ID, target.Email)
+	repo.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Updated %s", target.Email))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// PostAdminDeleteUser deletes a user along with their recipes
+func (repo *Repository) PostAdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	admin, target, ok := repo.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := repo.DB.DeleteUser(target.ID)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error deleting user")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	repo.recordAdminAction(r, admin, models.ActionDeleteUser, "user", target.ID, target.Email)
+	repo.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Deleted %s", target.Email))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// PostAdminUserRoles assigns or revokes the role in the form, depending on the form's action
+func (repo *Repository) PostAdminUserRoles(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	admin, target, ok := repo.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	role := r.Form.Get("role")
+	switch r.Form.Get("action") {
+	case "assign":
+		err = repo.DB.AssignRole(target.ID, role)
+		if err == nil {
+			repo.recordAdminAction(r, admin, models.ActionAssignRole, "user", target.ID, fmt.Sprintf("%s: %s", target.Email, role))
+		}
+	case "revoke":
+		err = repo.DB.RevokeRole(target.ID, role)
+		if err == nil {
+			repo.recordAdminAction(r, admin, models.ActionRevokeRole, "user", target.ID, fmt.Sprintf("%s: %s", target.Email, role))
+		}
+	default:
+		err = fmt.Errorf("unknown action %q", r.Form.Get("action"))
+	}
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error changing roles")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Updated roles for %s", target.Email))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// adminTargetUser looks up the user in the {id} URL parameter.
+// Admins can't disable, delete or change the roles of their own account, so they can't lock themselves out.
+func (repo *Repository) adminTargetUser(w http.ResponseWriter, r *http.Request) (models.User, models.User, bool) {
+	admin, _ := repo.CurrentUser(r)
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return admin, models.User{}, false
+	}
+
+	target, err := repo.DB.GetUserById(userID)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "User not found")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return admin, models.User{}, false
+	}
+
+	if target.ID == admin.ID {
+		repo.App.Session.Put(r.Context(), "error", "You can't change your own account")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return admin, models.User{}, false
+	}
+	return admin, target, true
+}
+
+// AdminRecipes lists the recipes a page at a time, the most recently updated first
+func (repo *Repository) AdminRecipes(w http.ResponseWriter, r *http.Request) {
+	page := pageNumber(r)
+	recipes, total, err := repo.DB.ListRecipes((page-1)*recipesPageSize, recipesPageSize, models.SortUpdated)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error getting recipes")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["recipes"] = recipes
+	addPageData(data, page, total, "/admin/recipes", nil)
+	_ = renderer.Template(w, r, "admin-recipes.page.tmpl", &models.TemplateData{Data: data})
+}
+
+// PostAdminDeleteRecipe deletes any recipe
+func (repo *Repository) PostAdminDeleteRecipe(w http.ResponseWriter, r *http.Request) {
+	recipeID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	recipe, err := repo.DB.GetRecipeDetails(recipeID)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Recipe not found")
+		http.Redirect(w, r, "/admin/recipes", http.StatusSeeOther)
+		return
+	}
+
+	err = repo.DB.DeleteRecipe(recipe.ID)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error deleting recipe")
+		http.Redirect(w, r, "/admin/recipes", http.StatusSeeOther)
+		return
+	}
+
+	admin, _ := repo.CurrentUser(r)
+	repo.recordAdminAction(r, admin, models.ActionDeleteRecipe, "recipe", recipe.ID, fmt.Sprintf("%s by %s", recipe.Title, recipe.User.Name))
+	repo.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Deleted %s", recipe.Title))
+	http.Redirect(w, r, "/admin/recipes", http.StatusSeeOther)
+}
+
+// AdminAudit shows who did what in the admin console
+func (repo *Repository) AdminAudit(w http.ResponseWriter, r *http.Request) {
+	actions, err := repo.DB.GetAdminActions(adminAuditLimit)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error getting admin actions")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["actions"] = actions
+	_ = renderer.Template(w, r, "admin-audit.page.tmpl", &models.TemplateData{Data: data})
+}
+
+// recordAdminAction writes an admin action to the audit log. The action has already happened,
+// so a failure is logged and shown as a warning rather than undoing it.
+func (repo *Repository) recordAdminAction(r *http.Request, admin models.User, action, targetType string, targetId int, details string) {
+	err := repo.DB.InsertAdminAction(models.AdminAction{
+		AdminID:    admin.ID,
+		AdminName:  admin.Name,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetId,
+		Details:    details,
+	})
+	if err != nil {
+		log.Println("Error recording admin action", err)
+		repo.App.Session.Put(r.Context(), "warning", "The action was not recorded in the audit log")
+	}
+}
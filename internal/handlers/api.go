@@ -0,0 +1,456 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/popnfresh234/recipe-app-golang/internal/helpers"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"github.com/popnfresh234/recipe-app-golang/internal/openapi"
+	"github.com/popnfresh234/recipe-app-golang/internal/units"
+	"github.com/popnfresh234/recipe-app-golang/internal/validators"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiDefaultTokenName names API tokens created without a name
+const apiDefaultTokenName = "API token"
+
+// ApiPostToken exchanges an email and password for a new API token
+func (repo *Repository) ApiPostToken(w http.ResponseWriter, r *http.Request) {
+	var tokenRequest models.JsonTokenRequest
+	if !decodeJSON(w, r, &tokenRequest) {
+		return
+	}
+
+	fields := make(map[string][]string)
+	if strings.TrimSpace(tokenRequest.Email) == "" {
+		fields["email"] = append(fields["email"], "This field cannot be empty")
+	}
+	if tokenRequest.Password == "" {
+		fields["password"] = append(fields["password"], "This field cannot be empty")
+	}
+	if len(fields) > 0 {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Invalid token request", fields)
+		return
+	}
+
+	user, err := repo.DB.GetUserByEmail(tokenRequest.Email, tokenRequest.Password)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusUnauthorized, "Incorrect email or password", nil)
+		return
+	}
+	if user.Disabled {
+		helpers.WriteJSONError(w, http.StatusForbidden, "Your account has been disabled", nil)
+		return
+	}
+
+	name := strings.TrimSpace(tokenRequest.Name)
+	if name == "" {
+		name = apiDefaultTokenName
+	}
+	token, err := helpers.NewApiToken()
+	if err != nil {
+		log.Println("Error creating API token", err)
+		helpers.WriteJSONError(w, http.StatusInternalServerError, "Error creating token", nil)
+		return
+	}
+	apiToken, err := repo.DB.InsertApiToken(user.ID, name, helpers.HashApiToken(token))
+	if err != nil {
+		log.Println("Error saving API token", err)
+		helpers.WriteJSONError(w, http.StatusInternalServerError, "Error creating token", nil)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusCreated, models.JsonToken{Token: token, Name: apiToken.Name, CreatedAt: apiToken.CreatedAt})
+}
+
+// ApiUser returns the user the API token belongs to
+func (repo *Repository) ApiUser(w http.ResponseWriter, r *http.Request) {
+	user, _ := repo.CurrentUser(r)
+
+	roles := make([]string, 0, len(user.Roles))
+	for role := range user.Roles {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	helpers.WriteJSON(w, http.StatusOK, models.JsonUser{
+		ID:        user.ID,
+		Name:      user.Name,
+		Email:     user.Email,
+		Roles:     roles,
+		CreatedAt: user.CreatedAt,
+	})
+}
+
+// ApiListRecipes returns a page of recipes, read from the page, limit and sort query parameters
+func (repo *Repository) ApiListRecipes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	fields := make(map[string][]string)
+
+	page, limit := 1, models.JsonRecipeListDefaultLimit
+	var err error
+	if query.Has("page") {
+		page, err = strconv.Atoi(query.Get("page"))
+		if err != nil || page < 1 {
+			fields["page"] = append(fields["page"], "Must be a whole number of at least 1")
+		}
+	}
+	if query.Has("limit") {
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit < 1 || limit > models.JsonRecipeListMaxLimit {
+			fields["limit"] = append(fields["limit"], fmt.Sprintf("Must be a whole number from 1 to %d", models.JsonRecipeListMaxLimit))
+		}
+	}
+	sortBy := models.SortNewest
+	if query.Has("sort") {
+		sortBy = query.Get("sort")
+		if !slices.Contains(models.RecipeSorts, sortBy) {
+			fields["sort"] = append(fields["sort"], "Must be one of "+strings.Join(models.RecipeSorts, ", "))
+		}
+	}
+	if len(fields) > 0 {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Invalid query parameters", fields)
+		return
+	}
+
+	recipes, total, err := repo.DB.ListRecipes((page-1)*limit, limit, sortBy)
+	if err != nil {
+		log.Println(err)
+		helpers.WriteJSONError(w, http.StatusInternalServerError, "Error getting recipes", nil)
+		return
+	}
+
+	list := models.JsonRecipeList{
+		Recipes: make([]models.JsonRecipeSummary, 0, len(recipes)),
+		Page:    page,
+		Limit:   limit,
+		Total:   total,
+	}
+	for _, recipe := range recipes {
+		list.Recipes = append(list.Recipes, models.JsonRecipeSummary{
+			ID:        recipe.ID,
+			Title:     recipe.Title,
+			Author:    models.JsonAuthor{ID: recipe.UserId, Name: recipe.User.Name},
+			CreatedAt: recipe.CreatedAt,
+			UpdatedAt: recipe.UpdatedAt,
+		})
+	}
+	helpers.WriteJSON(w, http.StatusOK, list)
+}
+
+// ApiRecipe returns the recipe in the {id} URL parameter, with its ingredients converted to the units query parameter
+func (repo *Repository) ApiRecipe(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var system units.System
+	if query.Has("units") {
+		var ok bool
+		system, ok = units.ParseSystem(query.Get("units"))
+		if !ok {
+			helpers.WriteJSONError(w, http.StatusBadRequest, "Invalid query parameters", map[string][]string{
+				"units": {"Must be metric or imperial"},
+			})
+			return
+		}
+	}
+
+	recipe, ok := repo.apiRecipe(w, r)
+	if !ok {
+		return
+	}
+	if system != "" {
+		recipe = units.ConvertRecipe(recipe, system)
+	}
+	helpers.WriteJSON(w, http.StatusOK, jsonRecipeDetails(recipe))
+}
+
+// ApiPostRecipe creates a recipe owned by the user the API token belongs to
+func (repo *Repository) ApiPostRecipe(w http.ResponseWriter, r *http.Request) {
+	var newRecipe models.JsonRecipe
+	if !decodeJSON(w, r, &newRecipe) {
+		return
+	}
+	newRecipe.ID = 0
+
+	if !validRecipe(w, newRecipe) {
+		return
+	}
+	err := repo.storeImage(r, &newRecipe)
+	if err != nil {
+		if invalidImage(w, err) {
+			return
+		}
+		log.Println(err)
+		helpers.WriteJSONError(w, http.StatusInternalServerError, "Error saving image", nil)
+		return
+	}
+
+	user, _ := repo.CurrentUser(r)
+	recipeID, err := repo.DB.SaveRecipe(newRecipe, user.ID)
+	if err != nil {
+		log.Println(err)
+		helpers.WriteJSONError(w, http.StatusInternalServerError, "Error saving recipe", nil)
+		return
+	}
+
+	recipe, err := repo.DB.GetRecipeDetails(int(recipeID))
+	if err != nil {
+		log.Println(err)
+		helpers.WriteJSONError(w, http.StatusInternalServerError, "Error getting recipe", nil)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/recipes/%d", recipe.ID))
+	helpers.WriteJSON(w, http.StatusCreated, jsonRecipeDetails(recipe))
+}
+
+// ApiPutRecipe replaces the recipe in the {id} URL parameter. Only its author or an admin may change it.
+func (repo *Repository) ApiPutRecipe(w http.ResponseWriter, r *http.Request) {
+	var update models.JsonRecipeUpdate
+	if !decodeJSON(w, r, &update) {
+		return
+	}
+
+	recipe, ok := repo.apiRecipe(w, r)
+	if !ok {
+		return
+	}
+	if update.ID != 0 && update.ID != recipe.ID {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Invalid recipe", map[string][]string{
+			"id": {"Does not match the recipe in the URL"},
+		})
+		return
+	}
+	if !repo.apiCanModify(w, r, recipe) {
+		return
+	}
+
+	// Timestamps are compared to the second, the precision MySQL stores
+	if update.UpdatedAt != nil && !update.UpdatedAt.Truncate(time.Second).Equal(recipe.UpdatedAt.Truncate(time.Second)) {
+		helpers.WriteJSONError(w, http.StatusConflict, "The recipe has been changed since it was read", nil)
+		return
+	}
+
+	if !validRecipe(w, update.JsonRecipe) {
+		return
+	}
+	err := repo.storeImage(r, &update.JsonRecipe)
+	if err != nil {
+		if invalidImage(w, err) {
+			return
+		}
+		log.Println(err)
+		helpers.WriteJSONError(w, http.StatusInternalServerError, "Error saving image", nil)
+		return
+	}
+
+	update.ID = recipe.ID
+	_, err = repo.DB.SaveRecipe(update.JsonRecipe, 0)
+	if err != nil {
+		log.Println(err)
+		helpers.WriteJSONError(w, http.StatusInternalServerError, "Error saving recipe", nil)
+		return
+	}
+
+	recipe, err = repo.DB.GetRecipeDetails(recipe.ID)
+	if err != nil {
+		log.Println(err)
+		helpers.WriteJSONError(w, http.StatusInternalServerError, "Error getting recipe", nil)
+		return
+	}
+	helpers.WriteJSON(w, http.StatusOK, jsonRecipeDetails(recipe))
+}
+
+// ApiPutRecipeOrder moves the ingredients and directions of the recipe in the {id} URL parameter
+// without replacing the recipe. Only its author or an admin may change it.
+func (repo *Repository) ApiPutRecipeOrder(w http.ResponseWriter, r *http.Request) {
+	var order models.JsonRecipeOrder
+	if !decodeJSON(w, r, &order) {
+		return
+	}
+
+	recipe, ok := repo.apiRecipe(w, r)
+	if !ok {
+		return
+	}
+	if !repo.apiCanModify(w, r, recipe) {
+		return
+	}
+
+	validator := validators.NewRecipeOrder(order, recipe)
+	validator.Validate()
+	if !validator.Valid() {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Invalid order", validator.Errors)
+		return
+	}
+
+	err := repo.DB.ReorderRecipe(recipe.ID, order)
+	if err != nil {
+		log.Println(err)
+		helpers.WriteJSONError(w, http.StatusInternalServerError, "Error saving recipe", nil)
+		return
+	}
+
+	recipe, err = repo.DB.GetRecipeDetails(recipe.ID)
+	if err != nil {
+		log.Println(err)
+		helpers.WriteJSONError(w, http.StatusInternalServerError, "Error getting recipe", nil)
+		return
+	}
+	helpers.WriteJSON(w, http.StatusOK, jsonRecipeDetails(recipe))
+}
+
+// ApiDeleteRecipe deletes the recipe in the {id} URL parameter. Only its author or an admin may delete it.
+func (repo *Repository) ApiDeleteRecipe(w http.ResponseWriter, r *http.Request) {
+	recipe, ok := repo.apiRecipe(w, r)
+	if !ok {
+		return
+	}
+	if !repo.apiCanModify(w, r, recipe) {
+		return
+	}
+
+	err := repo.DB.DeleteRecipe(recipe.ID)
+	if err != nil {
+		log.Println(err)
+		helpers.WriteJSONError(w, http.StatusInternalServerError, "Error deleting recipe", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiSpec is built on first use, it doesn't change while the server runs
+var apiSpec = sync.OnceValue(openapi.Spec)
+
+// ApiSpec serves the OpenAPI document of the API
+func ApiSpec(w http.ResponseWriter, r *http.Request) {
+	helpers.WriteJSON(w, http.StatusOK, apiSpec())
+}
+
+// ApiNotFound answers API requests for routes that don't exist
+func ApiNotFound(w http.ResponseWriter, r *http.Request) {
+	helpers.WriteJSONError(w, http.StatusNotFound, "Not found", nil)
+}
+
+// ApiMethodNotAllowed answers API requests with a method the route doesn't support
+func ApiMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	helpers.WriteJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+}
+
+// apiRecipe looks up the recipe in the {id} URL parameter, writing a 404 when there is no such recipe
+func (repo *Repository) apiRecipe(w http.ResponseWriter, r *http.Request) (models.Recipe, bool) {
+	recipeID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusNotFound, "Recipe not found", nil)
+		return models.Recipe{}, false
+	}
+
+	recipe, err := repo.DB.GetRecipeDetails(recipeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.WriteJSONError(w, http.StatusNotFound, "Recipe not found", nil)
+		return models.Recipe{}, false
+	}
+	if err != nil {
+		log.Println(err)
+		helpers.WriteJSONError(w, http.StatusInternalServerError, "Error getting recipe", nil)
+		return models.Recipe{}, false
+	}
+	return recipe, true
+}
+
+// apiCanModify checks if the user the API token belongs to may change recipe, writing a 403 when they may not
+func (repo *Repository) apiCanModify(w http.ResponseWriter, r *http.Request, recipe models.Recipe) bool {
+	user, _ := repo.CurrentUser(r)
+	if !helpers.CanModifyRecipe(user, recipe) {
+		helpers.WriteJSONError(w, http.StatusForbidden, "You can only change your own recipes", nil)
+		return false
+	}
+	return true
+}
+
+// maxJSONBodyBytes limits the size of JSON request bodies, enough for a recipe with the largest image
+const maxJSONBodyBytes = 4 << 20
+
+// decodeJSON decodes the request body into v, writing a 400 when it isn't valid JSON and a 413 when it is too large
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodyBytes)).Decode(v)
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		helpers.WriteJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("The request must be at most %d MB", maxJSONBodyBytes>>20), nil)
+		return false
+	}
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error(), nil)
+		return false
+	}
+	return true
+}
+
+// validRecipe checks the fields of a recipe, writing a 400 with the errors keyed by the path of the field when it isn't valid
+func validRecipe(w http.ResponseWriter, recipe models.JsonRecipe) bool {
+	validator := validators.NewRecipe(recipe)
+	validator.Validate()
+	if !validator.Valid() {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Invalid recipe", validator.Errors)
+		return false
+	}
+	return true
+}
+
+// jsonRecipeDetails converts a recipe to the shape the API returns
+func jsonRecipeDetails(recipe models.Recipe) models.JsonRecipeDetails {
+	details := models.JsonRecipeDetails{
+		JsonRecipe: models.JsonRecipe{
+			ID:          recipe.ID,
+			Title:       recipe.Title,
+			Servings:    recipe.Servings,
+			Ingredients: make([]models.JsonIngredient, 0, len(recipe.Ingredients)),
+			Directions:  make([]models.JsonDirection, 0, len(recipe.Directions)),
+			Image:       recipe.Image,
+			Photos:      jsonPhotos(recipe.Photos),
+		},
+		ImageURL:  imageURL(recipe.Image),
+		Author:    models.JsonAuthor{ID: recipe.User.ID, Name: recipe.User.Name},
+		CreatedAt: recipe.CreatedAt,
+		UpdatedAt: recipe.UpdatedAt,
+	}
+	for _, ingredient := range recipe.Ingredients {
+		jsonIngredient := models.JsonIngredient{
+			Id:       ingredient.ID,
+			Name:     ingredient.Name,
+			Amount:   ingredient.Amount,
+			Unit:     ingredient.Unit,
+			Position: ingredient.Position,
+		}
+		if quantity := ingredient.Quantity; !quantity.IsZero() {
+			jsonIngredient.Quantity = &models.JsonQuantity{Min: quantity.Min, Max: quantity.Max, ToTaste: quantity.ToTaste}
+		}
+		details.Ingredients = append(details.Ingredients, jsonIngredient)
+	}
+	for _, direction := range recipe.Directions {
+		details.Directions = append(details.Directions, models.JsonDirection{
+			Id:        direction.ID,
+			Direction: direction.Direction,
+			Position:  direction.Position,
+			Photos:    jsonPhotos(direction.Photos),
+		})
+	}
+	return details
+}
+
+// jsonPhotos converts photos to the shape the API returns them in, along with their URLs
+func jsonPhotos(photos []models.Photo) []models.JsonPhoto {
+	var jsonPhotos []models.JsonPhoto
+	for _, photo := range photos {
+		jsonPhotos = append(jsonPhotos, models.JsonPhoto{Image: photo.Image, Caption: photo.Caption, URL: imageURL(photo.Image)})
+	}
+	return jsonPhotos
+}
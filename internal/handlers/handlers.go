@@ -1,22 +1,40 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/go-chi/chi/v5"
 	"github.com/popnfresh234/recipe-app-golang/internal/config"
 	"github.com/popnfresh234/recipe-app-golang/internal/driver"
 	"github.com/popnfresh234/recipe-app-golang/internal/forms"
+	"github.com/popnfresh234/recipe-app-golang/internal/helpers"
 	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"github.com/popnfresh234/recipe-app-golang/internal/pantry"
 	"github.com/popnfresh234/recipe-app-golang/internal/renderer"
+	"github.com/popnfresh234/recipe-app-golang/internal/units"
+	"github.com/popnfresh234/recipe-app-golang/internal/validators"
 	"github.com/popnfresh234/recipe-app-golang/repository"
 	"github.com/popnfresh234/recipe-app-golang/repository/dbrepo"
 	"golang.org/x/crypto/bcrypt"
 	"log"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 )
 
+// recipesPageSize is how many recipes the home and search pages show at a time
+const recipesPageSize = 12
+
+// cookResultsLimit is how many recipes the what can I cook page shows
+const cookResultsLimit = 50
+
+// cookPantryLimit is how many ingredients the what can I cook page matches recipes against
+const cookPantryLimit = 30
+
 type Repository struct {
 	App *config.AppConfig
 	DB  repository.DatabaseRepo
@@ -24,11 +42,26 @@ type Repository struct {
 
 var Repo *Repository
 
-// NewRepo creates a new repository with an app config
+// NewRepo creates a new repository with an app config, backed by the driver of db
 func NewRepo(app *config.AppConfig, db *driver.DB) *Repository {
+	var dbRepo repository.DatabaseRepo
+	switch db.Driver {
+	case driver.SQLite:
+		dbRepo = dbrepo.NewSqliteRepo(db.SQL, app)
+	default:
+		dbRepo = dbrepo.NewMysqlRepo(db.SQL, app)
+	}
+	return &Repository{
+		App: app,
+		DB:  dbRepo,
+	}
+}
+
+// NewRepoWithDB creates a new repository backed by any DatabaseRepo, such as the in-memory testing repo
+func NewRepoWithDB(app *config.AppConfig, db repository.DatabaseRepo) *Repository {
 	return &Repository{
 		App: app,
-		DB:  dbrepo.NewMysqlRepo(db.SQL, app),
+		DB:  db,
 	}
 }
 
@@ -37,17 +70,53 @@ func NewHandlers(r *Repository) {
 	Repo = r
 }
 
+// CurrentUser returns the logged-in user reloaded from the database, so role changes and
+// disabled accounts apply without logging in again. Disabled and deleted users are logged out.
+func (repo *Repository) CurrentUser(r *http.Request) (models.User, bool) {
+	// Users authenticated with an API token were just loaded from the database by the middleware
+	if user, ok := helpers.TokenUser(r); ok {
+		return user, true
+	}
+
+	sessionUser, ok := helpers.CurrentUser(r)
+	if !ok {
+		return models.User{}, false
+	}
+
+	user, err := repo.DB.GetUserById(sessionUser.ID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && user.Disabled) {
+		repo.App.Session.Remove(r.Context(), "user")
+		return models.User{}, false
+	}
+	if err != nil {
+		// Keep the user logged in, but without any roles
+		log.Println("Error getting user", err)
+		sessionUser.Roles = nil
+		return sessionUser, true
+	}
+	return user, true
+}
+
 // Home is the homepage handler
 func (repo *Repository) Home(w http.ResponseWriter, r *http.Request) {
+	sort := r.URL.Query().Get("sort")
+	if !slices.Contains(models.RecipeSorts, sort) {
+		sort = models.SortNewest
+	}
+	page := pageNumber(r)
 
-	recipes, err := repo.DB.GetAllRecipes()
+	recipes, total, err := repo.DB.ListRecipes((page-1)*recipesPageSize, recipesPageSize, sort)
 	if err != nil {
+		log.Println(err)
 		repo.App.Session.Put(r.Context(), "error", "Error getting recipes")
-		return
 	}
+
 	templateData := &models.TemplateData{}
 	data := make(map[string]interface{})
 	data["recipes"] = recipes
+	data["sort"] = sort
+	data["sorts"] = models.RecipeSorts
+	addPageData(data, page, total, "/", url.Values{"sort": {sort}})
 	if repo.App.Session.Exists(r.Context(), "user") {
 		user := repo.App.Session.Get(r.Context(), "user")
 		data["user"] = user
@@ -57,18 +126,121 @@ func (repo *Repository) Home(w http.ResponseWriter, r *http.Request) {
 	_ = renderer.Template(w, r, "home.page.tmpl", templateData)
 }
 
+// Search searches recipes for the q query parameter
+func (repo *Repository) Search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	page := pageNumber(r)
+
+	data := make(map[string]interface{})
+	data["query"] = query
+	if query != "" {
+		recipes, total, err := repo.DB.SearchRecipes(query, (page-1)*recipesPageSize, recipesPageSize)
+		if err != nil {
+			log.Println(err)
+			repo.App.Session.Put(r.Context(), "error", "Error searching recipes")
+		}
+		data["recipes"] = recipes
+		data["total"] = total
+		addPageData(data, page, total, "/search", url.Values{"q": {query}})
+	}
+
+	_ = renderer.Template(w, r, "search.page.tmpl", &models.TemplateData{Data: data})
+}
+
+// Cook finds recipes that can be made with the ingredients query parameter, a comma separated list
+func (repo *Repository) Cook(w http.ResponseWriter, r *http.Request) {
+	ingredients := r.URL.Query().Get("ingredients")
+	p := pantry.New(ingredients)
+
+	data := make(map[string]interface{})
+	data["ingredients"] = ingredients
+	if len(p.Items()) > cookPantryLimit {
+		repo.App.Session.Put(r.Context(), "error", fmt.Sprintf("Enter at most %d ingredients", cookPantryLimit))
+	} else if len(p.Items()) > 0 {
+		matches, err := repo.DB.MatchRecipes(p, cookResultsLimit)
+		if err != nil {
+			log.Println(err)
+			repo.App.Session.Put(r.Context(), "error", "Error finding recipes")
+		}
+		data["matches"] = matches
+		data["pantry"] = p.Items()
+	}
+
+	_ = renderer.Template(w, r, "cook.page.tmpl", &models.TemplateData{Data: data})
+}
+
+// pickRecipes gets a page of the recipes matching query for the recipe pickers, or of the newest recipes when
+// there is no query, along with how many there are
+func (repo *Repository) pickRecipes(query string, page int) ([]models.Recipe, int, error) {
+	if query == "" {
+		return repo.DB.ListRecipes((page-1)*recipesPageSize, recipesPageSize, models.SortNewest)
+	}
+	return repo.DB.SearchRecipes(query, (page-1)*recipesPageSize, recipesPageSize)
+}
+
+// pageNumber reads the page query parameter, pages start at 1
+func pageNumber(r *http.Request) int {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
+// addPageData adds what the pager component needs to data: the page, the number of pages,
+// and links to the previous and next pages, which go to path with query
+func addPageData(data map[string]interface{}, page, total int, path string, query url.Values) {
+	pages := (total + recipesPageSize - 1) / recipesPageSize
+	link := func(page int) string {
+		values := url.Values{"page": {strconv.Itoa(page)}}
+		for key, value := range query {
+			values[key] = value
+		}
+		return path + "?" + values.Encode()
+	}
+
+	data["page"] = page
+	data["pages"] = pages
+	if page > 1 {
+		data["prevPage"] = link(page - 1)
+	}
+	if page < pages {
+		data["nextPage"] = link(page + 1)
+	}
+}
+
 // RecipeDetails looks up a recipe by its ID
 func (repo *Repository) RecipeDetails(w http.ResponseWriter, r *http.Request) {
-	exploded := strings.Split(r.RequestURI, "/")
-	recipeID, err := strconv.Atoi(exploded[3])
+	recipeID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
 		fmt.Println(err)
 		repo.App.Session.Put(r.Context(), "error", "Error getting recipe details")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
 	}
 
 	recipe, err := repo.DB.GetRecipeDetails(recipeID)
+	if err != nil {
+		fmt.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error getting recipe details")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
 	data := make(map[string]interface{})
+	data["servings"] = recipe.Servings
+
+	// ?servings=N scales the ingredients, numbers that aren't servings show the recipe as it was written
+	servings, err := strconv.Atoi(r.URL.Query().Get("servings"))
+	if err == nil && servings > 0 && servings <= validators.MaxServings {
+		recipe = recipe.Scale(servings)
+	}
+
+	// ?units=metric or imperial converts the ingredients, after scaling them so their amounts are only rounded once
+	data["units"] = ""
+	if system, ok := units.ParseSystem(r.URL.Query().Get("units")); ok {
+		recipe = units.ConvertRecipe(recipe, system)
+		data["units"] = string(system)
+	}
 	data["recipe"] = recipe
 
 	recipeJson, err := json.Marshal(recipe)
@@ -76,6 +248,7 @@ func (repo *Repository) RecipeDetails(w http.ResponseWriter, r *http.Request) {
 		fmt.Println(err)
 		repo.App.Session.Put(r.Context(), "error", "Error parsing JSON")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
 	}
 	data["recipeJson"] = string(recipeJson)
 
@@ -84,26 +257,28 @@ func (repo *Repository) RecipeDetails(w http.ResponseWriter, r *http.Request) {
 		Data: data,
 	}
 
-	user := repo.App.Session.Get(r.Context(), "user")
-	if user != nil {
-		if user.(models.User).Email == recipe.User.Email {
-			td.IsAuthor = true
-		}
-	}
+	user, _ := repo.CurrentUser(r)
+	td.IsAuthor = helpers.CanModifyRecipe(user, recipe)
 	_ = renderer.Template(w, r, "recipe-details.page.tmpl", &td)
 }
 
 // EditRecipe is the handler for editing a recipe
 func (repo *Repository) EditRecipe(w http.ResponseWriter, r *http.Request) {
-	exploded := strings.Split(r.RequestURI, "/")
-	recipeID, err := strconv.Atoi(exploded[3])
+	recipeID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
 		fmt.Println(err)
 		repo.App.Session.Put(r.Context(), "error", "Error getting recipe details")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
 	}
 
 	recipe, err := repo.DB.GetRecipeDetails(recipeID)
+	if err != nil {
+		fmt.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error getting recipe details")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
 	data := make(map[string]interface{})
 	data["recipe"] = recipe
 
@@ -112,6 +287,7 @@ func (repo *Repository) EditRecipe(w http.ResponseWriter, r *http.Request) {
 		fmt.Println(err)
 		repo.App.Session.Put(r.Context(), "error", "Error parsing JSON")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
 	}
 	data["recipeJson"] = string(recipeJson)
 
@@ -120,12 +296,8 @@ func (repo *Repository) EditRecipe(w http.ResponseWriter, r *http.Request) {
 		Data: data,
 	}
 
-	user := repo.App.Session.Get(r.Context(), "user")
-	if user != nil {
-		if user.(models.User).Email == recipe.User.Email {
-			td.IsAuthor = true
-		}
-	}
+	user, _ := repo.CurrentUser(r)
+	td.IsAuthor = helpers.CanModifyRecipe(user, recipe)
 	_ = renderer.Template(w, r, "recipe-edit.page.tmpl", &td)
 
 }
@@ -134,35 +306,37 @@ func (repo *Repository) EditRecipe(w http.ResponseWriter, r *http.Request) {
 func (repo *Repository) PostEditRecipe(w http.ResponseWriter, r *http.Request) {
 
 	var updatedRecipe models.JsonRecipe
-	err := json.NewDecoder(r.Body).Decode(&updatedRecipe)
-	if err != nil {
-		fmt.Println(err)
-		// TODO handle Error
-		w.WriteHeader(http.StatusInternalServerError)
+	if !decodeJSON(w, r, &updatedRecipe) {
 		return
 	}
-	_, err = repo.DB.UpdateRecipe(updatedRecipe)
-	if err != nil {
-		fmt.Println(err)
+
+	// The recipe in the URL is the one the author was checked against
+	recipeID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || (updatedRecipe.ID != 0 && updatedRecipe.ID != recipeID) {
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	updatedRecipe.ID = recipeID
 
-	// Insert ingredients
-	for _, ingredient := range updatedRecipe.Ingredients {
-		err = repo.DB.InsertIngredient(ingredient.Name, ingredient.Amount, ingredient.Unit, int64(updatedRecipe.ID))
-		if err != nil {
-			//TODO Delete recipe?
-			fmt.Println(err)
+	if !validRecipe(w, updatedRecipe) {
+		return
+	}
+	err = repo.storeImage(r, &updatedRecipe)
+	if err != nil {
+		if invalidImage(w, err) {
+			return
 		}
+		log.Println(err)
+		http.Error(w, "Error saving image", http.StatusInternalServerError)
+		return
 	}
 
-	// Insert directions
-	for _, direction := range updatedRecipe.Directions {
-		err = repo.DB.InsertDirection(direction.Direction, int64(updatedRecipe.ID))
-		if err != nil {
-			//TODO Delete recipe?
-			fmt.Println(err)
-		}
+	_, err = repo.DB.SaveRecipe(updatedRecipe, 0)
+	if err != nil {
+		fmt.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error saving recipe")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -172,6 +346,7 @@ func (repo *Repository) PostEditRecipe(w http.ResponseWriter, r *http.Request) {
 func (repo *Repository) Login(w http.ResponseWriter, r *http.Request) {
 	if repo.App.Session.Exists(r.Context(), "user") {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
 	}
 	_ = renderer.Template(w, r, "login.page.tmpl", &models.TemplateData{Form: forms.New(nil)})
 }
@@ -205,6 +380,19 @@ func (repo *Repository) PostLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if user.Disabled {
+		repo.App.Session.Put(r.Context(), "error", "Your account has been disabled")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	user.Roles, err = repo.DB.GetUserRoles(user.ID)
+	if err != nil {
+		repo.App.Session.Put(r.Context(), "error", "Error signing in")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
 	repo.App.Session.Put(r.Context(), "user", user)
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -270,40 +458,33 @@ func (repo *Repository) NewRecipe(w http.ResponseWriter, r *http.Request) {
 // PostNewRecipe handles posting a new recipe to the server
 func (repo *Repository) PostNewRecipe(w http.ResponseWriter, r *http.Request) {
 	var newRecipe models.JsonRecipe
-	err := json.NewDecoder(r.Body).Decode(&newRecipe)
-	if err != nil {
-		fmt.Println(err)
-		// TODO handle Error
-		w.WriteHeader(http.StatusInternalServerError)
+	if !decodeJSON(w, r, &newRecipe) {
+		return
+	}
+	if !validRecipe(w, newRecipe) {
+		return
 	}
 
-	// TODO Validate Recipe
-	// TODO Validate Ingredients
-	// TODO Validate Directions
-	// TODO Create and Insert Recipe, get ID
-	user := repo.App.Session.Get(r.Context(), "user").(models.User)
-	fmt.Println(user.ID)
-	recipeId, err := repo.DB.InsertRecipe(newRecipe.Title, newRecipe.Image, user.ID)
-	if err != nil {
-		fmt.Println(err)
+	user, ok := helpers.CurrentUser(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
-	// Insert ingredients
-	for _, ingredient := range newRecipe.Ingredients {
-		err = repo.DB.InsertIngredient(ingredient.Name, ingredient.Amount, ingredient.Unit, recipeId)
-		if err != nil {
-			//TODO Delete recipe?
-			fmt.Println(err)
+	err := repo.storeImage(r, &newRecipe)
+	if err != nil {
+		if invalidImage(w, err) {
+			return
 		}
+		log.Println(err)
+		http.Error(w, "Error saving image", http.StatusInternalServerError)
+		return
 	}
-
-	// Insert directions
-	for _, direction := range newRecipe.Directions {
-		err = repo.DB.InsertDirection(direction.Direction, recipeId)
-		if err != nil {
-			//TODO Delete recipe?
-			fmt.Println(err)
-		}
+	_, err = repo.DB.SaveRecipe(newRecipe, user.ID)
+	if err != nil {
+		fmt.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error saving recipe")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -311,17 +492,19 @@ func (repo *Repository) PostNewRecipe(w http.ResponseWriter, r *http.Request) {
 
 // PostDeleteRecipe deletes a recipe from the database
 func (repo *Repository) PostDeleteRecipe(w http.ResponseWriter, r *http.Request) {
-	exploded := strings.Split(r.RequestURI, "/")
-	recipeID, err := strconv.Atoi(exploded[3])
+	recipeID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		//TODO handle err
 		fmt.Println(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
 	err = repo.DB.DeleteRecipe(recipeID)
 	if err != nil {
-		//TODO handle err
 		fmt.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error deleting recipe")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
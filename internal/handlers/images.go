@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/popnfresh234/recipe-app-golang/internal/helpers"
+	"github.com/popnfresh234/recipe-app-golang/internal/images"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Image serves the image with the {key} URL parameter. Keys are derived from the image,
+// so what a key points to never changes and browsers may keep it for good.
+// Resized copies of images stored before there were copies are made the first time they are asked for.
+func (repo *Repository) Image(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	if !images.ValidKey(key) {
+		http.NotFound(w, r)
+		return
+	}
+
+	etag := `"` + key + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		setImageCacheHeaders(w, etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data, err := repo.App.Images.Get(r.Context(), key)
+	if errors.Is(err, images.ErrNotFound) {
+		data, err = images.Resize(r.Context(), repo.App.Images, key)
+	}
+	if errors.Is(err, images.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error getting image", http.StatusInternalServerError)
+		return
+	}
+	setImageCacheHeaders(w, etag)
+	w.Header().Set("Content-Type", images.ContentType(key))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	_, _ = w.Write(data)
+}
+
+// PostImage stores the image in the image field of a multipart form, resized and without its metadata,
+// and answers with the ID recipes reference it by. The pages and the API share it.
+// Each user can upload images.UploadsPerDay images a day.
+func (repo *Repository) PostImage(w http.ResponseWriter, r *http.Request) {
+	user, _ := repo.CurrentUser(r)
+	uploads, err := repo.DB.CountUploads(user.ID, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		log.Println(err)
+		helpers.WriteJSONError(w, http.StatusInternalServerError, "Error saving image", nil)
+		return
+	}
+	if uploads >= images.UploadsPerDay {
+		helpers.WriteJSONError(w, http.StatusTooManyRequests,
+			fmt.Sprintf("At most %d images can be uploaded a day", images.UploadsPerDay), nil)
+		return
+	}
+
+	data, ok := readImageUpload(w, r)
+	if !ok {
+		return
+	}
+	if !slices.Contains(images.Types, http.DetectContentType(data)) {
+		helpers.WriteJSONError(w, http.StatusUnsupportedMediaType, "Unsupported image",
+			map[string][]string{"image": {"The image must be a PNG, JPEG or WebP"}})
+		return
+	}
+
+	key, err := images.Upload(r.Context(), repo.App.Images, data)
+	if errors.Is(err, images.ErrInvalidImage) {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Invalid image",
+			map[string][]string{"image": {"The image could not be read as a PNG, JPEG or WebP"}})
+		return
+	}
+	if err == nil {
+		err = repo.DB.InsertUpload(user.ID, key)
+	}
+	if err != nil {
+		log.Println(err)
+		helpers.WriteJSONError(w, http.StatusInternalServerError, "Error saving image", nil)
+		return
+	}
+
+	w.Header().Set("Location", imageURL(key))
+	helpers.WriteJSON(w, http.StatusCreated, models.JsonImage{ID: key, URL: imageURL(key)})
+}
+
+// RemoveUnusedUploads removes the images uploaded more than images.UploadTTL ago that no recipe uses
+func (repo *Repository) RemoveUnusedUploads() {
+	removed, err := repo.DB.DeleteUploads(time.Now().Add(-images.UploadTTL))
+	if err != nil {
+		log.Println("Error removing unused uploads", err)
+		return
+	}
+	if removed > 0 {
+		log.Println("Removed", removed, "unused uploads")
+	}
+}
+
+// readImageUpload reads the image field of a multipart form, writing an error when there is none or it is too large.
+// The other fields are skipped without being kept.
+func readImageUpload(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, images.MaxUploadBytes)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Expected a multipart/form-data body with an image field", nil)
+		return nil, false
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == nil && part.FormName() != "image" {
+			continue
+		}
+		var data []byte
+		if err == nil {
+			data, err = io.ReadAll(part)
+		}
+
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			helpers.WriteJSONError(w, http.StatusRequestEntityTooLarge, "Image too large",
+				map[string][]string{"image": {fmt.Sprintf("The image must be at most %d MB", images.MaxUploadBytes>>20)}})
+			return nil, false
+		case errors.Is(err, io.EOF):
+			helpers.WriteJSONError(w, http.StatusBadRequest, "Missing image",
+				map[string][]string{"image": {"Choose an image to upload"}})
+			return nil, false
+		case err != nil:
+			helpers.WriteJSONError(w, http.StatusBadRequest, "Invalid multipart body: "+err.Error(), nil)
+			return nil, false
+		}
+		return data, true
+	}
+}
+
+// setImageCacheHeaders lets browsers and proxies keep an image for a year without asking again
+func setImageCacheHeaders(w http.ResponseWriter, etag string) {
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", etag)
+}
+
+// storeImage moves a newly uploaded base64 image of recipe to the image store, along with its resized copies,
+// and replaces it with its key. Images that are already keys are left alone. The recipe must have been validated.
+// Images that can't be decoded return an images.ErrInvalidImage, keys that aren't in the store a notStoredError.
+func (repo *Repository) storeImage(r *http.Request, recipe *models.JsonRecipe) error {
+	err := repo.checkImagesStored(r, *recipe)
+	if err != nil {
+		return err
+	}
+	if recipe.Image == "" || images.ValidKey(recipe.Image) {
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(recipe.Image)
+	if err != nil {
+		return err
+	}
+	recipe.Image, err = images.Upload(r.Context(), repo.App.Images, data)
+	return err
+}
+
+// notStoredError lists the paths of the images a recipe references by a key the image store doesn't have
+type notStoredError struct {
+	paths []string
+}
+
+func (e notStoredError) Error() string {
+	return "images not stored: " + strings.Join(e.paths, ", ")
+}
+
+// checkImagesStored checks that every image recipe references by key is in the image store
+func (repo *Repository) checkImagesStored(r *http.Request, recipe models.JsonRecipe) error {
+	type keyedImage struct {
+		path, key string
+	}
+	var keyed []keyedImage
+	if images.ValidKey(recipe.Image) {
+		keyed = append(keyed, keyedImage{"image", recipe.Image})
+	}
+	for i, photo := range recipe.Photos {
+		keyed = append(keyed, keyedImage{fmt.Sprintf("photos[%d].image", i), photo.Image})
+	}
+	for i, direction := range recipe.Directions {
+		for j, photo := range direction.Photos {
+			keyed = append(keyed, keyedImage{fmt.Sprintf("directions[%d].photos[%d].image", i, j), photo.Image})
+		}
+	}
+
+	var missing notStoredError
+	stored := make(map[string]bool)
+	for _, image := range keyed {
+		exists, checked := stored[image.key]
+		if !checked {
+			var err error
+			exists, err = repo.App.Images.Exists(r.Context(), image.key)
+			if err != nil {
+				return err
+			}
+			stored[image.key] = exists
+		}
+		if !exists {
+			missing.paths = append(missing.paths, image.path)
+		}
+	}
+	if len(missing.paths) > 0 {
+		return missing
+	}
+	return nil
+}
+
+// invalidImage answers that the image of a recipe could not be read when err is an images.ErrInvalidImage,
+// or which images haven't been uploaded when err is a notStoredError
+func invalidImage(w http.ResponseWriter, err error) bool {
+	var missing notStoredError
+	if errors.As(err, &missing) {
+		fields := make(map[string][]string)
+		for _, path := range missing.paths {
+			fields[path] = []string{"Upload the image first"}
+		}
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Invalid recipe", fields)
+		return true
+	}
+	if !errors.Is(err, images.ErrInvalidImage) {
+		return false
+	}
+	helpers.WriteJSONError(w, http.StatusBadRequest, "Invalid recipe",
+		map[string][]string{"image": {"The image could not be read as a PNG, JPEG or WebP"}})
+	return true
+}
+
+// imageURL is the URL an image key is served at
+func imageURL(key string) string {
+	if key == "" {
+		return ""
+	}
+	return "/images/" + key
+}
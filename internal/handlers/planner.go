@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/popnfresh234/recipe-app-golang/internal/forms"
+	"github.com/popnfresh234/recipe-app-golang/internal/helpers"
+	"github.com/popnfresh234/recipe-app-golang/internal/mealplan"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"github.com/popnfresh234/recipe-app-golang/internal/renderer"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How far back and ahead the calendar feed lists meals
+const (
+	feedWeeksBack  = 4
+	feedWeeksAhead = 26
+)
+
+// Planner shows the user's meal plan as a week or a month, in the view query parameter, around the date query
+// parameter. It shows the week of today by default.
+func (repo *Repository) Planner(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	repo.renderPlanner(w, r, query.Get("view"), query.Get("date"), forms.New(nil), "")
+}
+
+// PostPlannerMeal plans a recipe for a date and slot
+func (repo *Repository) PostPlannerMeal(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("recipe", "date", "slot")
+	date, err := time.Parse(models.DateLayout, form.Get("date"))
+	if err != nil && form.Get("date") != "" {
+		form.Errors.Add("date", "Use a date like 2024-04-13")
+	}
+	slot := form.Get("slot")
+	if slot != "" && !slices.Contains(models.MealSlots, slot) {
+		form.Errors.Add("slot", "Pick breakfast, lunch or dinner")
+	}
+	recipeID, err := strconv.Atoi(form.Get("recipe"))
+	if err == nil {
+		_, err = repo.DB.GetRecipeDetails(recipeID)
+	}
+	if err != nil && form.Get("recipe") != "" {
+		log.Println(err)
+		form.Errors.Add("recipe", "Pick a recipe from the list")
+	}
+	if !form.Valid() {
+		repo.renderPlanner(w, r, form.Get("view"), form.Get("date"), form, "")
+		return
+	}
+
+	user, _ := repo.CurrentUser(r)
+	_, err = repo.DB.InsertMeal(user.ID, recipeID, date, slot)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error planning meal")
+	} else {
+		repo.App.Session.Put(r.Context(), "flash", "Meal planned")
+	}
+	http.Redirect(w, r, plannerURL(form.Get("view"), date), http.StatusSeeOther)
+}
+
+// PostPlannerDeleteMeal takes a meal of the user off the plan, then goes back to the view and date in the form
+func (repo *Repository) PostPlannerDeleteMeal(w http.ResponseWriter, r *http.Request) {
+	mealID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	date, err := time.Parse(models.DateLayout, r.PostForm.Get("date"))
+	if err != nil {
+		date = time.Now()
+	}
+
+	user, _ := repo.CurrentUser(r)
+	err = repo.DB.DeleteMeal(user.ID, mealID)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Meal not found")
+	} else {
+		repo.App.Session.Put(r.Context(), "flash", "Meal removed")
+	}
+	http.Redirect(w, r, plannerURL(r.PostForm.Get("view"), date), http.StatusSeeOther)
+}
+
+// PostPlannerFeed creates a new URL for the user's calendar feed, the old URL stops working.
+// The page shows the URL this once, only the hash of its token is stored.
+func (repo *Repository) PostPlannerFeed(w http.ResponseWriter, r *http.Request) {
+	user, _ := repo.CurrentUser(r)
+	token, err := helpers.NewCalendarToken()
+	if err == nil {
+		err = repo.DB.SetCalendarToken(user.ID, helpers.HashApiToken(token))
+	}
+	if err != nil {
+		log.Println("Error creating calendar token", err)
+		repo.App.Session.Put(r.Context(), "error", "Error creating calendar feed")
+		http.Redirect(w, r, "/planner", http.StatusSeeOther)
+		return
+	}
+
+	feedURL := repo.siteURL(r)
+	feedURL.Path = "/calendar/" + token + ".ics"
+
+	// Keep the page with the feed URL out of caches
+	w.Header().Set("Cache-Control", "no-store")
+	repo.renderPlanner(w, r, "", "", forms.New(nil), feedURL.String())
+}
+
+// CalendarFeed serves the meals planned by the user whose calendar token is in the URL as an iCalendar feed.
+// Calendar apps fetch it without a session, the token is what authenticates them.
+func (repo *Repository) CalendarFeed(w http.ResponseWriter, r *http.Request) {
+	user, err := repo.DB.GetUserByCalendarToken(helpers.HashApiToken(chi.URLParam(r, "token")))
+	if err != nil || user.Disabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	today := mealplan.Date(time.Now())
+	meals, err := repo.DB.ListMeals(user.ID, today.AddDate(0, 0, -7*feedWeeksBack), today.AddDate(0, 0, 7*feedWeeksAhead))
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	_, _ = w.Write([]byte(mealplan.Calendar(user.Name+"'s meals", meals, repo.siteURL(r), time.Now())))
+}
+
+// siteURL is the URL of the site the request was made to, for links that leave the site like those in calendars
+func (repo *Repository) siteURL(r *http.Request) url.URL {
+	scheme := "http"
+	if repo.App.InProduction {
+		scheme = "https"
+	}
+	return url.URL{Scheme: scheme, Host: r.Host}
+}
+
+// plannerURL links to the planner showing view around date
+func plannerURL(view string, date time.Time) string {
+	if view != mealplan.ViewMonth {
+		view = mealplan.ViewWeek
+	}
+	return fmt.Sprintf("/planner?view=%s&date=%s", view, date.Format(models.DateLayout))
+}
+
+// renderPlanner renders the planner grid of view around date, today when date isn't a date, with the form to plan
+// a meal and a recipe picker backed by search. feedURL is a calendar feed URL that was just created.
+func (repo *Repository) renderPlanner(w http.ResponseWriter, r *http.Request, view, date string, form *forms.Form, feedURL string) {
+	today := time.Now()
+	day, err := time.Parse(models.DateLayout, date)
+	if err != nil {
+		day = today
+	}
+	grid := mealplan.NewGrid(view, day, today)
+
+	user, _ := repo.CurrentUser(r)
+	meals, err := repo.DB.ListMeals(user.ID, grid.Start, grid.End)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error getting meal plan")
+	}
+	grid.Add(meals)
+
+	// The recipe picker offers a page of the recipes found by the q query parameter, along with the recipe of a
+	// form that had errors
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+	page := pageNumber(r)
+	recipes, total, err := repo.pickRecipes(search, page)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error getting recipes")
+	}
+	if recipeID, err := strconv.Atoi(form.Get("recipe")); err == nil &&
+		!slices.ContainsFunc(recipes, func(recipe models.Recipe) bool { return recipe.ID == recipeID }) {
+		if recipe, err := repo.DB.GetRecipeDetails(recipeID); err == nil {
+			recipes = append([]models.Recipe{recipe}, recipes...)
+		}
+	}
+
+	slotNames := make(map[string]string, len(models.MealSlots))
+	for _, slot := range models.MealSlots {
+		slotNames[slot] = mealplan.SlotName(slot)
+	}
+
+	data := make(map[string]interface{})
+	data["grid"] = grid
+	data["slots"] = models.MealSlots
+	data["slotNames"] = slotNames
+	data["query"] = search
+	data["recipes"] = recipes
+	data["feedURL"] = feedURL
+	data["weekdays"] = []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+	addPageData(data, page, total, "/planner", url.Values{"view": {grid.View}, "date": {grid.Date.Format(models.DateLayout)}, "q": {search}})
+	_ = renderer.Template(w, r, "planner.page.tmpl", &models.TemplateData{Data: data, Form: form})
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/popnfresh234/recipe-app-golang/internal/forms"
+	"github.com/popnfresh234/recipe-app-golang/internal/helpers"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"github.com/popnfresh234/recipe-app-golang/internal/renderer"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// apiTokenNameLength is the longest name an API token can have
+const apiTokenNameLength = 100
+
+// Settings shows the settings page, where users manage their API tokens
+func (repo *Repository) Settings(w http.ResponseWriter, r *http.Request) {
+	repo.renderSettings(w, r, forms.New(nil), "")
+}
+
+// PostSettingsToken creates a named API token. The page shows the token this once, only its hash is stored.
+func (repo *Repository) PostSettingsToken(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+	form.MaxLength("name", apiTokenNameLength)
+	if !form.Valid() {
+		repo.renderSettings(w, r, form, "")
+		return
+	}
+
+	user, _ := repo.CurrentUser(r)
+	token, err := helpers.NewApiToken()
+	if err == nil {
+		_, err = repo.DB.InsertApiToken(user.ID, strings.TrimSpace(form.Get("name")), helpers.HashApiToken(token))
+	}
+	if err != nil {
+		log.Println("Error creating API token", err)
+		repo.App.Session.Put(r.Context(), "error", "Error creating token")
+		http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+		return
+	}
+
+	// Keep the page with the token out of caches
+	w.Header().Set("Cache-Control", "no-store")
+	repo.renderSettings(w, r, forms.New(nil), token)
+}
+
+// PostSettingsRevokeToken revokes one of the user's API tokens
+func (repo *Repository) PostSettingsRevokeToken(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	user, _ := repo.CurrentUser(r)
+	err = repo.DB.DeleteApiToken(user.ID, tokenID)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Token not found")
+		http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Token revoked")
+	http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+}
+
+// renderSettings renders the settings page with the user's tokens, newToken is a token that was just created
+func (repo *Repository) renderSettings(w http.ResponseWriter, r *http.Request, form *forms.Form, newToken string) {
+	user, _ := repo.CurrentUser(r)
+	tokens, err := repo.DB.ListApiTokens(user.ID)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error getting tokens")
+	}
+
+	data := make(map[string]interface{})
+	data["tokens"] = tokens
+	data["newToken"] = newToken
+	data["nameLength"] = apiTokenNameLength
+	_ = renderer.Template(w, r, "settings.page.tmpl", &models.TemplateData{Data: data, Form: form})
+}
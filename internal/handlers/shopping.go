@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/popnfresh234/recipe-app-golang/internal/forms"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"github.com/popnfresh234/recipe-app-golang/internal/renderer"
+	"github.com/popnfresh234/recipe-app-golang/internal/shopping"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// shoppingListNameLength is the longest name a shopping list can have
+const shoppingListNameLength = 100
+
+// shoppingListRecipes is how many recipes a shopping list can be made from
+const shoppingListRecipes = 20
+
+// ShoppingLists shows the user's shopping lists and a form to make a new one from several recipes.
+// Recipes are found with the q query parameter and picked into the recipe query parameters.
+func (repo *Repository) ShoppingLists(w http.ResponseWriter, r *http.Request) {
+	repo.renderShoppingLists(w, r, forms.New(nil))
+}
+
+// PostNewShoppingList combines the ingredients of the picked recipes, each multiplied by how many times over
+// it will be cooked, into a new shopping list
+func (repo *Repository) PostNewShoppingList(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+	form.MaxLength("name", shoppingListNameLength)
+	recipeIDs := pickedRecipes(form.Values["recipe"])
+	switch {
+	case len(recipeIDs) == 0:
+		form.Errors.Add("recipe", "Pick at least one recipe")
+	case len(recipeIDs) > shoppingListRecipes:
+		form.Errors.Add("recipe", fmt.Sprintf("Pick at most %d recipes", shoppingListRecipes))
+		recipeIDs = nil
+	}
+
+	var selections []shopping.Selection
+	for _, recipeID := range recipeIDs {
+		field := fmt.Sprintf("multiplier-%d", recipeID)
+		multiplier, err := strconv.ParseFloat(form.Get(field), 64)
+		// NaN fails every comparison, so it is rejected explicitly
+		if err != nil || math.IsNaN(multiplier) || multiplier <= 0 || multiplier > shopping.MaxMultiplier {
+			form.Errors.Add(field, fmt.Sprintf("Use a number above 0 and up to %d", shopping.MaxMultiplier))
+			continue
+		}
+		recipe, err := repo.DB.GetRecipeDetails(recipeID)
+		if err != nil {
+			log.Println(err)
+			form.Errors.Add("recipe", "Pick recipes from the list")
+			continue
+		}
+		selections = append(selections, shopping.Selection{Recipe: recipe, Multiplier: multiplier})
+	}
+	if !form.Valid() {
+		repo.renderShoppingLists(w, r, form)
+		return
+	}
+
+	user, _ := repo.CurrentUser(r)
+	listID, err := repo.DB.InsertShoppingList(user.ID, strings.TrimSpace(form.Get("name")), shopping.Build(selections))
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error saving shopping list")
+		http.Redirect(w, r, "/shopping", http.StatusSeeOther)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Shopping list saved")
+	http.Redirect(w, r, fmt.Sprintf("/shopping/list/%d", listID), http.StatusSeeOther)
+}
+
+// ShoppingList shows a shopping list of the user grouped by store section, with a checkbox for each item
+func (repo *Repository) ShoppingList(w http.ResponseWriter, r *http.Request) {
+	list, ok := repo.shoppingList(w, r)
+	if !ok {
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["list"] = list
+	_ = renderer.Template(w, r, "shopping-list.page.tmpl", &models.TemplateData{Data: data})
+}
+
+// PostCheckShoppingListItem checks the item in the {item} URL parameter off the list, or unchecks it
+func (repo *Repository) PostCheckShoppingListItem(w http.ResponseWriter, r *http.Request) {
+	listID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	itemID, err := strconv.Atoi(chi.URLParam(r, "item"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	user, _ := repo.CurrentUser(r)
+	err = repo.DB.CheckShoppingListItem(user.ID, listID, itemID, r.PostForm.Get("checked") == "true")
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Item not found")
+	}
+	http.Redirect(w, r, fmt.Sprintf("/shopping/list/%d", listID), http.StatusSeeOther)
+}
+
+// ExportShoppingList downloads a shopping list in the format query parameter, plain text by default or Markdown
+func (repo *Repository) ExportShoppingList(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = shopping.FormatText
+	}
+	var contentType, extension string
+	switch format {
+	case shopping.FormatText:
+		contentType, extension = "text/plain; charset=utf-8", "txt"
+	case shopping.FormatMarkdown:
+		contentType, extension = "text/markdown; charset=utf-8", "md"
+	default:
+		http.Error(w, "Unknown format, use one of "+strings.Join(shopping.Formats, ", "), http.StatusBadRequest)
+		return
+	}
+
+	list, ok := repo.shoppingList(w, r)
+	if !ok {
+		return
+	}
+	body := shopping.Text(list)
+	if format == shopping.FormatMarkdown {
+		body = shopping.Markdown(list)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="shopping-list-%d.%s"`, list.ID, extension))
+	_, _ = w.Write([]byte(body))
+}
+
+// PostDeleteShoppingList deletes a shopping list of the user
+func (repo *Repository) PostDeleteShoppingList(w http.ResponseWriter, r *http.Request) {
+	listID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	user, _ := repo.CurrentUser(r)
+	err = repo.DB.DeleteShoppingList(user.ID, listID)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Shopping list not found")
+		http.Redirect(w, r, "/shopping", http.StatusSeeOther)
+		return
+	}
+
+	repo.App.Session.Put(r.Context(), "flash", "Shopping list deleted")
+	http.Redirect(w, r, "/shopping", http.StatusSeeOther)
+}
+
+// shoppingList looks up the user's shopping list in the {id} URL parameter. Lists of other users aren't found.
+// When it isn't, it redirects to the shopping lists with an error and returns false.
+func (repo *Repository) shoppingList(w http.ResponseWriter, r *http.Request) (models.ShoppingList, bool) {
+	listID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return models.ShoppingList{}, false
+	}
+
+	user, _ := repo.CurrentUser(r)
+	list, err := repo.DB.GetShoppingList(user.ID, listID)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Shopping list not found")
+		http.Redirect(w, r, "/shopping", http.StatusSeeOther)
+		return models.ShoppingList{}, false
+	}
+	return list, true
+}
+
+// pickedRecipes reads the IDs of picked recipes, in order and without repeats
+func pickedRecipes(values []string) []int {
+	var recipeIDs []int
+	for _, value := range values {
+		recipeID, err := strconv.Atoi(value)
+		if err == nil && !slices.Contains(recipeIDs, recipeID) {
+			recipeIDs = append(recipeIDs, recipeID)
+		}
+	}
+	return recipeIDs
+}
+
+// renderShoppingLists renders the user's shopping lists and the form for a new one, with a page of the recipes
+// found by the q query parameter to pick from. The recipes picked so far are in the recipe values of the query,
+// or of the form when it had errors.
+func (repo *Repository) renderShoppingLists(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	user, _ := repo.CurrentUser(r)
+	lists, err := repo.DB.ListShoppingLists(user.ID)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error getting shopping lists")
+	}
+
+	query := r.URL.Query()
+	search := strings.TrimSpace(query.Get("q"))
+	values := query["recipe"]
+	if r.Method == http.MethodPost {
+		values = form.Values["recipe"]
+	}
+	recipeIDs := pickedRecipes(values)
+	if len(recipeIDs) > shoppingListRecipes {
+		recipeIDs = recipeIDs[:shoppingListRecipes]
+	}
+	var picked []models.Recipe
+	for _, recipeID := range recipeIDs {
+		recipe, err := repo.DB.GetRecipeDetails(recipeID)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		picked = append(picked, recipe)
+	}
+
+	page := pageNumber(r)
+	recipes, total, err := repo.pickRecipes(search, page)
+	if err != nil {
+		log.Println(err)
+		repo.App.Session.Put(r.Context(), "error", "Error getting recipes")
+	}
+
+	// The links that pick a recipe keep the search and the recipes picked so far
+	pickURL := func(recipeIDs []int) url.Values {
+		values := url.Values{}
+		if search != "" {
+			values.Set("q", search)
+		}
+		for _, recipeID := range recipeIDs {
+			values.Add("recipe", strconv.Itoa(recipeID))
+		}
+		return values
+	}
+	pickURLs := make(map[int]string)
+	for _, recipe := range recipes {
+		if len(recipeIDs) < shoppingListRecipes && !slices.Contains(recipeIDs, recipe.ID) {
+			pickURLs[recipe.ID] = "/shopping?" + pickURL(append(slices.Clone(recipeIDs), recipe.ID)).Encode()
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["lists"] = lists
+	data["query"] = search
+	data["recipes"] = recipes
+	data["picked"] = picked
+	data["pickURLs"] = pickURLs
+	data["nameLength"] = shoppingListNameLength
+	data["maxRecipes"] = shoppingListRecipes
+	data["maxMultiplier"] = shopping.MaxMultiplier
+	addPageData(data, page, total, "/shopping", pickURL(recipeIDs))
+	_ = renderer.Template(w, r, "shopping-lists.page.tmpl", &models.TemplateData{Data: data, Form: form})
+}
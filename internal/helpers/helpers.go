@@ -1,14 +1,30 @@
 package helpers
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/popnfresh234/recipe-app-golang/internal/config"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
 	"net/http"
 )
 
 var app *config.AppConfig
 
+// contextKey keys the values helpers stores in a request context
+type contextKey string
+
+// tokenUserKey holds the user an API token authenticated
+const tokenUserKey contextKey = "token-user"
+
+// apiTokenPrefix marks API tokens, so a leaked token is easy to recognize
+const apiTokenPrefix = "rcp_"
+
 // NewHelpers sets up app config
 func NewHelpers(a *config.AppConfig) {
 	app = a
@@ -21,6 +37,104 @@ func IsAuthenticated(r *http.Request) bool {
 
 }
 
+// CurrentUser returns the logged in user, if any. A user authenticated with an API token wins over the session.
+func CurrentUser(r *http.Request) (models.User, bool) {
+	if user, ok := TokenUser(r); ok {
+		return user, true
+	}
+	user, ok := app.Session.Get(r.Context(), "user").(models.User)
+	return user, ok
+}
+
+// TokenUser returns the user an API token authenticated, if any
+func TokenUser(r *http.Request) (models.User, bool) {
+	user, ok := r.Context().Value(tokenUserKey).(models.User)
+	return user, ok
+}
+
+// WithTokenUser returns a copy of r authenticated as user by an API token
+func WithTokenUser(r *http.Request, user models.User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), tokenUserKey, user))
+}
+
+// NewApiToken creates a random API token. The token is shown to its owner once, only its hash is stored.
+func NewApiToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewCalendarToken creates a random token for the URL of a user's calendar feed. Calendar apps can't log in,
+// so knowing the URL is what lets them read the feed. Like API tokens only its hash is stored.
+func NewCalendarToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashApiToken hashes an API token for storing and looking it up.
+// The tokens are long and random, so unlike passwords they don't need a slow hash.
+func HashApiToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CanModifyRecipe checks if user is allowed to edit or delete recipe, admins may change any recipe
+func CanModifyRecipe(user models.User, recipe models.Recipe) bool {
+	if user.ID == 0 {
+		return false
+	}
+	return user.ID == recipe.UserId || user.HasRole(models.RoleAdmin)
+}
+
+// CSRFToken returns the CSRF token of the session, creating one if the session doesn't have one yet
+func CSRFToken(r *http.Request) string {
+	token := app.Session.GetString(r.Context(), "csrf_token")
+	if token != "" {
+		return token
+	}
+
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		fmt.Println("Error creating CSRF token", err)
+		return ""
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	app.Session.Put(r.Context(), "csrf_token", token)
+	return token
+}
+
+// ValidCSRFToken checks token against the CSRF token of the session
+func ValidCSRFToken(r *http.Request, token string) bool {
+	expected := app.Session.GetString(r.Context(), "csrf_token")
+	if expected == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1
+}
+
+// WriteJSON writes v as a JSON response with status
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		fmt.Println("Error writing JSON", err)
+	}
+}
+
+// WriteJSONError writes a JSON error response, fields holds the validation errors keyed by field, if any
+func WriteJSONError(w http.ResponseWriter, status int, msg string, fields map[string][]string) {
+	WriteJSON(w, status, models.JsonError{Error: msg, Fields: fields})
+}
+
 // GetJson gets a JSON string
 func GetGson(data interface{}) string {
 	jsonString, err := json.MarshalIndent(data, "", "    ")
@@ -0,0 +1,75 @@
+// Package images stores recipe images by key, on the local filesystem or in an S3-compatible bucket.
+// Keys are derived from the contents of an image, so an image is only stored once however often it is uploaded.
+package images
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// Drivers of the image storage
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+)
+
+// ErrNotFound is returned when there is no image with a key
+var ErrNotFound = errors.New("image not found")
+
+// Types are the content types of the images that can be stored
+var Types = []string{"image/png", "image/jpeg", "image/webp"}
+
+// extensions are the extensions of the keys of each type
+var extensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/webp": ".webp",
+}
+
+// keyPattern matches the keys Upload and SizeKey return, which are also safe to use as file names and in URLs.
+// The groups are the hash, the width of a resized copy and the extension.
+var keyPattern = regexp.MustCompile(`^([0-9a-f]{64})(?:-([1-9][0-9]{0,4}))?\.(png|jpg|webp)$`)
+
+// Store keeps images by key
+type Store interface {
+	// Put stores data under key, leaving an image that is already stored alone
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns the image stored under key, or ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Exists reports if an image is stored under key, without reading it
+	Exists(ctx context.Context, key string) (bool, error)
+	// Delete removes the image stored under key, if there is one
+	Delete(ctx context.Context, key string) error
+}
+
+// ValidKey reports if key could have been returned by Upload or SizeKey
+func ValidKey(key string) bool {
+	return keyPattern.MatchString(key)
+}
+
+// OriginalKey reports if key is the key of an uploaded image, rather than of one of its resized copies
+func OriginalKey(key string) bool {
+	matches := keyPattern.FindStringSubmatch(key)
+	return matches != nil && matches[2] == ""
+}
+
+// ContentType is the content type of the image stored under key
+func ContentType(key string) string {
+	for contentType, extension := range extensions {
+		if path.Ext(key) == extension {
+			return contentType
+		}
+	}
+	return "application/octet-stream"
+}
+
+// checkKey keeps keys that aren't from Upload or SizeKey, like ../../etc/passwd, out of the stores
+func checkKey(key string) error {
+	if !ValidKey(key) {
+		return fmt.Errorf("invalid image key %q", key)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package images
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Local stores images as files in a directory
+type Local struct {
+	dir string
+}
+
+// NewLocal creates a store in dir, creating the directory if it doesn't exist
+func NewLocal(dir string) (*Local, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &Local{dir: dir}, nil
+}
+
+// Put writes data to a temporary file first and renames it, so a half written image is never served
+func (l *Local) Put(ctx context.Context, key string, data []byte) error {
+	err := checkKey(key)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(filepath.Join(l.dir, key))
+	if err == nil {
+		return nil
+	}
+
+	f, err := os.CreateTemp(l.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(l.dir, key))
+}
+
+// Get reads the image stored under key
+func (l *Local) Get(ctx context.Context, key string) ([]byte, error) {
+	err := checkKey(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(l.dir, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Exists checks for the file of the image stored under key
+func (l *Local) Exists(ctx context.Context, key string) (bool, error) {
+	err := checkKey(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(filepath.Join(l.dir, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete removes the image stored under key
+func (l *Local) Delete(ctx context.Context, key string) error {
+	err := checkKey(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(l.dir, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,327 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Widths of the resized copies stored next to every image, a card thumbnail and the details page
+const (
+	ThumbWidth  = 400
+	DetailWidth = 1200
+)
+
+// Widths are the widths of the resized copies, smallest first
+var Widths = []int{ThumbWidth, DetailWidth}
+
+// MaxUploadBytes caps the size of an upload, photos of current phones are up to about 10 MB
+const MaxUploadBytes = 12 << 20
+
+// Limits of uploads. An uploaded image that no recipe uses UploadTTL after it was uploaded is removed.
+const (
+	UploadsPerDay = 50
+	UploadTTL     = 24 * time.Hour
+)
+
+// MaxOriginalSize caps the longest side of the stored original, larger photos are scaled down
+const MaxOriginalSize = 2400
+
+// maxPixels keeps images that decode to gigabytes out, the largest phone photos have about 50 megapixels
+const maxPixels = 64 << 20
+
+// decodeSlots caps how many images are decoded at once, the largest take a few hundred megabytes until they are scaled down
+var decodeSlots = make(chan struct{}, 2)
+
+// jpegQuality is a good tradeoff between size and artifacts for photos
+const jpegQuality = 82
+
+// ErrInvalidImage is returned when an upload can't be decoded as a JPEG, PNG or WebP
+var ErrInvalidImage = errors.New("invalid image")
+
+// Upload decodes a JPEG, PNG or WebP and stores it, along with a copy in each of the Widths, and returns its key.
+// Images are re-encoded, which drops their metadata like EXIF camera and GPS data after its orientation is applied.
+// Opaque images become JPEGs and images with transparency PNGs, Go has no WebP encoder.
+func Upload(ctx context.Context, store Store, data []byte) (string, error) {
+	img, err := decode(ctx, data)
+	if err != nil {
+		return "", err
+	}
+
+	extension := ".png"
+	if opaque(img) {
+		extension = ".jpg"
+	}
+	sum := sha256.Sum256(data)
+	key := hex.EncodeToString(sum[:]) + extension
+
+	err = putEncoded(ctx, store, key, img)
+	if err != nil {
+		return "", err
+	}
+	for _, width := range Widths {
+		err = putEncoded(ctx, store, SizeKey(key, width), fit(img, width, width*4))
+		if err != nil {
+			return "", err
+		}
+	}
+	return key, nil
+}
+
+// SizeKey is the key of the copy of the image with key resized to width.
+// Copies of images that aren't PNGs are JPEGs.
+func SizeKey(key string, width int) string {
+	extension := path.Ext(key)
+	if extension != ".png" {
+		extension = ".jpg"
+	}
+	return strings.TrimSuffix(key, path.Ext(key)) + "-" + strconv.Itoa(width) + extension
+}
+
+// Remove deletes the image with key from store along with its copy in each of the Widths
+func Remove(ctx context.Context, store Store, key string) error {
+	keys := []string{key}
+	for _, width := range Widths {
+		keys = append(keys, SizeKey(key, width))
+	}
+	for _, key := range keys {
+		err := store.Delete(ctx, key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Resize creates the resized copy with key from the original, for images stored before the copies were made.
+// Only copies in the Widths can be created, it returns ErrNotFound for any other key.
+func Resize(ctx context.Context, store Store, key string) ([]byte, error) {
+	matches := keyPattern.FindStringSubmatch(key)
+	if matches == nil {
+		return nil, fmt.Errorf("invalid image key %q", key)
+	}
+	width, _ := strconv.Atoi(matches[2])
+	if !slices.Contains(Widths, width) {
+		return nil, ErrNotFound
+	}
+
+	// Copies of PNGs are PNGs, the original of any other copy may have been a JPEG or a WebP
+	originals := []string{matches[1] + ".jpg", matches[1] + ".webp"}
+	if matches[3] == "png" {
+		originals = []string{matches[1] + ".png"}
+	}
+	for _, original := range originals {
+		data, err := store.Get(ctx, original)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		img, err := decode(ctx, data)
+		if err != nil {
+			return nil, err
+		}
+		resized, err := encode(fit(img, width, width*4), key)
+		if err != nil {
+			return nil, err
+		}
+		return resized, store.Put(ctx, key, resized)
+	}
+	return nil, ErrNotFound
+}
+
+// decode decodes a JPEG, PNG or WebP, scales it down to fit in MaxOriginalSize and turns it the way its
+// EXIF orientation says. It is turned once it is scaled down, so only the small copy is copied again.
+func decode(ctx context.Context, data []byte) (image.Image, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if format != "jpeg" && format != "png" && format != "webp" {
+		return nil, fmt.Errorf("%w: unsupported format %s", ErrInvalidImage, format)
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d is too large", ErrInvalidImage, config.Width, config.Height)
+	}
+
+	select {
+	case decodeSlots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-decodeSlots }()
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	img = fit(img, MaxOriginalSize, MaxOriginalSize)
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+	return img, nil
+}
+
+// putEncoded encodes img in the format of key and stores it
+func putEncoded(ctx context.Context, store Store, key string, img image.Image) error {
+	data, err := encode(img, key)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, key, data)
+}
+
+// encode encodes img as a PNG or a JPEG, going by the extension of key
+func encode(img image.Image, key string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if path.Ext(key) == ".png" {
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	return buf.Bytes(), err
+}
+
+// opaque reports if img has no transparent pixels
+func opaque(img image.Image) bool {
+	o, ok := img.(interface{ Opaque() bool })
+	return ok && o.Opaque()
+}
+
+// fit scales img down to fit in maxWidth by maxHeight, keeping its aspect ratio. Images are never scaled up.
+func fit(img image.Image, maxWidth, maxHeight int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxWidth && height <= maxHeight {
+		return img
+	}
+	if width*maxHeight > height*maxWidth {
+		width, height = maxWidth, max(1, height*maxWidth/width)
+	} else {
+		width, height = max(1, width*maxHeight/height), maxHeight
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation of a JPEG, 1 when it has none.
+// See the TIFF 6.0 and EXIF 2.3 specifications, orientation is tag 0x0112 of the first IFD.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		// The image data starts at start of scan, there is no metadata after it
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation finds the orientation in the TIFF structure of an EXIF segment
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+// orient turns and flips img so that it is upright, given its EXIF orientation
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	// Images that were scaled down are NRGBA already
+	bounds := img.Bounds()
+	src, ok := img.(*image.NRGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		src = image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	}
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Orientations 5 to 8 swap width and height
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // flipped horizontally
+				sx, sy = w-1-x, y
+			case 3: // turned 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // flipped vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // turned 90° counterclockwise, so it is turned back clockwise
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // turned 90° clockwise, so it is turned back counterclockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
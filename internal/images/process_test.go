@@ -0,0 +1,256 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testImage is a width by height image, red on the left half and blue on the right
+func testImage(width, height int, alpha uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBA{R: 255, A: alpha}
+			if x >= width/2 {
+				c = color.NRGBA{B: 255, A: alpha}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// exifSegment is an APP1 segment with orientation 6, turned 90° counterclockwise, and a GPS position
+func exifSegment() []byte {
+	gps := "GPS 52.3676 N 4.9041 E\x00"
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08" +
+		"\x00\x02" + // two entries
+		"\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00" + // orientation, a short
+		"\x01\x0e\x00\x02\x00\x00\x00\x18\x00\x00\x00\x26" + // image description, 24 characters at 38
+		"\x00\x00\x00\x00" + // no next IFD
+		gps)
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	length := len(segment) + 2
+	return append([]byte{0xFF, 0xE1, byte(length >> 8), byte(length)}, segment...)
+}
+
+func newTestLocal(t *testing.T) *Local {
+	store, err := NewLocal(filepath.Join(t.TempDir(), "images"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func decodeStored(t *testing.T, store Store, key string) (image.Image, []byte) {
+	t.Helper()
+	data, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("expected %s to be stored, got %v", key, err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img, data
+}
+
+func TestUploadStripsExif(t *testing.T) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, testImage(40, 20, 255), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo := append(append([]byte{0xFF, 0xD8}, exifSegment()...), buf.Bytes()[2:]...)
+	if jpegOrientation(photo) != 6 {
+		t.Fatalf("expected orientation 6, got %d", jpegOrientation(photo))
+	}
+
+	store := newTestLocal(t)
+	key, err := Upload(context.Background(), store, photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(key, ".jpg") {
+		t.Errorf("expected a JPEG, got %s", key)
+	}
+
+	img, data := decodeStored(t, store, key)
+	if bytes.Contains(data, []byte("Exif")) || bytes.Contains(data, []byte("GPS")) {
+		t.Error("expected the EXIF data to be removed")
+	}
+	// Turned back clockwise, the red half is on top
+	if img.Bounds().Dx() != 20 || img.Bounds().Dy() != 40 {
+		t.Fatalf("expected the image to be upright, got %v", img.Bounds())
+	}
+	if r, _, b, _ := img.At(10, 5).RGBA(); r < b {
+		t.Error("expected the top to be red")
+	}
+	if r, _, b, _ := img.At(10, 35).RGBA(); r > b {
+		t.Error("expected the bottom to be blue")
+	}
+
+	// Large photos are scaled down before they are turned
+	buf.Reset()
+	err = jpeg.Encode(&buf, testImage(3000, 1000, 255), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo = append(append([]byte{0xFF, 0xD8}, exifSegment()...), buf.Bytes()[2:]...)
+	key, err = Upload(context.Background(), store, photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, _ = decodeStored(t, store, key)
+	if img.Bounds().Size() != (image.Point{X: 800, Y: MaxOriginalSize}) {
+		t.Errorf("expected the photo to be upright and scaled down, got %v", img.Bounds())
+	}
+	if r, _, b, _ := img.At(400, 100).RGBA(); r < b {
+		t.Error("expected the top to be red")
+	}
+}
+
+func TestDecodeSlots(t *testing.T) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, testImage(10, 10, 255))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With every slot taken, uploads wait until they are canceled
+	for range cap(decodeSlots) {
+		decodeSlots <- struct{}{}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = Upload(ctx, newTestLocal(t), buf.Bytes())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the upload to wait for a slot, got %v", err)
+	}
+
+	for range cap(decodeSlots) {
+		<-decodeSlots
+	}
+	_, err = Upload(context.Background(), newTestLocal(t), buf.Bytes())
+	if err != nil {
+		t.Errorf("expected the upload to get a slot, got %v", err)
+	}
+}
+
+func TestUploadSizes(t *testing.T) {
+	ctx := context.Background()
+	store := newTestLocal(t)
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, testImage(3000, 1000, 255))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := Upload(ctx, store, buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ValidKey(key) || !strings.HasSuffix(key, ".jpg") {
+		t.Fatalf("expected an opaque PNG to become a JPEG, got %s", key)
+	}
+	for key, want := range map[string]image.Point{
+		key:                       {MaxOriginalSize, 800},
+		SizeKey(key, ThumbWidth):  {ThumbWidth, 133},
+		SizeKey(key, DetailWidth): {DetailWidth, 400},
+	} {
+		img, _ := decodeStored(t, store, key)
+		if img.Bounds().Size() != want {
+			t.Errorf("%s: expected %v, got %v", key, want, img.Bounds().Size())
+		}
+	}
+
+	// Small images aren't scaled up, and transparency is kept
+	buf.Reset()
+	err = png.Encode(&buf, testImage(100, 50, 128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err = Upload(ctx, store, buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(key, ".png") {
+		t.Fatalf("expected a transparent image to stay a PNG, got %s", key)
+	}
+	for _, width := range Widths {
+		img, _ := decodeStored(t, store, SizeKey(key, width))
+		if img.Bounds().Dx() != 100 {
+			t.Errorf("expected %d to be as wide as the image, got %v", width, img.Bounds())
+		}
+		if _, _, _, a := img.At(0, 0).RGBA(); a == 0xffff {
+			t.Error("expected the copy to be transparent")
+		}
+	}
+
+	// Removing an image removes its copies, removing it again does nothing
+	for range 2 {
+		err = Remove(ctx, store, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, removed := range []string{key, SizeKey(key, ThumbWidth), SizeKey(key, DetailWidth)} {
+		_, err = store.Get(ctx, removed)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected %s to be removed, got %v", removed, err)
+		}
+	}
+
+	for _, data := range [][]byte{[]byte("GIF89a"), []byte("\x89PNG\r\n\x1a\nnot really a png"), nil} {
+		_, err = Upload(ctx, store, data)
+		if !errors.Is(err, ErrInvalidImage) {
+			t.Errorf("expected %q to be invalid, got %v", data, err)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	ctx := context.Background()
+	store := newTestLocal(t)
+
+	// An original stored before there were copies
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, testImage(1600, 800, 255), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := strings.Repeat("1", 64) + ".jpg"
+	err = store.Put(ctx, key, buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Resize(ctx, store, SizeKey(key, ThumbWidth))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, _ := decodeStored(t, store, SizeKey(key, ThumbWidth))
+	if img.Bounds().Dx() != ThumbWidth || len(data) == 0 {
+		t.Errorf("expected a thumbnail, got %v", img.Bounds())
+	}
+
+	for _, missing := range []string{
+		SizeKey(key, 123),
+		SizeKey(strings.Repeat("0", 64)+".jpg", ThumbWidth),
+		key,
+	} {
+		_, err = Resize(ctx, store, missing)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected not found, got %v", missing, err)
+		}
+	}
+}
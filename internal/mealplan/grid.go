@@ -0,0 +1,93 @@
+// Package mealplan lays planned meals out in week and month grids and exports them as an iCalendar feed
+package mealplan
+
+import (
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"time"
+)
+
+// Views of the planner
+const (
+	ViewWeek  = "week"
+	ViewMonth = "month"
+)
+
+// Day is a day of a grid with the meals planned on it
+type Day struct {
+	Date    time.Time
+	InMonth bool // false for the days of the weeks around a month that a month grid shows too
+	Today   bool
+	Meals   []models.Meal
+}
+
+// Slot gets the meals of the day planned in slot
+func (d Day) Slot(slot string) []models.Meal {
+	var meals []models.Meal
+	for _, meal := range d.Meals {
+		if meal.Slot == slot {
+			meals = append(meals, meal)
+		}
+	}
+	return meals
+}
+
+// Grid is the days a view of the planner shows, a row for each week starting on Monday
+type Grid struct {
+	View  string
+	Date  time.Time // the day the grid was laid out around
+	Start time.Time // the first day shown
+	End   time.Time // the day after the last one shown
+	Prev  time.Time // a day in the grid before this one
+	Next  time.Time // a day in the grid after this one
+	Weeks [][]Day
+}
+
+// Date truncates t to midnight UTC of its day, the way the dates of meals are kept
+func Date(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// weekStart is the Monday of the week of date
+func weekStart(date time.Time) time.Time {
+	return date.AddDate(0, 0, -(int(date.Weekday())+6)%7)
+}
+
+// NewGrid lays out the days view shows around date, the week of date or every week of its month.
+// Views other than ViewMonth are ViewWeek.
+func NewGrid(view string, date, today time.Time) Grid {
+	date, today = Date(date), Date(today)
+	g := Grid{View: ViewWeek, Date: date}
+	if view == ViewMonth {
+		first := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+		last := first.AddDate(0, 1, -1)
+		g.View = ViewMonth
+		g.Start, g.End = weekStart(first), weekStart(last).AddDate(0, 0, 7)
+		g.Prev, g.Next = first.AddDate(0, -1, 0), first.AddDate(0, 1, 0)
+	} else {
+		g.Start = weekStart(date)
+		g.End = g.Start.AddDate(0, 0, 7)
+		g.Prev, g.Next = date.AddDate(0, 0, -7), date.AddDate(0, 0, 7)
+	}
+
+	for day := g.Start; day.Before(g.End); day = day.AddDate(0, 0, 1) {
+		if day.Weekday() == time.Monday {
+			g.Weeks = append(g.Weeks, nil)
+		}
+		week := &g.Weeks[len(g.Weeks)-1]
+		*week = append(*week, Day{Date: day, InMonth: day.Month() == date.Month(), Today: day.Equal(today)})
+	}
+	return g
+}
+
+// Add puts meals on their days, meals of days the grid doesn't show are left out
+func (g *Grid) Add(meals []models.Meal) {
+	for _, meal := range meals {
+		if meal.Date.Before(g.Start) || !meal.Date.Before(g.End) {
+			continue
+		}
+		days := int(meal.Date.Sub(g.Start).Hours() / 24)
+		day := &g.Weeks[days/7][days%7]
+		day.Meals = append(day.Meals, meal)
+	}
+}
@@ -0,0 +1,86 @@
+package mealplan
+
+import (
+	"fmt"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// slotHours are the hours meals of each slot start at. Meals last an hour.
+var slotHours = map[string]int{
+	models.SlotBreakfast: 8,
+	models.SlotLunch:     12,
+	models.SlotDinner:    18,
+}
+
+// textEscaper escapes the characters that are special in iCalendar text
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", "")
+
+// maxLineOctets is how long a line of an iCalendar file may be before it is folded
+const maxLineOctets = 75
+
+// Calendar writes meals as an iCalendar feed named name. Each meal is an event at the hour of its slot in floating
+// time, so calendar apps show dinner at 18:00 wherever they are, linking to its recipe on site.
+// stamp is when the feed was made.
+func Calendar(name string, meals []models.Meal, site url.URL, stamp time.Time) string {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Recipe App//Meal planner//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + textEscaper.Replace(name),
+	}
+	for _, meal := range meals {
+		start := meal.Date.Add(time.Duration(slotHours[meal.Slot]) * time.Hour)
+		link := site
+		link.Path = fmt.Sprintf("/recipe/details/%d", meal.RecipeID)
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:meal-%d@%s", meal.ID, site.Hostname()),
+			"DTSTAMP:"+stamp.UTC().Format("20060102T150405Z"),
+			"DTSTART:"+start.Format("20060102T150405"),
+			"DTEND:"+start.Add(time.Hour).Format("20060102T150405"),
+			"SUMMARY:"+textEscaper.Replace(SlotName(meal.Slot)+": "+meal.RecipeTitle),
+			"URL:"+link.String(),
+			"END:VEVENT",
+		)
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(fold(line))
+	}
+	return b.String()
+}
+
+// SlotName is the name of a meal slot as it is shown, like Dinner
+func SlotName(slot string) string {
+	if slot == "" {
+		return ""
+	}
+	return strings.ToUpper(slot[:1]) + slot[1:]
+}
+
+// fold ends a line with CRLF, folding it onto continuation lines that start with a space when it is too long.
+// Lines are only folded between characters, never inside one.
+func fold(line string) string {
+	var b strings.Builder
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// The space starting a continuation line counts towards its length
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(line + "\r\n")
+	return b.String()
+}
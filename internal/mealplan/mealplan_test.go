@@ -0,0 +1,110 @@
+package mealplan
+
+import (
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse(models.DateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestNewGrid(t *testing.T) {
+	today := day("2024-04-17")
+
+	week := NewGrid(ViewWeek, day("2024-04-14"), today)
+	if len(week.Weeks) != 1 || len(week.Weeks[0]) != 7 {
+		t.Fatalf("week grid has %d weeks", len(week.Weeks))
+	}
+	if !week.Start.Equal(day("2024-04-08")) || !week.End.Equal(day("2024-04-15")) {
+		t.Errorf("week of Sunday 14 April runs from %v to %v", week.Start, week.End)
+	}
+	if !week.Prev.Equal(day("2024-04-07")) || !week.Next.Equal(day("2024-04-21")) {
+		t.Errorf("week grid goes back to %v and on to %v", week.Prev, week.Next)
+	}
+
+	month := NewGrid(ViewMonth, day("2024-04-17"), today)
+	if len(month.Weeks) != 5 {
+		t.Fatalf("April 2024 has %d weeks, want 5", len(month.Weeks))
+	}
+	if !month.Start.Equal(day("2024-04-01")) || !month.End.Equal(day("2024-05-06")) {
+		t.Errorf("April 2024 runs from %v to %v", month.Start, month.End)
+	}
+	if !month.Prev.Equal(day("2024-03-01")) || !month.Next.Equal(day("2024-05-01")) {
+		t.Errorf("month grid goes back to %v and on to %v", month.Prev, month.Next)
+	}
+	last := month.Weeks[4][6]
+	if last.InMonth || !last.Date.Equal(day("2024-05-05")) {
+		t.Errorf("last day of the April grid is %v, in month %v", last.Date, last.InMonth)
+	}
+	if !month.Weeks[2][2].Today {
+		t.Errorf("Wednesday 17 April is not today")
+	}
+
+	meals := []models.Meal{
+		{ID: 1, Date: day("2024-04-17"), Slot: models.SlotDinner},
+		{ID: 2, Date: day("2024-04-17"), Slot: models.SlotBreakfast},
+		{ID: 3, Date: day("2024-05-06"), Slot: models.SlotLunch},
+		{ID: 4, Date: day("2024-03-31"), Slot: models.SlotLunch},
+	}
+	month.Add(meals)
+	wednesday := month.Weeks[2][2]
+	if len(wednesday.Meals) != 2 || len(wednesday.Slot(models.SlotDinner)) != 1 || len(wednesday.Slot(models.SlotLunch)) != 0 {
+		t.Errorf("17 April has meals %+v", wednesday.Meals)
+	}
+	count := 0
+	for _, week := range month.Weeks {
+		for _, d := range week {
+			count += len(d.Meals)
+		}
+	}
+	if count != 2 {
+		t.Errorf("grid has %d meals, want the 2 it shows", count)
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	meals := []models.Meal{
+		{ID: 7, RecipeID: 3, RecipeTitle: "Soup; with bread, and butter", Date: day("2024-04-17"), Slot: models.SlotDinner},
+		{ID: 8, RecipeID: 4, RecipeTitle: strings.Repeat("Crème brûlée ", 10), Date: day("2024-04-18"), Slot: models.SlotBreakfast},
+	}
+	site := url.URL{Scheme: "https", Host: "recipes.example.com"}
+	feed := Calendar("Meals", meals, site, time.Date(2024, 4, 13, 10, 30, 0, 0, time.UTC))
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"UID:meal-7@recipes.example.com\r\n",
+		"DTSTAMP:20240413T103000Z\r\n",
+		"DTSTART:20240417T180000\r\nDTEND:20240417T190000\r\n",
+		`SUMMARY:Dinner: Soup\; with bread\, and butter` + "\r\n",
+		"URL:https://recipes.example.com/recipe/details/3\r\n",
+		"DTSTART:20240418T080000\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(feed, want) {
+			t.Errorf("feed is missing %q:\n%s", want, feed)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(feed, "\r\n"), "\r\n")
+	for _, line := range lines {
+		if len(line) > maxLineOctets {
+			t.Errorf("line is %d octets long: %q", len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line splits a character: %q", line)
+		}
+	}
+	unfolded := strings.ReplaceAll(feed, "\r\n ", "")
+	if !strings.Contains(unfolded, "SUMMARY:Breakfast: "+strings.Repeat("Crème brûlée ", 10)+"\r\n") {
+		t.Errorf("long summary doesn't unfold to the title:\n%s", unfolded)
+	}
+}
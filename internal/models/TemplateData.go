@@ -14,4 +14,5 @@ type TemplateData struct {
 	Form            *forms.Form
 	IsAuthenticated int
 	IsAuthor        bool
+	IsAdmin         bool
 }
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Admin actions recorded in the admin_actions table
+const (
+	ActionDisableUser  = "disable user"
+	ActionEnableUser   = "enable user"
+	ActionDeleteUser   = "delete user"
+	ActionAssignRole   = "assign role"
+	ActionRevokeRole   = "revoke role"
+	ActionDeleteRecipe = "delete recipe"
+)
+
+// AdminAction records who did what to which user or recipe from the admin console
+type AdminAction struct {
+	ID         int
+	AdminID    int
+	AdminName  string
+	Action     string
+	TargetType string
+	TargetID   int
+	Details    string
+	CreatedAt  time.Time
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// ApiToken authenticates API requests instead of a session cookie. Only the hash of the token is stored.
+type ApiToken struct {
+	ID         int
+	UserID     int
+	Name       string
+	LastUsedAt time.Time
+	CreatedAt  time.Time
+}
@@ -4,4 +4,6 @@ type Direction struct {
 	ID        int
 	Recipe    Recipe
 	Direction string
+	Position  int
+	Photos    []Photo
 }
@@ -1,9 +1,11 @@
 package models
 
 type Ingredient struct {
-	ID     int
-	Recipe Recipe
-	Name   string
-	Amount string
-	Unit   string
+	ID       int
+	Recipe   Recipe
+	Name     string
+	Amount   string   // the amount as it was typed
+	Quantity Quantity // the amount parsed from Amount
+	Unit     string
+	Position int
 }
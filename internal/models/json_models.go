@@ -1,21 +1,139 @@
 package models
 
+import "time"
+
+// JsonIngredient is an ingredient of a recipe. Its ID and Position, where it is listed from 0, are only set in
+// responses since ingredients are saved in the order they are posted in.
+// Quantity is the amount parsed into numbers, it is also only set in responses and left out when there is no amount.
 type JsonIngredient struct {
-	Id     int    `json:"id"`
-	Name   string `json:"name"`
-	Amount string `json:"amount"`
-	Unit   string `json:"unit"`
+	Id       int           `json:"id" openapi:"readonly"`
+	Name     string        `json:"name"`
+	Amount   string        `json:"amount"`
+	Quantity *JsonQuantity `json:"quantity,omitempty"`
+	Unit     string        `json:"unit"`
+	Position int           `json:"position" openapi:"readonly"`
+}
+
+// JsonQuantity is the amount of an ingredient as numbers, Min and Max are the same unless it is a range like 2-3
+type JsonQuantity struct {
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	ToTaste bool    `json:"to_taste"`
 }
 
+// JsonDirection is a step of a recipe, Position works like the one of a JsonIngredient
 type JsonDirection struct {
-	Id        int    `json:"id"`
-	Direction string `json:"direction"`
+	Id        int         `json:"id" openapi:"readonly"`
+	Direction string      `json:"direction"`
+	Position  int         `json:"position" openapi:"readonly"`
+	Photos    []JsonPhoto `json:"photos,omitempty"`
 }
 
+// JsonPhoto is a photo of a recipe or of one of its directions, shown in the order of the list it is in.
+// Image is the id of an uploaded image, URL is only set in responses.
+type JsonPhoto struct {
+	Image   string `json:"image"`
+	Caption string `json:"caption"`
+	URL     string `json:"url,omitempty" openapi:"readonly"`
+}
+
+// JsonRecipe is a recipe as the pages and the API post it. Image is the id of an image uploaded to
+// POST /api/v1/images, which is what the recipe is read back with. A small base64 PNG, JPEG or WebP is still accepted.
+// Photos are the gallery of the finished dish. Servings is how many people the recipe serves, 0 when it isn't known.
 type JsonRecipe struct {
-	ID          int              `json:"id"`
+	ID          int              `json:"id" openapi:"readonly"`
 	Title       string           `json:"title"`
+	Servings    int              `json:"servings"`
 	Ingredients []JsonIngredient `json:"ingredients"`
 	Directions  []JsonDirection  `json:"directions"`
 	Image       string           `json:"image"`
+	Photos      []JsonPhoto      `json:"photos,omitempty"`
+}
+
+// JsonImage is an uploaded image, recipes reference it by its ID
+type JsonImage struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// JsonAuthor is the author of a recipe as the API shows it
+type JsonAuthor struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// JsonRecipeDetails is a whole recipe as the API returns it
+type JsonRecipeDetails struct {
+	JsonRecipe
+	ImageURL  string     `json:"image_url,omitempty"`
+	Author    JsonAuthor `json:"author"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// JsonRecipeUpdate is the body of an API recipe update. When UpdatedAt is given and the recipe
+// has changed since, the update is rejected so it doesn't overwrite someone else's changes.
+type JsonRecipeUpdate struct {
+	JsonRecipe
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// JsonRecipeOrder moves the ingredients and directions of a recipe without saving the whole recipe.
+// Each list holds the IDs of every ingredient or direction of the recipe in their new order, a list left out keeps its order.
+type JsonRecipeOrder struct {
+	Ingredients []int `json:"ingredients,omitempty"`
+	Directions  []int `json:"directions,omitempty"`
+}
+
+// JsonRecipeSummary is a recipe in an API list, without ingredients, directions or image
+type JsonRecipeSummary struct {
+	ID        int        `json:"id"`
+	Title     string     `json:"title"`
+	Author    JsonAuthor `json:"author"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Page sizes of a JsonRecipeList
+const (
+	JsonRecipeListDefaultLimit = 20
+	JsonRecipeListMaxLimit     = 100
+)
+
+// JsonRecipeList is a page of recipes
+type JsonRecipeList struct {
+	Recipes []JsonRecipeSummary `json:"recipes"`
+	Page    int                 `json:"page"`
+	Limit   int                 `json:"limit"`
+	Total   int                 `json:"total"`
+}
+
+// JsonUser is a user as the API shows it
+type JsonUser struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Roles     []string  `json:"roles"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// JsonTokenRequest exchanges an email and password for an API token
+type JsonTokenRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+}
+
+// JsonToken is a new API token, the only time the token itself is shown
+type JsonToken struct {
+	Token     string    `json:"token"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// JsonError is the body of every API error. Fields holds validation errors keyed by the path of the field,
+// like "title" or "ingredients[2].name".
+type JsonError struct {
+	Error  string              `json:"error"`
+	Fields map[string][]string `json:"fields,omitempty"`
 }
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Meal slots, in the order of the day
+const (
+	SlotBreakfast = "breakfast"
+	SlotLunch     = "lunch"
+	SlotDinner    = "dinner"
+)
+
+// MealSlots are the slots a meal can be planned in, in the order of the day
+var MealSlots = []string{SlotBreakfast, SlotLunch, SlotDinner}
+
+// DateLayout is how the dates of meals are written in the database and in URLs
+const DateLayout = "2006-01-02"
+
+// Meal is a recipe a user plans to cook on a date, for breakfast, lunch or dinner
+type Meal struct {
+	ID          int
+	UserID      int
+	RecipeID    int
+	RecipeTitle string
+	Date        time.Time // midnight UTC of the day
+	Slot        string
+	CreatedAt   time.Time
+}
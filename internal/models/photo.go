@@ -0,0 +1,9 @@
+package models
+
+// Photo is an image in the gallery of a recipe or of one of its directions
+type Photo struct {
+	ID       int
+	Image    string // the key of the image in the image store
+	Caption  string
+	Position int // photos are shown by position, lowest first
+}
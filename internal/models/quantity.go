@@ -0,0 +1,199 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Quantity is the amount of an ingredient as numbers, parsed from the text it was typed as by ParseQuantity.
+// A single amount has the same Min and Max, a range like 2-3 has its ends. The zero Quantity is no amount.
+type Quantity struct {
+	Min     float64
+	Max     float64
+	ToTaste bool
+}
+
+// IsZero reports if there is no amount, like for an ingredient without one
+func (q Quantity) IsZero() bool {
+	return q == Quantity{}
+}
+
+// IsRange reports if the amount is a range like 2-3
+func (q Quantity) IsRange() bool {
+	return q.Max > q.Min
+}
+
+// Scale multiplies the amount by factor, amounts to taste stay to taste
+func (q Quantity) Scale(factor float64) Quantity {
+	if q.ToTaste {
+		return q
+	}
+	return Quantity{Min: q.Min * factor, Max: q.Max * factor}
+}
+
+// String formats the amount the way a cook would write it, like 1½, ⅓-½ or to taste
+func (q Quantity) String() string {
+	switch {
+	case q.ToTaste:
+		return "to taste"
+	case q.IsZero():
+		return ""
+	case q.IsRange():
+		return FormatAmount(q.Min) + "-" + FormatAmount(q.Max)
+	}
+	return FormatAmount(q.Min)
+}
+
+// kitchenFractions are the fractions measuring cups and spoons come in, smallest first
+var kitchenFractions = []struct {
+	value float64
+	text  string
+}{
+	{1.0 / 8, "⅛"}, {1.0 / 4, "¼"}, {1.0 / 3, "⅓"}, {3.0 / 8, "⅜"}, {1.0 / 2, "½"},
+	{5.0 / 8, "⅝"}, {2.0 / 3, "⅔"}, {3.0 / 4, "¾"}, {7.0 / 8, "⅞"},
+}
+
+// fractionTolerance is how close an amount must be to a kitchen fraction to be shown as one, about half a teaspoon in a cup
+const fractionTolerance = 0.02
+
+// FormatAmount formats a number with a kitchen fraction when it is close to one, like 2½ for 2.5 or ⅓ for 0.333.
+// Other numbers are rounded to two decimals.
+func FormatAmount(n float64) string {
+	whole := math.Floor(n)
+	rest := n - whole
+	prefix := ""
+	if whole > 0 {
+		prefix = strconv.FormatFloat(whole, 'f', 0, 64)
+	}
+
+	switch {
+	case rest < fractionTolerance && whole > 0:
+		return prefix
+	case rest > 1-fractionTolerance:
+		return strconv.FormatFloat(whole+1, 'f', 0, 64)
+	}
+	for _, fraction := range kitchenFractions {
+		if math.Abs(rest-fraction.value) <= fractionTolerance {
+			return prefix + fraction.text
+		}
+	}
+	return strconv.FormatFloat(math.Round(n*100)/100, 'f', -1, 64)
+}
+
+// ErrInvalidQuantity is returned by ParseQuantity for text that isn't an amount
+var ErrInvalidQuantity = errors.New("invalid quantity")
+
+// unicodeFractions are the vulgar fraction characters, as in 1½
+var unicodeFractions = map[rune]float64{
+	'½': 1.0 / 2, '⅓': 1.0 / 3, '⅔': 2.0 / 3, '¼': 1.0 / 4, '¾': 3.0 / 4,
+	'⅕': 1.0 / 5, '⅖': 2.0 / 5, '⅗': 3.0 / 5, '⅘': 4.0 / 5, '⅙': 1.0 / 6, '⅚': 5.0 / 6,
+	'⅐': 1.0 / 7, '⅛': 1.0 / 8, '⅜': 3.0 / 8, '⅝': 5.0 / 8, '⅞': 7.0 / 8, '⅑': 1.0 / 9, '⅒': 1.0 / 10,
+}
+
+// rangeSeparators split the ends of a range, hyphens and dashes as in 2-3 or a word as in 2 to 3
+var rangeSeparators = []string{"-", "–", "—", " to "}
+
+var (
+	wholePattern    = regexp.MustCompile(`^\d+$`)
+	decimalPattern  = regexp.MustCompile(`^\d*\.\d+$`)
+	fractionPattern = regexp.MustCompile(`^(\d+)/(\d+)$`)
+	slashSpaces     = regexp.MustCompile(`\s*/\s*`)
+)
+
+// ParseQuantity parses the amount of an ingredient. It understands whole numbers, decimals, fractions,
+// mixed numbers like 1 1/2, unicode fractions like 1½, ranges like 2-3 or 2 to 3, and "to taste".
+// Blank text is no amount, text that is none of these is an ErrInvalidQuantity.
+func ParseQuantity(text string) (Quantity, error) {
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+	switch text {
+	case "":
+		return Quantity{}, nil
+	case "to taste":
+		return Quantity{ToTaste: true}, nil
+	}
+
+	for _, separator := range rangeSeparators {
+		low, high, found := strings.Cut(text, separator)
+		if !found {
+			continue
+		}
+		min, err := parseNumber(low)
+		if err != nil {
+			return Quantity{}, err
+		}
+		max, err := parseNumber(high)
+		if err != nil {
+			return Quantity{}, err
+		}
+		if max <= min {
+			return Quantity{}, fmt.Errorf("%w: the range %q must go up", ErrInvalidQuantity, text)
+		}
+		return Quantity{Min: min, Max: max}, nil
+	}
+
+	number, err := parseNumber(text)
+	if err != nil {
+		return Quantity{}, err
+	}
+	return Quantity{Min: number, Max: number}, nil
+}
+
+// parseNumber parses a whole number, a decimal, a fraction or a mixed number, with its fraction as a character or not
+func parseNumber(text string) (float64, error) {
+	text = strings.TrimSpace(slashSpaces.ReplaceAllString(strings.ReplaceAll(text, "⁄", "/"), "/"))
+
+	// A unicode fraction, after a whole number or not
+	last, size := utf8.DecodeLastRuneInString(text)
+	if fraction, ok := unicodeFractions[last]; ok {
+		whole := strings.TrimSpace(text[:len(text)-size])
+		if whole == "" {
+			return fraction, nil
+		}
+		if !wholePattern.MatchString(whole) {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidQuantity, text)
+		}
+		n, err := strconv.ParseFloat(whole, 64)
+		return n + fraction, err
+	}
+
+	fields := strings.Fields(text)
+	switch {
+	case len(fields) == 1 && (wholePattern.MatchString(text) || decimalPattern.MatchString(text)):
+		return strconv.ParseFloat(text, 64)
+	case len(fields) == 1:
+		return parseFraction(text)
+	case len(fields) == 2 && wholePattern.MatchString(fields[0]):
+		whole, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return 0, err
+		}
+		fraction, err := parseFraction(fields[1])
+		return whole + fraction, err
+	}
+	return 0, fmt.Errorf("%w: %q", ErrInvalidQuantity, text)
+}
+
+// parseFraction parses a fraction like 3/4
+func parseFraction(text string) (float64, error) {
+	matches := fractionPattern.FindStringSubmatch(text)
+	if matches == nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidQuantity, text)
+	}
+	numerator, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	denominator, err := strconv.ParseFloat(matches[2], 64)
+	if err != nil {
+		return 0, err
+	}
+	if denominator == 0 {
+		return 0, fmt.Errorf("%w: %q divides by zero", ErrInvalidQuantity, text)
+	}
+	return numerator / denominator, nil
+}
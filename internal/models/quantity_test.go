@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		text string
+		want Quantity
+	}{
+		{"", Quantity{}},
+		{"  ", Quantity{}},
+		{"2", Quantity{Min: 2, Max: 2}},
+		{"1.5", Quantity{Min: 1.5, Max: 1.5}},
+		{".5", Quantity{Min: 0.5, Max: 0.5}},
+		{"1/2", Quantity{Min: 0.5, Max: 0.5}},
+		{"3 / 4", Quantity{Min: 0.75, Max: 0.75}},
+		{"1 1/2", Quantity{Min: 1.5, Max: 1.5}},
+		{"1½", Quantity{Min: 1.5, Max: 1.5}},
+		{"1 ½", Quantity{Min: 1.5, Max: 1.5}},
+		{"⅓", Quantity{Min: 1.0 / 3, Max: 1.0 / 3}},
+		{"1⁄4", Quantity{Min: 0.25, Max: 0.25}},
+		{"2-3", Quantity{Min: 2, Max: 3}},
+		{"2 – 3", Quantity{Min: 2, Max: 3}},
+		{"1/2 to 1", Quantity{Min: 0.5, Max: 1}},
+		{"1½-2", Quantity{Min: 1.5, Max: 2}},
+		{"To  Taste", Quantity{ToTaste: true}},
+	}
+	for _, e := range tests {
+		got, err := ParseQuantity(e.text)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", e.text, err)
+			continue
+		}
+		if math.Abs(got.Min-e.want.Min) > 1e-9 || math.Abs(got.Max-e.want.Max) > 1e-9 || got.ToTaste != e.want.ToTaste {
+			t.Errorf("%q: expected %+v, got %+v", e.text, e.want, got)
+		}
+	}
+
+	for _, text := range []string{"a pinch", "-1", "1/0", "3-2", "2-", "1 1 1", "1.5 1/2", "½ 1", "1e3", "1,5", "2½½"} {
+		_, err := ParseQuantity(text)
+		if !errors.Is(err, ErrInvalidQuantity) {
+			t.Errorf("%q: expected an invalid quantity, got %v", text, err)
+		}
+	}
+}
+
+func TestQuantityIsRange(t *testing.T) {
+	if (Quantity{Min: 2, Max: 2}).IsRange() || !(Quantity{Min: 2, Max: 3}).IsRange() || (Quantity{ToTaste: true}).IsRange() {
+		t.Error("expected only 2-3 to be a range")
+	}
+	if !(Quantity{}).IsZero() || (Quantity{ToTaste: true}).IsZero() {
+		t.Error("expected only no amount to be zero")
+	}
+}
+
+func TestQuantityString(t *testing.T) {
+	tests := []struct {
+		quantity Quantity
+		want     string
+	}{
+		{Quantity{}, ""},
+		{Quantity{ToTaste: true}, "to taste"},
+		{Quantity{Min: 2, Max: 2}, "2"},
+		{Quantity{Min: 2.5, Max: 2.5}, "2½"},
+		{Quantity{Min: 0.333, Max: 0.333}, "⅓"},
+		{Quantity{Min: 0.75, Max: 0.75}, "¾"},
+		{Quantity{Min: 1.0 / 3, Max: 0.5}, "⅓-½"},
+		{Quantity{Min: 2.99, Max: 2.99}, "3"},
+		{Quantity{Min: 0.01, Max: 0.01}, "0.01"},
+		{Quantity{Min: 1.45, Max: 1.45}, "1.45"},
+		{Quantity{Min: 250, Max: 250}, "250"},
+	}
+	for _, e := range tests {
+		if got := e.quantity.String(); got != e.want {
+			t.Errorf("%+v: expected %q, got %q", e.quantity, e.want, got)
+		}
+	}
+
+	// Scaling 1 1/2 cups for 4 to 2 servings
+	half, err := ParseQuantity("1 1/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := half.Scale(0.5).String(); got != "¾" {
+		t.Errorf("expected ¾, got %q", got)
+	}
+	if got := (Quantity{ToTaste: true}).Scale(2); !got.ToTaste {
+		t.Errorf("expected to taste to stay to taste, got %+v", got)
+	}
+}
@@ -2,14 +2,49 @@ package models
 
 import "time"
 
+// Sort orders for a list of recipes
+const (
+	SortNewest  = "newest"
+	SortOldest  = "oldest"
+	SortUpdated = "updated"
+	SortTitle   = "title"
+)
+
+// RecipeSorts are the sort orders ListRecipes accepts, in the order the home page offers them
+var RecipeSorts = []string{SortNewest, SortOldest, SortUpdated, SortTitle}
+
 type Recipe struct {
 	ID          int
-	Image       string
+	Image       string // the key of the image in the image store, empty when there is none
 	Title       string
+	Servings    int // how many people the recipe serves, 0 when it isn't known
 	UserId      int
 	UpdatedAt   time.Time
 	CreatedAt   time.Time
 	Ingredients []Ingredient
 	Directions  []Direction
+	Photos      []Photo
 	User        User
 }
+
+// Scale returns a copy of the recipe with the quantities of its ingredients multiplied to serve servings,
+// and their amounts written with kitchen fractions. Free-text amounts that weren't parsed into a quantity are left
+// as they are, like every amount of a recipe without servings.
+func (r Recipe) Scale(servings int) Recipe {
+	if r.Servings <= 0 || servings <= 0 || servings == r.Servings {
+		return r
+	}
+
+	factor := float64(servings) / float64(r.Servings)
+	ingredients := make([]Ingredient, len(r.Ingredients))
+	for i, ingredient := range r.Ingredients {
+		if ingredient.Quantity.Max > 0 {
+			ingredient.Quantity = ingredient.Quantity.Scale(factor)
+			ingredient.Amount = ingredient.Quantity.String()
+		}
+		ingredients[i] = ingredient
+	}
+	r.Ingredients = ingredients
+	r.Servings = servings
+	return r
+}
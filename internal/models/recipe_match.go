@@ -0,0 +1,16 @@
+package models
+
+// RecipeMatch is a recipe found by the ingredients on hand, along with the ones that are missing
+type RecipeMatch struct {
+	Recipe  Recipe
+	Covered int
+	Missing []Ingredient
+}
+
+// Coverage is the percentage of the recipe's ingredients that are on hand
+func (m RecipeMatch) Coverage() int {
+	if len(m.Recipe.Ingredients) == 0 {
+		return 0
+	}
+	return m.Covered * 100 / len(m.Recipe.Ingredients)
+}
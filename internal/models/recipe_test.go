@@ -0,0 +1,35 @@
+package models
+
+import "testing"
+
+func TestRecipeScale(t *testing.T) {
+	recipe := Recipe{Servings: 4, Ingredients: []Ingredient{
+		{Name: "tomatoes", Amount: "3", Quantity: Quantity{Min: 3, Max: 3}},
+		{Name: "cream", Amount: "1 1/2", Quantity: Quantity{Min: 1.5, Max: 1.5}},
+		{Name: "stock", Amount: "2-3", Quantity: Quantity{Min: 2, Max: 3}},
+		{Name: "salt", Amount: "to taste", Quantity: Quantity{ToTaste: true}},
+		{Name: "basil", Amount: "a handful"},
+	}}
+
+	scaled := recipe.Scale(6)
+	var amounts []string
+	for _, ingredient := range scaled.Ingredients {
+		amounts = append(amounts, ingredient.Amount)
+	}
+	want := []string{"4½", "2¼", "3-4½", "to taste", "a handful"}
+	for i := range want {
+		if amounts[i] != want[i] {
+			t.Errorf("expected %q, got %q", want, amounts)
+			break
+		}
+	}
+	if scaled.Servings != 6 || recipe.Ingredients[0].Amount != "3" {
+		t.Errorf("expected a scaled copy, got %d servings and %q", scaled.Servings, recipe.Ingredients[0].Amount)
+	}
+
+	// Recipes without servings can't be scaled
+	recipe.Servings = 0
+	if recipe.Scale(6).Ingredients[0].Amount != "3" {
+		t.Error("expected a recipe without servings to be left as it is")
+	}
+}
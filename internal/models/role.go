@@ -1,5 +1,11 @@
 package models
 
+// Roles seeded by the migrations
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+)
+
 type Role struct {
 	ID   int
 	Role string
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// ShoppingList is a list of the ingredients of several recipes saved for a user, with its items in order
+type ShoppingList struct {
+	ID        int
+	UserID    int
+	Name      string
+	Items     []ShoppingListItem
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ShoppingListItem is an ingredient to buy, merged from every recipe on the list that needs it
+type ShoppingListItem struct {
+	ID       int
+	Name     string
+	Amount   string // the summed amount, formatted
+	Unit     string
+	Section  string // the store section it is found in
+	Checked  bool
+	Position int
+}
+
+// String is the item as it would be written on a list, like 2 cups flour
+func (i ShoppingListItem) String() string {
+	return strings.Join(strings.Fields(i.Amount+" "+i.Unit+" "+i.Name), " ")
+}
+
+// ShoppingListSection is the items of a list found in one store section
+type ShoppingListSection struct {
+	Name  string
+	Items []ShoppingListItem
+}
+
+// Sections groups the items by store section. Items are kept in order, so the sections are in the order of their first item.
+func (l ShoppingList) Sections() []ShoppingListSection {
+	var sections []ShoppingListSection
+	for _, item := range l.Items {
+		if len(sections) == 0 || sections[len(sections)-1].Name != item.Section {
+			sections = append(sections, ShoppingListSection{Name: item.Section})
+		}
+		last := &sections[len(sections)-1]
+		last.Items = append(last.Items, item)
+	}
+	return sections
+}
@@ -8,8 +8,15 @@ type User struct {
 	Name      string
 	Email     string
 	Password  string
+	Disabled  bool
 	Roles     map[string]Role
 	Recipes   []Recipe
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
+
+// HasRole checks if the user has been given role
+func (u User) HasRole(role string) bool {
+	_, ok := u.Roles[role]
+	return ok
+}
@@ -0,0 +1,145 @@
+package openapi
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSchemaFromModels(t *testing.T) {
+	doc := Spec()
+
+	// Embedded structs are flattened like encoding/json does
+	details := doc.Components.Schemas["JsonRecipeDetails"]
+	for _, name := range []string{"id", "title", "ingredients", "directions", "image", "author", "created_at", "updated_at"} {
+		if details.Properties[name] == nil {
+			t.Errorf("expected JsonRecipeDetails to have %s", name)
+		}
+	}
+	if details.Properties["author"].Ref != "#/components/schemas/JsonAuthor" {
+		t.Errorf("expected author to reference JsonAuthor, got %+v", details.Properties["author"])
+	}
+
+	// omitempty fields are optional and pointers nullable
+	update := doc.Components.Schemas["JsonRecipeUpdate"]
+	if slices.Contains(update.Required, "updated_at") || !update.Properties["updated_at"].Nullable {
+		t.Errorf("expected updated_at to be optional and nullable, got %+v", update)
+	}
+	if update.Properties["updated_at"].Format != "date-time" {
+		t.Errorf("expected updated_at to be a date-time, got %+v", update.Properties["updated_at"])
+	}
+
+	// Fields only set in responses are read-only
+	for name, fields := range map[string][]string{
+		"JsonRecipe":     {"id"},
+		"JsonIngredient": {"id", "position"},
+		"JsonDirection":  {"id", "position"},
+		"JsonPhoto":      {"url"},
+	} {
+		for _, field := range fields {
+			if !doc.Components.Schemas[name].Properties[field].ReadOnly {
+				t.Errorf("expected %s.%s to be read-only", name, field)
+			}
+		}
+	}
+	if doc.Components.Schemas["JsonRecipe"].Properties["title"].ReadOnly {
+		t.Error("expected JsonRecipe.title to be writable")
+	}
+
+	jsonError := doc.Components.Schemas["JsonError"]
+	fields := jsonError.Properties["fields"]
+	if fields.Type != "object" || fields.AdditionalProperties.(*Schema).Items.Type != "string" {
+		t.Errorf("expected fields to be a map of string arrays, got %+v", fields)
+	}
+
+	// Every operation answers with schemas that exist
+	b, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range strings.Split(string(b), `"$ref":"#/components/schemas/`)[1:] {
+		name, _, _ := strings.Cut(ref, `"`)
+		if doc.Components.Schemas[name] == nil {
+			t.Errorf("missing schema %s", name)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	doc := Spec()
+	schema := doc.Components.Schemas["JsonRecipeList"]
+
+	var tests = []struct {
+		name string
+		body string
+		want string
+	}{
+		{"valid", `{"recipes": [{"id": 1, "title": "Soup", "author": {"id": 2, "name": "Julia"},
+			"created_at": "2024-04-01T10:00:00Z", "updated_at": "2024-04-01T10:00:00.5+02:00"}], "page": 1, "limit": 20, "total": 1}`, ""},
+		{"null array", `{"recipes": null, "page": 1, "limit": 20, "total": 0}`, "$.recipes: expected array, got null"},
+		{"missing property", `{"recipes": [], "page": 1, "limit": 20}`, "$: missing required property total"},
+		{"unexpected property", `{"recipes": [], "page": 1, "limit": 20, "total": 0, "pages": 0}`, "$: unexpected property pages"},
+		{"wrong type", `{"recipes": [{"id": "1", "title": "Soup", "author": {"id": 2, "name": "Julia"},
+			"created_at": "2024-04-01T10:00:00Z", "updated_at": "2024-04-01T10:00:00Z"}], "page": 1, "limit": 20, "total": 1}`,
+			"$.recipes[0].id: expected integer, got string"},
+		{"not an integer", `{"recipes": [], "page": 1.5, "limit": 20, "total": 0}`, "$.page: expected integer, got 1.5"},
+		{"date-time", `{"recipes": [{"id": 1, "title": "Soup", "author": {"id": 2, "name": "Julia"},
+			"created_at": "yesterday", "updated_at": "2024-04-01T10:00:00Z"}], "page": 1, "limit": 20, "total": 1}`,
+			`$.recipes[0].created_at: expected a date-time, got "yesterday"`},
+	}
+	for _, e := range tests {
+		t.Run(e.name, func(t *testing.T) {
+			var value interface{}
+			err := json.Unmarshal([]byte(e.body), &value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = doc.Validate(schema, value)
+			if e.want == "" && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if e.want != "" && (err == nil || err.Error() != e.want) {
+				t.Errorf("expected %q, got %v", e.want, err)
+			}
+		})
+	}
+
+	// Maps are checked against the schema of their values
+	var value interface{}
+	_ = json.Unmarshal([]byte(`{"error": "Invalid recipe", "fields": {"title": ["This field cannot be empty"], "image": "too big"}}`), &value)
+	err := doc.Validate(doc.Components.Schemas["JsonError"], value)
+	if err == nil || err.Error() != "$.fields.image: expected array, got string" {
+		t.Errorf("expected the image error to be rejected, got %v", err)
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	doc := Spec()
+	var tests = []struct {
+		path string
+		want string
+	}{
+		{"/api/v1/recipes", "/api/v1/recipes"},
+		{"/api/v1/recipes/12", "/api/v1/recipes/{id}"},
+		{"/recipe/edit/3", "/recipe/edit/{id}"},
+		{"/api/v1/recipes/12/photos", ""},
+	}
+	for _, e := range tests {
+		got, _ := doc.MatchPath(e.path)
+		if got != e.want {
+			t.Errorf("%s: expected %q, got %q", e.path, e.want, got)
+		}
+	}
+
+	op, ok := doc.Operation("PUT", "/api/v1/recipes/{id}")
+	if !ok {
+		t.Fatal("expected the update operation")
+	}
+	if _, ok := op.ResponseSchema(409); !ok {
+		t.Error("expected updates to document conflicts")
+	}
+	if schema, ok := op.ResponseSchema(200); !ok || schema.Ref != "#/components/schemas/JsonRecipeDetails" {
+		t.Errorf("expected updates to answer with the recipe, got %+v", schema)
+	}
+}
@@ -0,0 +1,107 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is an OpenAPI 3.0 schema object, limited to what the JSON models use
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Nullable    bool               `json:"nullable,omitempty"`
+	ReadOnly    bool               `json:"readOnly,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Minimum     *int               `json:"minimum,omitempty"`
+	Maximum     *int               `json:"maximum,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+
+	// AdditionalProperties is false for the JSON models, so a field that isn't in the schema is an error,
+	// or the schema of the values of a map
+	AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemas generates schemas from Go types, named structs become components referenced by name
+type schemas struct {
+	components map[string]*Schema
+}
+
+// ref returns the schema of the type of v
+func (s *schemas) ref(v interface{}) *Schema {
+	return s.schema(reflect.TypeOf(v))
+}
+
+// schema returns the schema of t, following the encoding/json rules for struct tags and embedded structs
+func (s *schemas) schema(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Pointer:
+		schema := *s.schema(t.Elem())
+		schema.Nullable = true
+		return &schema
+	case t.Kind() == reflect.Struct:
+		name := t.Name()
+		if _, ok := s.components[name]; !ok {
+			// Reserve the name first, in case the struct refers to itself
+			s.components[name] = &Schema{}
+			*s.components[name] = *s.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	case t.Kind() == reflect.Slice:
+		return &Schema{Type: "array", Items: s.schema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schema(t.Elem())}
+	case t.Kind() == reflect.String:
+		return &Schema{Type: "string"}
+	case t.Kind() == reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &Schema{Type: "number"}
+	}
+	panic("openapi: no schema for " + t.String())
+}
+
+// object returns the schema of a struct. Fields tagged omitempty are optional, the others are required.
+// Fields tagged openapi:"readonly" are only set in responses, they are required there and ignored in requests.
+func (s *schemas) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema), AdditionalProperties: false}
+	s.addFields(schema, t)
+	return schema
+}
+
+// addFields adds the fields of struct t to schema, the fields of embedded structs are added as if they were t's own
+func (s *schemas) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			s.addFields(schema, field.Type)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = s.schema(field.Type)
+		if field.Tag.Get("openapi") == "readonly" {
+			schema.Properties[name].ReadOnly = true
+		}
+		if !strings.Contains(","+options+",", ",omitempty,") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
@@ -0,0 +1,474 @@
+package openapi
+
+import (
+	"fmt"
+	"github.com/popnfresh234/recipe-app-golang/internal/images"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"github.com/popnfresh234/recipe-app-golang/internal/units"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Document is an OpenAPI 3.0 document
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of a path keyed by lowercase HTTP method
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Tags        []string              `json:"tags,omitempty"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+}
+
+// Security requirements of the operations, the page endpoints take either the session and its CSRF token or an API token
+var (
+	bearerAuth  = []map[string][]string{{"bearerAuth": {}}}
+	sessionAuth = []map[string][]string{{"sessionCookie": {}, "csrfToken": {}}, {"bearerAuth": {}}}
+)
+
+// builder adds operations to a document
+type builder struct {
+	doc     *Document
+	schemas *schemas
+}
+
+// Spec builds the OpenAPI document of the JSON API and of the JSON endpoints the page scripts use.
+// The schemas are generated from the models in json_models.go, so they can't drift apart.
+func Spec() *Document {
+	s := &schemas{components: make(map[string]*Schema)}
+	b := builder{
+		schemas: s,
+		doc: &Document{
+			OpenAPI: "3.0.3",
+			Info: Info{
+				Title:   "Recipes API",
+				Version: "1.0.0",
+				Description: "The /api/v1 endpoints authenticate with an API token in an Authorization: Bearer header. " +
+					"The /recipe endpoints are used by the page scripts and authenticate with the session cookie and a CSRF token, " +
+					"or with an API token like the /api/v1 endpoints.",
+			},
+			Paths: make(map[string]*PathItem),
+			Components: Components{
+				Schemas: s.components,
+				SecuritySchemes: map[string]*SecurityScheme{
+					"bearerAuth": {
+						Type:        "http",
+						Scheme:      "bearer",
+						Description: "An API token from POST /api/v1/tokens or the settings page",
+					},
+					"sessionCookie": {
+						Type: "apiKey", In: "cookie", Name: "session",
+						Description: "The session cookie set when logging in",
+					},
+					"csrfToken": {
+						Type: "apiKey", In: "header", Name: "X-CSRF-Token",
+						Description: "The CSRF token of the session, from the csrf-token meta tag of any page",
+					},
+				},
+			},
+		},
+	}
+
+	b.add(http.MethodGet, "/api/openapi.json", &Operation{
+		OperationID: "getOpenApi",
+		Summary:     "This document",
+		Tags:        []string{"meta"},
+		Responses: map[string]*Response{
+			"200": {Description: "The OpenAPI document", Content: jsonContent(&Schema{Type: "object"})},
+		},
+	})
+
+	b.add(http.MethodPost, "/api/v1/tokens", &Operation{
+		OperationID: "createToken",
+		Summary:     "Exchange an email and password for an API token",
+		Tags:        []string{"auth"},
+		RequestBody: b.body(models.JsonTokenRequest{}),
+		Responses: b.withBodyErrors(map[string]*Response{
+			"201": b.response("The new token, it is only shown this once", models.JsonToken{}),
+			"400": b.errorResponse("The body is not valid JSON or a field is missing"),
+			"401": b.errorResponse("The email or password is incorrect"),
+			"403": b.errorResponse("The account has been disabled"),
+		}),
+	})
+
+	b.add(http.MethodGet, "/api/v1/user", &Operation{
+		OperationID: "getCurrentUser",
+		Summary:     "The user the API token belongs to",
+		Tags:        []string{"users"},
+		Security:    bearerAuth,
+		Responses: b.withAuthErrors(map[string]*Response{
+			"200": b.response("The user", models.JsonUser{}),
+		}),
+	})
+
+	limit := &Schema{Type: "integer", Minimum: intPtr(1), Maximum: intPtr(models.JsonRecipeListMaxLimit)}
+	b.add(http.MethodGet, "/api/v1/recipes", &Operation{
+		OperationID: "listRecipes",
+		Summary:     "A page of recipes",
+		Tags:        []string{"recipes"},
+		Parameters: []Parameter{
+			{Name: "page", In: "query", Description: "The page, starting at 1", Schema: &Schema{Type: "integer", Minimum: intPtr(1)}},
+			{Name: "limit", In: "query", Description: fmt.Sprintf("Recipes per page, %d by default", models.JsonRecipeListDefaultLimit), Schema: limit},
+			{Name: "sort", In: "query", Description: "The order of the recipes, newest first by default", Schema: &Schema{Type: "string", Enum: models.RecipeSorts}},
+		},
+		Responses: map[string]*Response{
+			"200": b.response("The recipes", models.JsonRecipeList{}),
+			"400": b.errorResponse("A query parameter is invalid, the fields of the error are the parameters"),
+		},
+	})
+
+	b.add(http.MethodPost, "/api/v1/recipes", &Operation{
+		OperationID: "createRecipe",
+		Summary:     "Create a recipe",
+		Tags:        []string{"recipes"},
+		Security:    bearerAuth,
+		RequestBody: b.body(models.JsonRecipe{}),
+		Responses: b.withBodyErrors(b.withAuthErrors(map[string]*Response{
+			"201": {
+				Description: "The new recipe",
+				Headers:     map[string]Header{"Location": {Description: "The URL of the new recipe", Schema: &Schema{Type: "string"}}},
+				Content:     jsonContent(b.schemas.ref(models.JsonRecipeDetails{})),
+			},
+			"400": b.errorResponse("The body is not valid JSON or the recipe is invalid, the fields of the error are paths like ingredients[2].amount"),
+		})),
+	})
+
+	recipeID := []Parameter{{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "integer"}}}
+	b.add(http.MethodGet, "/api/v1/recipes/{id}", &Operation{
+		OperationID: "getRecipe",
+		Summary:     "A recipe with its ingredients and directions",
+		Tags:        []string{"recipes"},
+		Parameters: append(slices.Clone(recipeID), Parameter{
+			Name: "units", In: "query", Description: "Convert the ingredients to metric or US customary units, as written by default",
+			Schema: &Schema{Type: "string", Enum: []string{string(units.Metric), string(units.Imperial)}},
+		}),
+		Responses: map[string]*Response{
+			"200": b.response("The recipe", models.JsonRecipeDetails{}),
+			"400": b.errorResponse("The units query parameter is invalid"),
+			"404": b.errorResponse("There is no such recipe"),
+		},
+	})
+
+	b.add(http.MethodPut, "/api/v1/recipes/{id}", &Operation{
+		OperationID: "updateRecipe",
+		Summary:     "Replace a recipe, only its author or an admin may",
+		Tags:        []string{"recipes"},
+		Security:    bearerAuth,
+		Parameters:  recipeID,
+		RequestBody: b.body(models.JsonRecipeUpdate{}),
+		Responses: b.withBodyErrors(b.withAuthErrors(map[string]*Response{
+			"200": b.response("The saved recipe", models.JsonRecipeDetails{}),
+			"400": b.errorResponse("The body is not valid JSON, the recipe is invalid or its id is not the one in the URL"),
+			"404": b.errorResponse("There is no such recipe"),
+			"409": b.errorResponse("The recipe has changed since the updated_at in the body"),
+		})),
+	})
+
+	b.add(http.MethodPut, "/api/v1/recipes/{id}/order", &Operation{
+		OperationID: "reorderRecipe",
+		Summary:     "Move the ingredients and directions of a recipe without replacing it, only its author or an admin may",
+		Tags:        []string{"recipes"},
+		Security:    bearerAuth,
+		Parameters:  recipeID,
+		RequestBody: b.body(models.JsonRecipeOrder{}),
+		Responses: b.withBodyErrors(b.withAuthErrors(map[string]*Response{
+			"200": b.response("The reordered recipe", models.JsonRecipeDetails{}),
+			"400": b.errorResponse("The body is not valid JSON or a list doesn't hold the id of every ingredient or direction of the recipe once"),
+			"404": b.errorResponse("There is no such recipe"),
+		})),
+	})
+
+	b.add(http.MethodDelete, "/api/v1/recipes/{id}", &Operation{
+		OperationID: "deleteRecipe",
+		Summary:     "Delete a recipe, only its author or an admin may",
+		Tags:        []string{"recipes"},
+		Security:    bearerAuth,
+		Parameters:  recipeID,
+		Responses: b.withAuthErrors(map[string]*Response{
+			"204": {Description: "The recipe was deleted"},
+			"404": b.errorResponse("There is no such recipe"),
+		}),
+	})
+
+	imageContent := map[string]MediaType{}
+	for _, contentType := range images.Types {
+		imageContent[contentType] = MediaType{Schema: &Schema{Type: "string", Format: "binary"}}
+	}
+	b.add(http.MethodGet, "/images/{key}", &Operation{
+		OperationID: "getImage",
+		Summary:     "A recipe image, served at the image_url of the recipe",
+		Tags:        []string{"images"},
+		Parameters: []Parameter{{Name: "key", In: "path", Required: true, Schema: &Schema{Type: "string"},
+			Description: "The key of an image, or of a resized copy with its width before the extension like <key>-400.jpg"}},
+		Responses: map[string]*Response{
+			"200": {
+				Description: "The image, what a key points to never changes so it may be cached for good",
+				Headers:     map[string]Header{"ETag": {Schema: &Schema{Type: "string"}}, "Cache-Control": {Schema: &Schema{Type: "string"}}},
+				Content:     imageContent,
+			},
+			"304": {Description: "The image in the If-None-Match header hasn't changed"},
+			"404": {Description: "There is no such image", Content: map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}}},
+		},
+	})
+
+	b.add(http.MethodPost, "/api/v1/images", &Operation{
+		OperationID: "uploadImage",
+		Summary:     "Upload an image for the image field of a recipe, it is resized and its metadata is removed",
+		Tags:        []string{"images"},
+		Security:    bearerAuth,
+		RequestBody: imageUpload(),
+		Responses:   b.withAuthErrors(b.imageUploadResponses()),
+	})
+
+	b.add(http.MethodPost, "/recipe/images", &Operation{
+		OperationID: "pageUploadImage",
+		Summary:     "Upload an image from the new recipe and edit pages",
+		Tags:        []string{"pages"},
+		Security:    sessionAuth,
+		RequestBody: imageUpload(),
+		Responses:   b.withPageAuthErrors(b.imageUploadResponses()),
+	})
+
+	b.add(http.MethodPost, "/recipe/new", &Operation{
+		OperationID: "pageCreateRecipe",
+		Summary:     "Create a recipe from the new recipe page",
+		Tags:        []string{"pages"},
+		Security:    sessionAuth,
+		RequestBody: b.body(models.JsonRecipe{}),
+		Responses:   b.withRecipeErrors(b.pageResponses()),
+	})
+
+	b.add(http.MethodPost, "/recipe/edit/{id}", &Operation{
+		OperationID: "pageUpdateRecipe",
+		Summary:     "Save a recipe from the edit page, only its author or an admin may",
+		Tags:        []string{"pages"},
+		Security:    sessionAuth,
+		Parameters:  recipeID,
+		RequestBody: b.body(models.JsonRecipe{}),
+		Responses:   b.withRecipeErrors(b.pageResponses()),
+	})
+
+	b.add(http.MethodPost, "/recipe/delete/{id}", &Operation{
+		OperationID: "pageDeleteRecipe",
+		Summary:     "Delete a recipe from the edit page, only its author or an admin may",
+		Tags:        []string{"pages"},
+		Security:    sessionAuth,
+		Parameters:  recipeID,
+		Responses:   b.pageResponses(),
+	})
+
+	return b.doc
+}
+
+// Operation finds the operation of a method and path template like /api/v1/recipes/{id}
+func (doc *Document) Operation(method, path string) (*Operation, bool) {
+	item, ok := doc.Paths[path]
+	if !ok {
+		return nil, false
+	}
+	op, ok := (*item)[strings.ToLower(method)]
+	return op, ok
+}
+
+// MatchPath finds the path template a request path like /api/v1/recipes/12 belongs to
+func (doc *Document) MatchPath(path string) (string, bool) {
+	if _, ok := doc.Paths[path]; ok {
+		return path, true
+	}
+	requestParts := strings.Split(path, "/")
+	for template := range doc.Paths {
+		parts := strings.Split(template, "/")
+		if len(parts) != len(requestParts) {
+			continue
+		}
+		match := true
+		for i, part := range parts {
+			if part != requestParts[i] && !(strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}")) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return template, true
+		}
+	}
+	return "", false
+}
+
+// ResponseSchema finds the JSON schema of a response, ok is false when the status isn't documented
+// and schema is nil when the response has no body
+func (op *Operation) ResponseSchema(status int) (schema *Schema, ok bool) {
+	response, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		return nil, false
+	}
+	return response.Content["application/json"].Schema, true
+}
+
+// add adds an operation to the document
+func (b builder) add(method, path string, op *Operation) {
+	item, ok := b.doc.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		b.doc.Paths[path] = item
+	}
+	(*item)[strings.ToLower(method)] = op
+}
+
+// body is a required JSON request body shaped like v
+func (b builder) body(v interface{}) *RequestBody {
+	return &RequestBody{Required: true, Content: jsonContent(b.schemas.ref(v))}
+}
+
+// response is a JSON response shaped like v
+func (b builder) response(description string, v interface{}) *Response {
+	return &Response{Description: description, Content: jsonContent(b.schemas.ref(v))}
+}
+
+// errorResponse is a JSON error response
+func (b builder) errorResponse(description string) *Response {
+	return b.response(description, models.JsonError{})
+}
+
+// withAuthErrors adds the responses of a missing or invalid API token and of a user who may not do that
+func (b builder) withAuthErrors(responses map[string]*Response) map[string]*Response {
+	responses["401"] = b.errorResponse("The API token is missing or invalid")
+	responses["403"] = b.errorResponse("The account has been disabled, or the user may not change the recipe")
+	return responses
+}
+
+// withBodyErrors adds the response of a body that is too large
+func (b builder) withBodyErrors(responses map[string]*Response) map[string]*Response {
+	responses["413"] = b.errorResponse("The body is too large")
+	return responses
+}
+
+// withPageAuthErrors adds the plain text responses of a page endpoint the user isn't logged in for or has no CSRF token for
+func (b builder) withPageAuthErrors(responses map[string]*Response) map[string]*Response {
+	page := b.pageResponses()
+	responses["401"] = page["401"]
+	responses["403"] = &Response{Description: "The CSRF token is missing or invalid", Content: page["403"].Content}
+	return responses
+}
+
+// imageUpload is a multipart request body with an image file in its image field
+func imageUpload() *RequestBody {
+	return &RequestBody{Required: true, Content: map[string]MediaType{
+		"multipart/form-data": {Schema: &Schema{
+			Type:       "object",
+			Properties: map[string]*Schema{"image": {Type: "string", Format: "binary"}},
+			Required:   []string{"image"},
+		}},
+	}}
+}
+
+// imageUploadResponses are the responses of the endpoints images are uploaded to
+func (b builder) imageUploadResponses() map[string]*Response {
+	return map[string]*Response{
+		"201": {
+			Description: "The stored image, its id goes in the image field of a recipe",
+			Headers:     map[string]Header{"Location": {Description: "The URL of the image", Schema: &Schema{Type: "string"}}},
+			Content:     jsonContent(b.schemas.ref(models.JsonImage{})),
+		},
+		"400": b.errorResponse("The body is not multipart, has no image field or the image could not be decoded"),
+		"413": b.errorResponse(fmt.Sprintf("The image is larger than %d MB", images.MaxUploadBytes>>20)),
+		"415": b.errorResponse("The image is not a PNG, JPEG or WebP"),
+		"429": b.errorResponse(fmt.Sprintf("The user uploaded %d images in the last day", images.UploadsPerDay)),
+	}
+}
+
+// withRecipeErrors adds the JSON errors of a page endpoint that saves a posted recipe
+func (b builder) withRecipeErrors(responses map[string]*Response) map[string]*Response {
+	responses["400"] = &Response{
+		Description: "The recipe id is invalid, or in JSON, the body is not valid JSON or the recipe is invalid. The fields of the error are paths like ingredients[2].amount",
+		Content: map[string]MediaType{
+			"text/plain":       responses["400"].Content["text/plain"],
+			"application/json": {Schema: b.schemas.ref(models.JsonError{})},
+		},
+	}
+	return b.withBodyErrors(responses)
+}
+
+// pageResponses are the responses of the endpoints the page scripts use, which redirect the page and answer errors in plain text
+func (b builder) pageResponses() map[string]*Response {
+	text := map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}}
+	return map[string]*Response{
+		"303": {
+			Description: "Saved, the page follows the redirect to the home page",
+			Headers:     map[string]Header{"Location": {Schema: &Schema{Type: "string"}}},
+		},
+		"400": {Description: "The recipe id is invalid", Content: text},
+		"401": {Description: "The user is not logged in, or the API token is invalid", Content: text},
+		"403": {Description: "The CSRF token is missing or invalid, or the user may not change the recipe", Content: text},
+		"404": {Description: "There is no such recipe", Content: text},
+		"500": {Description: "Saving failed"},
+	}
+}
+
+// jsonContent is JSON content shaped like schema
+func jsonContent(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
@@ -0,0 +1,119 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Validate checks a decoded JSON value, as json.Unmarshal into an interface{} produces it, against schema.
+// The errors name the path of each value that doesn't match, like $.recipes[0].author.id.
+func (doc *Document) Validate(schema *Schema, value interface{}) error {
+	var errs []error
+	doc.validate(schema, value, "$", &errs)
+	return errors.Join(errs...)
+}
+
+func (doc *Document) validate(schema *Schema, value interface{}, path string, errs *[]error) {
+	if schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+		resolved, ok := doc.Components.Schemas[name]
+		if !ok {
+			*errs = append(*errs, fmt.Errorf("%s: unknown schema %s", path, schema.Ref))
+			return
+		}
+		schema = resolved
+	}
+
+	if value == nil {
+		if !schema.Nullable {
+			*errs = append(*errs, fmt.Errorf("%s: expected %s, got null", path, schema.Type))
+		}
+		return
+	}
+
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, fmt.Errorf("%s: "+format, append([]interface{}{path}, args...)...))
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			fail("expected object, got %T", value)
+			return
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				fail("missing required property %s", name)
+			}
+		}
+		// Sorted so the errors come out in the same order every time
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := schema.Properties[name]; ok {
+				doc.validate(property, object[name], path+"."+name, errs)
+				continue
+			}
+			switch additional := schema.AdditionalProperties.(type) {
+			case *Schema:
+				doc.validate(additional, object[name], path+"."+name, errs)
+			case bool:
+				if !additional {
+					fail("unexpected property %s", name)
+				}
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			fail("expected array, got %T", value)
+			return
+		}
+		for i, item := range array {
+			doc.validate(schema.Items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			fail("expected string, got %T", value)
+			return
+		}
+		if schema.Format == "date-time" {
+			_, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				fail("expected a date-time, got %q", s)
+			}
+		}
+		if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, s) {
+			fail("expected one of %s, got %q", strings.Join(schema.Enum, ", "), s)
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok {
+			fail("expected %s, got %T", schema.Type, value)
+			return
+		}
+		if schema.Type == "integer" && n != math.Trunc(n) {
+			fail("expected integer, got %v", n)
+		}
+		if schema.Minimum != nil && n < float64(*schema.Minimum) {
+			fail("expected at least %d, got %v", *schema.Minimum, n)
+		}
+		if schema.Maximum != nil && n > float64(*schema.Maximum) {
+			fail("expected at most %d, got %v", *schema.Maximum, n)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("expected boolean, got %T", value)
+		}
+	}
+}
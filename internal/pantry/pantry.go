@@ -0,0 +1,213 @@
+package pantry
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// synonyms lists names that mean the same ingredient, the first name of each group is the one they normalize to
+var synonyms = [][]string{
+	{"scallion", "green onion", "spring onion"},
+	{"cilantro", "coriander leaf", "fresh coriander"},
+	{"chickpea", "garbanzo bean", "garbanzo"},
+	{"bell pepper", "capsicum", "sweet pepper"},
+	{"zucchini", "courgette"},
+	{"eggplant", "aubergine"},
+	{"powdered sugar", "icing sugar", "confectioner sugar"},
+	{"ground beef", "minced beef", "beef mince"},
+	{"shrimp", "prawn"},
+	{"cornstarch", "corn starch", "cornflour"},
+	{"arugula", "rocket"},
+	{"heavy cream", "double cream", "whipping cream"},
+}
+
+// irregular plurals that the suffix rules in singular get wrong
+var irregular = map[string]string{
+	"leaves":   "leaf",
+	"loaves":   "loaf",
+	"halves":   "half",
+	"molasses": "molasses",
+	"couscous": "couscous",
+	"hummus":   "hummus",
+}
+
+// replacement replaces a normalized synonym with the normalized first name of its group
+type replacement struct {
+	synonym   string
+	canonical string
+}
+
+// replacements are every synonym, longest first so "garbanzo bean" is replaced before "garbanzo"
+var replacements = func() []replacement {
+	var r []replacement
+	for _, group := range synonyms {
+		canonical := strings.Join(words(group[0]), " ")
+		for _, name := range group[1:] {
+			r = append(r, replacement{synonym: strings.Join(words(name), " "), canonical: canonical})
+		}
+	}
+	sort.SliceStable(r, func(i, j int) bool {
+		return len(r[i].synonym) > len(r[j].synonym)
+	})
+	return r
+}()
+
+// Pantry is a list of ingredients on hand
+type Pantry struct {
+	items []string
+	// normalized holds the words of each item after Normalize
+	normalized [][]string
+}
+
+// New creates a pantry from a list of ingredients separated by commas, semicolons or new lines
+func New(list string) Pantry {
+	var p Pantry
+	seen := make(map[string]bool)
+	for _, item := range strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ';' || r == '\n'
+	}) {
+		item = strings.TrimSpace(item)
+		normalized := Normalize(item)
+		if normalized == "" || seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+		p.items = append(p.items, item)
+		p.normalized = append(p.normalized, strings.Fields(normalized))
+	}
+	return p
+}
+
+// Items are the ingredients in the pantry, as they were entered
+func (p Pantry) Items() []string {
+	return p.items
+}
+
+// Has checks if an ingredient is covered by the pantry. It is when the words of a pantry item
+// appear in order in the ingredient name, so "chicken" covers "Chicken Thighs" and "green onions" covers "scallion".
+func (p Pantry) Has(ingredient string) bool {
+	name := strings.Fields(Normalize(ingredient))
+	for _, item := range p.normalized {
+		if containsWords(name, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchPatterns are lowercase fragments that any ingredient name covered by the pantry contains,
+// for narrowing down the candidates in SQL before calling Has
+func (p Pantry) SearchPatterns() []string {
+	var patterns []string
+	seen := make(map[string]bool)
+	for _, item := range p.normalized {
+		canonical := strings.Join(item, " ")
+		forms := []string{canonical}
+		for _, r := range replacements {
+			if r.canonical == canonical {
+				forms = append(forms, r.synonym)
+			}
+		}
+		for _, form := range forms {
+			pattern := stem(longest(strings.Fields(form)))
+			if pattern != "" && !seen[pattern] {
+				seen[pattern] = true
+				patterns = append(patterns, pattern)
+			}
+		}
+	}
+	return patterns
+}
+
+// Normalize lowercases an ingredient name, drops punctuation, makes each word singular
+// and replaces synonyms, so names of the same ingredient normalize to the same string
+func Normalize(name string) string {
+	normalized := " " + strings.Join(words(name), " ") + " "
+	for _, r := range replacements {
+		normalized = strings.ReplaceAll(normalized, " "+r.synonym+" ", " "+r.canonical+" ")
+	}
+	return strings.TrimSpace(normalized)
+}
+
+// words splits a name into singular lowercase words
+func words(name string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for i, field := range fields {
+		fields[i] = singular(field)
+	}
+	return fields
+}
+
+// singular makes an English plural singular, good enough for ingredient names
+func singular(word string) string {
+	if s, ok := irregular[word]; ok {
+		return s
+	}
+	switch {
+	case len(word) <= 3:
+		return word
+	case strings.HasSuffix(word, "ies"):
+		return strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "oes"), strings.HasSuffix(word, "ches"), strings.HasSuffix(word, "shes"),
+		strings.HasSuffix(word, "xes"), strings.HasSuffix(word, "sses"):
+		return strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"), strings.HasSuffix(word, "is"):
+		return word
+	case strings.HasSuffix(word, "s"):
+		return strings.TrimSuffix(word, "s")
+	}
+	return word
+}
+
+// stem cuts a singular word down to the part its plural shares, berry and berries both contain "berr"
+func stem(word string) string {
+	for plural, s := range irregular {
+		if s == word && plural != word {
+			return commonPrefix(plural, word)
+		}
+	}
+	return strings.TrimSuffix(word, "y")
+}
+
+// commonPrefix is the longest prefix of both a and b
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
+
+// longest is the longest of words
+func longest(words []string) string {
+	var l string
+	for _, word := range words {
+		if len(word) > len(l) {
+			l = word
+		}
+	}
+	return l
+}
+
+// containsWords checks if want appears as consecutive words in name
+func containsWords(name, want []string) bool {
+	if len(want) == 0 {
+		return false
+	}
+	for i := 0; i+len(want) <= len(name); i++ {
+		match := true
+		for j := range want {
+			if name[i+j] != want[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package pantry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Tomatoes", "tomato"},
+		{"Fresh Blueberries!", "fresh blueberry"},
+		{"peaches", "peach"},
+		{"Bay leaves", "bay leaf"},
+		{"molasses", "molasses"},
+		{"couscous", "couscous"},
+		{"Green Onions", "scallion"},
+		{"garbanzo beans, drained", "chickpea drained"},
+		{"Confectioners' sugar", "powdered sugar"},
+		{"  ", ""},
+	}
+	for _, e := range tests {
+		if got := Normalize(e.name); got != e.want {
+			t.Errorf("Normalize(%q): expected %q, got %q", e.name, e.want, got)
+		}
+	}
+}
+
+func TestPantryHas(t *testing.T) {
+	p := New("Chicken, rice;\ngarlic cloves, spring onions, chickpeas, , rice")
+	if strings.Join(p.Items(), "|") != "Chicken|rice|garlic cloves|spring onions|chickpeas" {
+		t.Errorf("unexpected items %q", p.Items())
+	}
+
+	tests := []struct {
+		ingredient string
+		want       bool
+	}{
+		{"chicken thighs", true},
+		{"Boneless CHICKEN breasts", true},
+		{"brown rice", true},
+		{"rice vinegar", true},
+		{"3 garlic cloves, minced", true},
+		{"garlic", false},
+		{"scallions", true},
+		{"garbanzo beans", true},
+		{"chickenpox", false},
+		{"licorice", false},
+		{"beef", false},
+	}
+	for _, e := range tests {
+		if got := p.Has(e.ingredient); got != e.want {
+			t.Errorf("Has(%q): expected %v, got %v", e.ingredient, e.want, got)
+		}
+	}
+}
+
+func TestSearchPatterns(t *testing.T) {
+	p := New("berries, leaves, scallions")
+	// Every covered name has to contain one of the patterns
+	for _, name := range []string{"mixed berries", "berry", "bay leaves", "basil leaf", "green onions", "Spring Onion", "scallion"} {
+		if !p.Has(name) {
+			t.Fatalf("expected pantry to have %q", name)
+		}
+		found := false
+		for _, pattern := range p.SearchPatterns() {
+			if strings.Contains(strings.ToLower(name), pattern) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected a pattern matching %q in %q", name, p.SearchPatterns())
+		}
+	}
+}
@@ -5,18 +5,23 @@ import (
 	"errors"
 	"fmt"
 	"github.com/popnfresh234/recipe-app-golang/internal/config"
+	"github.com/popnfresh234/recipe-app-golang/internal/helpers"
+	"github.com/popnfresh234/recipe-app-golang/internal/images"
 	"github.com/popnfresh234/recipe-app-golang/internal/models"
 	"html/template"
 	"log"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 var app *config.AppConfig
 var pathToTemplates = "./web/templates"
 var pathToComponents = "./web/templates/components"
-var functions = template.FuncMap{"dict": dict, "formatTime": formatTime, "add": add}
+var functions = template.FuncMap{
+	"dict": dict, "formatTime": formatTime, "add": add, "imageURL": imageURL, "imageSrcset": imageSrcset,
+}
 
 // dict creates a dictionary of key-value pairs
 func dict(values ...interface{}) (map[string]interface{}, error) {
@@ -44,6 +49,20 @@ func add(a, b int) int {
 	return a + b
 }
 
+// imageURL is the URL of the copy of the image with key resized to width
+func imageURL(key string, width int) string {
+	return "/images/" + images.SizeKey(key, width)
+}
+
+// imageSrcset lists the resized copies of the image with key for the srcset of an img, so browsers pick the size they need
+func imageSrcset(key string) string {
+	sizes := make([]string, len(images.Widths))
+	for i, width := range images.Widths {
+		sizes[i] = fmt.Sprintf("%s %dw", imageURL(key, width), width)
+	}
+	return strings.Join(sizes, ", ")
+}
+
 // NewRenderer craetes a new renderer with access to AppConfig
 func NewRenderer(a *config.AppConfig) {
 	app = a
@@ -54,9 +73,13 @@ func AddDefaultData(templateData *models.TemplateData, r *http.Request) *models.
 	templateData.Flash = app.Session.PopString(r.Context(), "flash")
 	templateData.Error = app.Session.PopString(r.Context(), "error")
 	templateData.Warning = app.Session.PopString(r.Context(), "warning")
+	templateData.CSRFToken = helpers.CSRFToken(r)
 	if app.Session.Exists(r.Context(), "user") {
 		templateData.IsAuthenticated = 1
 	}
+	if user, ok := app.Session.Get(r.Context(), "user").(models.User); ok {
+		templateData.IsAdmin = user.HasRole(models.RoleAdmin)
+	}
 	return templateData
 }
 
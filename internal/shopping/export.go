@@ -0,0 +1,52 @@
+package shopping
+
+import (
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"strings"
+)
+
+// Export formats
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+)
+
+// Formats are the formats a shopping list can be exported in
+var Formats = []string{FormatText, FormatMarkdown}
+
+// Text writes a shopping list as plain text, a heading line for each section and a box for each item
+func Text(list models.ShoppingList) string {
+	var b strings.Builder
+	b.WriteString(list.Name + "\n")
+	for _, section := range list.Sections() {
+		b.WriteString("\n" + section.Name + "\n")
+		for _, item := range section.Items {
+			b.WriteString(checkbox(item) + " " + item.String() + "\n")
+		}
+	}
+	return b.String()
+}
+
+// markdownEscaper escapes the characters that would format the names of items in Markdown
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "`", "\\`", "#", `\#`)
+
+// Markdown writes a shopping list as Markdown, a heading for each section and a task list item for each item
+func Markdown(list models.ShoppingList) string {
+	var b strings.Builder
+	b.WriteString("# " + markdownEscaper.Replace(list.Name) + "\n")
+	for _, section := range list.Sections() {
+		b.WriteString("\n## " + section.Name + "\n\n")
+		for _, item := range section.Items {
+			b.WriteString("- " + checkbox(item) + " " + markdownEscaper.Replace(item.String()) + "\n")
+		}
+	}
+	return b.String()
+}
+
+// checkbox is the box of an item, ticked when it is checked
+func checkbox(item models.ShoppingListItem) string {
+	if item.Checked {
+		return "[x]"
+	}
+	return "[ ]"
+}
@@ -0,0 +1,79 @@
+package shopping
+
+import (
+	"github.com/popnfresh234/recipe-app-golang/internal/pantry"
+	"slices"
+	"strings"
+)
+
+// Store sections, in the order a shopping list walks through them
+const (
+	Produce = "Produce"
+	Meat    = "Meat & Seafood"
+	Dairy   = "Dairy & Eggs"
+	Bakery  = "Bakery"
+	Baking  = "Baking"
+	Pantry  = "Pantry"
+	Spices  = "Spices"
+	Frozen  = "Frozen"
+	Other   = "Other"
+)
+
+// Sections are the store sections in order, items of no other section go in Other
+var Sections = []string{Produce, Meat, Dairy, Bakery, Baking, Pantry, Spices, Frozen, Other}
+
+// sectionNames maps ingredient names, normalized by pantry.Normalize, to the section they are found in
+var sectionNames = map[string]string{
+	"apple": Produce, "avocado": Produce, "banana": Produce, "basil": Produce, "bell pepper": Produce,
+	"berry": Produce, "broccoli": Produce, "cabbage": Produce, "carrot": Produce, "celery": Produce,
+	"cilantro": Produce, "cucumber": Produce, "dill": Produce, "eggplant": Produce, "garlic": Produce,
+	"ginger": Produce, "jalapeno": Produce, "kale": Produce, "lemon": Produce, "lettuce": Produce,
+	"lime": Produce, "mint": Produce, "mushroom": Produce, "onion": Produce, "orange": Produce,
+	"parsley": Produce, "pea": Produce, "potato": Produce, "rosemary": Produce, "scallion": Produce,
+	"shallot": Produce, "spinach": Produce, "thyme": Produce, "tomato": Produce, "zucchini": Produce,
+	"arugula": Produce,
+
+	"bacon": Meat, "beef": Meat, "chicken": Meat, "fish": Meat, "ham": Meat, "lamb": Meat, "pork": Meat,
+	"salmon": Meat, "sausage": Meat, "shrimp": Meat, "steak": Meat, "tuna": Meat, "turkey": Meat,
+
+	"butter": Dairy, "cheddar": Dairy, "cheese": Dairy, "cream": Dairy, "egg": Dairy, "milk": Dairy,
+	"mozzarella": Dairy, "parmesan": Dairy, "yogurt": Dairy,
+
+	"bread": Bakery, "bun": Bakery, "pita": Bakery, "tortilla": Bakery, "baguette": Bakery,
+
+	"baking powder": Baking, "baking soda": Baking, "chocolate": Baking, "chocolate chip": Baking,
+	"cocoa": Baking, "cornstarch": Baking, "cream of tartar": Baking, "flour": Baking, "sugar": Baking,
+	"vanilla": Baking, "vanilla extract": Baking, "yeast": Baking,
+
+	"bean": Pantry, "broth": Pantry, "chickpea": Pantry, "coconut milk": Pantry, "honey": Pantry,
+	"lentil": Pantry, "noodle": Pantry, "oat": Pantry, "oil": Pantry, "pasta": Pantry, "paste": Pantry,
+	"peanut butter": Pantry, "rice": Pantry, "sauce": Pantry, "spaghetti": Pantry, "stock": Pantry,
+	"syrup": Pantry, "vinegar": Pantry,
+
+	"bay leaf": Spices, "black pepper": Spices, "chili powder": Spices, "cinnamon": Spices, "cumin": Spices,
+	"nutmeg": Spices, "oregano": Spices, "paprika": Spices, "pepper": Spices, "salt": Spices,
+	"seasoning": Spices, "spice": Spices,
+
+	"ice cream": Frozen,
+}
+
+// Section finds the store section of an ingredient. The longest known name the ingredient's name ends with wins,
+// so peanut butter is in the pantry and black pepper with the spices. Names ending otherwise go in the section of
+// their last known word, like chicken breast, and anything frozen is in Frozen.
+func Section(ingredient string) string {
+	words := strings.Fields(pantry.Normalize(ingredient))
+	if slices.Contains(words, "frozen") {
+		return Frozen
+	}
+	for start := range words {
+		if section, ok := sectionNames[strings.Join(words[start:], " ")]; ok {
+			return section
+		}
+	}
+	for i := len(words) - 1; i >= 0; i-- {
+		if section, ok := sectionNames[words[i]]; ok {
+			return section
+		}
+	}
+	return Other
+}
@@ -0,0 +1,116 @@
+// Package shopping combines the ingredients of several recipes into a shopping list grouped by store section
+package shopping
+
+import (
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"github.com/popnfresh234/recipe-app-golang/internal/pantry"
+	"github.com/popnfresh234/recipe-app-golang/internal/units"
+	"slices"
+	"strings"
+)
+
+// MaxMultiplier is how many times over a recipe can be put on a shopping list
+const MaxMultiplier = 20
+
+// Selection is a recipe picked for a shopping list, with how many times over it will be cooked
+type Selection struct {
+	Recipe     models.Recipe
+	Multiplier float64
+}
+
+// entry is an item being merged, its quantity is in unit when the unit is known
+type entry struct {
+	key      string
+	name     string
+	quantity models.Quantity
+	unit     units.Unit
+	known    bool
+	unitText string
+}
+
+// Build combines the ingredients of the selected recipes, multiplied by their multipliers, into the items of a
+// shopping list. Ingredients whose names normalize to the same name are merged. Their amounts are summed when their
+// units measure the same thing, in the larger of the units, or are the same word, like clove and cloves.
+// Otherwise they stay separate items. The items are sorted by store section and then by name.
+func Build(selections []Selection) []models.ShoppingListItem {
+	var entries []*entry
+	for _, selection := range selections {
+		for _, ingredient := range selection.Recipe.Ingredients {
+			add(&entries, ingredient, selection.Multiplier)
+		}
+	}
+
+	items := make([]models.ShoppingListItem, 0, len(entries))
+	for _, e := range entries {
+		item := models.ShoppingListItem{Name: e.name, Unit: e.unitText, Section: Section(e.name)}
+		if e.known {
+			item.Amount = units.Format(e.quantity, e.unit)
+		} else {
+			item.Amount = e.quantity.String()
+		}
+		items = append(items, item)
+	}
+	slices.SortStableFunc(items, func(a, b models.ShoppingListItem) int {
+		if a.Section != b.Section {
+			return slices.Index(Sections, a.Section) - slices.Index(Sections, b.Section)
+		}
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	for i := range items {
+		items[i].Position = i
+	}
+	return items
+}
+
+// add merges an ingredient multiplied by multiplier into the entry with the same name and a compatible unit,
+// or appends a new entry
+func add(entries *[]*entry, ingredient models.Ingredient, multiplier float64) {
+	name := strings.TrimSpace(ingredient.Name)
+	key := pantry.Normalize(name)
+	if key == "" {
+		key = strings.ToLower(name)
+	}
+	quantity := ingredient.Quantity.Scale(multiplier)
+	unitText := strings.TrimSpace(ingredient.Unit)
+	unit, known := units.Parse(unitText)
+
+	for _, e := range *entries {
+		if e.key != key || e.known != known {
+			continue
+		}
+		switch {
+		case !known && pantry.Normalize(e.unitText) == pantry.Normalize(unitText):
+			e.quantity = sum(e.quantity, quantity)
+			return
+		case known && e.unit.Kind == unit.Kind:
+			// Sum in the larger unit, so tablespoons and cups add up to cups
+			if unit.Size > e.unit.Size {
+				e.quantity = scale(e.quantity, e.unit.Size/unit.Size)
+				e.unit, e.unitText = unit, unitText
+			} else {
+				quantity = scale(quantity, unit.Size/e.unit.Size)
+			}
+			e.quantity = sum(e.quantity, quantity)
+			return
+		}
+	}
+	*entries = append(*entries, &entry{
+		key: key, name: name, quantity: quantity, unit: unit, known: known, unitText: unitText,
+	})
+}
+
+// scale converts a quantity with factor, amounts to taste and no amount stay as they are
+func scale(q models.Quantity, factor float64) models.Quantity {
+	if q.Max <= 0 {
+		return q
+	}
+	return q.Scale(factor)
+}
+
+// sum adds two quantities. An amount to taste is dropped when the other has an amount, it is needed either way.
+func sum(a, b models.Quantity) models.Quantity {
+	if a.Max > 0 || b.Max > 0 {
+		return models.Quantity{Min: a.Min + b.Min, Max: a.Max + b.Max}
+	}
+	return models.Quantity{ToTaste: a.ToTaste || b.ToTaste}
+}
@@ -0,0 +1,107 @@
+package shopping
+
+import (
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"slices"
+	"testing"
+)
+
+// recipe makes a recipe of ingredients written as name, amount and unit
+func recipe(t *testing.T, ingredients ...[3]string) models.Recipe {
+	t.Helper()
+	var r models.Recipe
+	for _, i := range ingredients {
+		quantity, err := models.ParseQuantity(i[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Ingredients = append(r.Ingredients, models.Ingredient{Name: i[0], Amount: i[1], Unit: i[2], Quantity: quantity})
+	}
+	return r
+}
+
+func TestBuild(t *testing.T) {
+	pancakes := recipe(t,
+		[3]string{"flour", "1", "cup"},
+		[3]string{"butter", "2", "tbsp"},
+		[3]string{"eggs", "2", ""},
+		[3]string{"milk", "250", "ml"},
+		[3]string{"salt", "to taste", ""},
+	)
+	soup := recipe(t,
+		[3]string{"Tomatoes", "1-2", "lb"},
+		[3]string{"garlic", "2", "cloves"},
+		[3]string{"Flour", "2", "Tablespoons"},
+		[3]string{"butter", "100", "g"},
+		[3]string{"egg", "1", ""},
+		[3]string{"milk", "1", "cup"},
+		[3]string{"garlic", "1", "clove"},
+		[3]string{"salt", "", ""},
+	)
+	items := Build([]Selection{{Recipe: pancakes, Multiplier: 2}, {Recipe: soup, Multiplier: 1}})
+
+	var got []string
+	for i, item := range items {
+		got = append(got, item.Section+": "+item.String())
+		if item.Position != i {
+			t.Errorf("%s: expected position %d, got %d", item.Name, i, item.Position)
+		}
+	}
+	want := []string{
+		"Produce: 3 cloves garlic",
+		"Produce: 1-2 lb Tomatoes",
+		"Dairy & Eggs: 4 tbsp butter",
+		"Dairy & Eggs: 100 g butter",
+		"Dairy & Eggs: 5 eggs",
+		"Dairy & Eggs: 3⅛ cup milk",
+		"Baking: 2⅛ cup flour",
+		"Spices: to taste salt",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected\n%q, got\n%q", want, got)
+	}
+}
+
+func TestSection(t *testing.T) {
+	tests := map[string]string{
+		"Green Onions":        Produce,
+		"red bell pepper":     Produce,
+		"chicken breast":      Meat,
+		"peanut butter":       Pantry,
+		"unsalted butter":     Dairy,
+		"black pepper":        Spices,
+		"red pepper flakes":   Spices,
+		"frozen peas":         Frozen,
+		"vanilla ice cream":   Frozen,
+		"chicken stock":       Pantry,
+		"icing sugar":         Baking,
+		"banana leaves":       Produce,
+		"dragon fruit":        Other,
+		"":                    Other,
+		"cream of tartar":     Baking,
+		"sour cream":          Dairy,
+		"canned tomato paste": Pantry,
+	}
+	for ingredient, want := range tests {
+		if got := Section(ingredient); got != want {
+			t.Errorf("%q: expected %s, got %s", ingredient, want, got)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	list := models.ShoppingList{Name: "Week *1*", Items: []models.ShoppingListItem{
+		{Name: "garlic", Amount: "3", Unit: "cloves", Section: Produce, Checked: true},
+		{Name: "tomatoes", Amount: "1-2", Unit: "lb", Section: Produce},
+		{Name: "salt", Section: Spices},
+	}}
+
+	text := "Week *1*\n\nProduce\n[x] 3 cloves garlic\n[ ] 1-2 lb tomatoes\n\nSpices\n[ ] salt\n"
+	if got := Text(list); got != text {
+		t.Errorf("expected\n%s\ngot\n%s", text, got)
+	}
+	markdown := "# Week \\*1\\*\n\n## Produce\n\n- [x] 3 cloves garlic\n- [ ] 1-2 lb tomatoes\n\n## Spices\n\n- [ ] salt\n"
+	if got := Markdown(list); got != markdown {
+		t.Errorf("expected\n%s\ngot\n%s", markdown, got)
+	}
+}
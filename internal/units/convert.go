@@ -0,0 +1,100 @@
+package units
+
+import (
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"math"
+	"strconv"
+)
+
+// Convert converts a quantity of ingredient measured in unit to system. Volumes of ingredients in the density table
+// become masses in metric, and their masses become volumes in US customary, so a cup of flour is weighed and 100 g of
+// sugar is measured. Amounts to taste, units that aren't measures, spoons and units already in system aren't converted
+// and ok is false.
+func Convert(quantity models.Quantity, unit, ingredient string, system System) (models.Quantity, Unit, bool) {
+	from, ok := Parse(unit)
+	if !ok || quantity.ToTaste || quantity.Max <= 0 || from.System == "" || from.System == system {
+		return quantity, from, false
+	}
+
+	kind := from.Kind
+	factor := from.Size
+	if density, ok := Density(ingredient); ok {
+		switch {
+		case kind == Volume && system == Metric:
+			kind = Mass
+			factor *= density
+		case kind == Mass && system == Imperial:
+			kind = Volume
+			factor /= density
+		}
+	}
+
+	to := pick(kind, system, quantity.Max*factor)
+	factor /= to.Size
+	return models.Quantity{Min: quantity.Min * factor, Max: quantity.Max * factor}, to, true
+}
+
+// pick picks the unit of system a cook would measure size millilitres or grams in
+func pick(kind Kind, system System, size float64) Unit {
+	switch {
+	case system == Metric && kind == Volume && size >= Litre.Size:
+		return Litre
+	case system == Metric && kind == Volume:
+		return Millilitre
+	case system == Metric && size >= Kilogram.Size:
+		return Kilogram
+	case system == Metric:
+		return Gram
+	case kind == Volume && size < Tablespoon.Size:
+		return Teaspoon
+	case kind == Volume && size < Cup.Size/4:
+		return Tablespoon
+	case kind == Volume:
+		return Cup
+	case size < Pound.Size:
+		return Ounce
+	}
+	return Pound
+}
+
+// Format formats a quantity measured in unit. Metric amounts are rounded the way scales and jugs are read,
+// others get kitchen fractions.
+func Format(quantity models.Quantity, unit Unit) string {
+	if unit.System != Metric || quantity.Max <= 0 {
+		return quantity.String()
+	}
+	min, max := formatMetric(quantity.Min), formatMetric(quantity.Max)
+	if min == max {
+		return max
+	}
+	return min + "-" + max
+}
+
+// formatMetric rounds to the nearest 5 from 100, to whole numbers from 10 and to one decimal below that
+func formatMetric(n float64) string {
+	switch {
+	case n >= 100:
+		n = math.Round(n/5) * 5
+	case n >= 10:
+		n = math.Round(n)
+	default:
+		n = math.Round(n*10) / 10
+	}
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// ConvertRecipe returns a copy of the recipe with the ingredients that Convert can convert in system,
+// their amounts formatted by Format and their units canonical. Other ingredients are left as written.
+func ConvertRecipe(recipe models.Recipe, system System) models.Recipe {
+	ingredients := make([]models.Ingredient, len(recipe.Ingredients))
+	for i, ingredient := range recipe.Ingredients {
+		if quantity, unit, ok := Convert(ingredient.Quantity, ingredient.Unit, ingredient.Name, system); ok {
+			ingredient.Quantity = quantity
+			ingredient.Amount = Format(quantity, unit)
+			ingredient.Unit = unit.Name
+		}
+		ingredients[i] = ingredient
+	}
+	recipe.Ingredients = ingredients
+	return recipe
+}
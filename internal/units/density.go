@@ -0,0 +1,51 @@
+package units
+
+import (
+	"strings"
+)
+
+// gramsPerCup are the weights of a US cup of ingredients that are as often weighed as measured by volume,
+// keyed by the last words of their name. Most come from the King Arthur ingredient weight chart.
+var gramsPerCup = map[string]float64{
+	"flour":               120,
+	"all-purpose flour":   120,
+	"bread flour":         127,
+	"cake flour":          113,
+	"whole wheat flour":   113,
+	"almond flour":        96,
+	"sugar":               200,
+	"granulated sugar":    200,
+	"brown sugar":         213,
+	"powdered sugar":      113,
+	"icing sugar":         113,
+	"confectioners sugar": 113,
+	"butter":              227,
+	"cocoa":               85,
+	"cocoa powder":        85,
+	"cornstarch":          112,
+	"rolled oats":         89,
+	"oats":                89,
+	"rice":                185,
+	"honey":               336,
+	"maple syrup":         312,
+	"salt":                288,
+	"kosher salt":         135,
+	"chocolate chips":     170,
+	"grated parmesan":     100,
+}
+
+// Density is how many grams a millilitre of ingredient weighs, for ingredients whose name ends with one in
+// the density table, like all-purpose flour or packed brown sugar. Whatever follows a comma is left out, like in
+// "flour, sifted". Names that end otherwise, like rice vinegar, aren't found.
+func Density(ingredient string) (float64, bool) {
+	name, _, _ := strings.Cut(strings.ToLower(ingredient), ",")
+	words := strings.Fields(strings.ReplaceAll(name, "'", ""))
+
+	// The longest match wins, so brown sugar isn't weighed as sugar
+	for start := 0; start < len(words); start++ {
+		if grams, ok := gramsPerCup[strings.Join(words[start:], " ")]; ok {
+			return grams / Cup.Size, true
+		}
+	}
+	return 0, false
+}
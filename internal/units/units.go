@@ -0,0 +1,99 @@
+// Package units normalizes the units of ingredients and converts them between metric and US customary units
+package units
+
+import (
+	"strings"
+)
+
+// System is a system of measurement a recipe can be shown in
+type System string
+
+// Systems of measurement. Spoons are used in both, so they belong to neither.
+const (
+	Metric   System = "metric"
+	Imperial System = "imperial" // US customary, the cups and ounces of American recipes
+)
+
+// Systems are the systems a recipe can be converted to, in the order the details page offers them
+var Systems = []System{Metric, Imperial}
+
+// Kind is what a unit measures
+type Kind int
+
+const (
+	Volume Kind = iota + 1
+	Mass
+)
+
+// Unit is a canonical unit of measurement
+type Unit struct {
+	Name   string  // the canonical name, like tbsp or g
+	Kind   Kind    // what it measures
+	System System  // the system it belongs to, empty for spoons
+	Size   float64 // millilitres for volumes, grams for masses
+}
+
+// The canonical units. US customary volumes are US liquid measures.
+var (
+	Millilitre = Unit{"ml", Volume, Metric, 1}
+	Decilitre  = Unit{"dl", Volume, Metric, 100}
+	Litre      = Unit{"l", Volume, Metric, 1000}
+	Teaspoon   = Unit{"tsp", Volume, "", 4.92892}
+	Tablespoon = Unit{"tbsp", Volume, "", 14.7868}
+	FluidOunce = Unit{"fl oz", Volume, Imperial, 29.5735}
+	Cup        = Unit{"cup", Volume, Imperial, 236.588}
+	Pint       = Unit{"pt", Volume, Imperial, 473.176}
+	Quart      = Unit{"qt", Volume, Imperial, 946.353}
+	Gallon     = Unit{"gal", Volume, Imperial, 3785.41}
+	Gram       = Unit{"g", Mass, Metric, 1}
+	Kilogram   = Unit{"kg", Mass, Metric, 1000}
+	Ounce      = Unit{"oz", Mass, Imperial, 28.3495}
+	Pound      = Unit{"lb", Mass, Imperial, 453.592}
+)
+
+// caseSensitiveAliases are the abbreviations where case matters, a capital T is a tablespoon and a small t a teaspoon
+var caseSensitiveAliases = map[string]Unit{
+	"T":  Tablespoon,
+	"t":  Teaspoon,
+	"Tb": Tablespoon,
+}
+
+// aliases are the lowercase ways units are written in recipes, without trailing periods
+var aliases = map[string]Unit{
+	"ml": Millilitre, "millilitre": Millilitre, "millilitres": Millilitre, "milliliter": Millilitre, "milliliters": Millilitre,
+	"dl": Decilitre, "decilitre": Decilitre, "decilitres": Decilitre, "deciliter": Decilitre, "deciliters": Decilitre,
+	"l": Litre, "litre": Litre, "litres": Litre, "liter": Litre, "liters": Litre, "ltr": Litre,
+	"tsp": Teaspoon, "tsps": Teaspoon, "teaspoon": Teaspoon, "teaspoons": Teaspoon, "tspn": Teaspoon,
+	"tbsp": Tablespoon, "tbsps": Tablespoon, "tbs": Tablespoon, "tbl": Tablespoon,
+	"tablespoon": Tablespoon, "tablespoons": Tablespoon,
+	"fl oz": FluidOunce, "fl. oz": FluidOunce, "floz": FluidOunce, "fluid ounce": FluidOunce, "fluid ounces": FluidOunce,
+	"cup": Cup, "cups": Cup, "c": Cup,
+	"pt": Pint, "pint": Pint, "pints": Pint,
+	"qt": Quart, "quart": Quart, "quarts": Quart,
+	"gal": Gallon, "gallon": Gallon, "gallons": Gallon,
+	"g": Gram, "gr": Gram, "gram": Gram, "grams": Gram, "gramme": Gram, "grammes": Gram,
+	"kg": Kilogram, "kilogram": Kilogram, "kilograms": Kilogram, "kilo": Kilogram, "kilos": Kilogram,
+	"oz": Ounce, "ounce": Ounce, "ounces": Ounce,
+	"lb": Pound, "lbs": Pound, "pound": Pound, "pounds": Pound,
+}
+
+// Parse normalizes the unit of an ingredient as it was typed, like Tablespoons, tbsp or T, to its canonical unit.
+// Units that aren't measures, like cloves or a pinch, aren't found.
+func Parse(unit string) (Unit, bool) {
+	unit = strings.TrimSuffix(strings.Join(strings.Fields(unit), " "), ".")
+	if u, ok := caseSensitiveAliases[unit]; ok {
+		return u, true
+	}
+	u, ok := aliases[strings.ToLower(unit)]
+	return u, ok
+}
+
+// ParseSystem finds the system named name, like the value of a ?units= query
+func ParseSystem(name string) (System, bool) {
+	for _, system := range Systems {
+		if string(system) == name {
+			return system, true
+		}
+	}
+	return "", false
+}
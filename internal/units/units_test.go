@@ -0,0 +1,126 @@
+package units
+
+import (
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		unit string
+		want Unit
+	}{
+		{"tbsp", Tablespoon},
+		{"Tablespoons", Tablespoon},
+		{"T", Tablespoon},
+		{"t", Teaspoon},
+		{"tsp.", Teaspoon},
+		{"Cups", Cup},
+		{"Fl. Oz", FluidOunce},
+		{"  fluid   ounces ", FluidOunce},
+		{"mL", Millilitre},
+		{"L", Litre},
+		{"grams", Gram},
+		{"lbs", Pound},
+	}
+	for _, e := range tests {
+		got, ok := Parse(e.unit)
+		if !ok || got != e.want {
+			t.Errorf("%q: expected %s, got %s (%v)", e.unit, e.want.Name, got.Name, ok)
+		}
+	}
+
+	for _, unit := range []string{"", "clove", "pinch", "whole", "tt"} {
+		if got, ok := Parse(unit); ok {
+			t.Errorf("%q: expected no unit, got %s", unit, got.Name)
+		}
+	}
+}
+
+func TestDensity(t *testing.T) {
+	tests := []struct {
+		ingredient  string
+		gramsPerCup float64
+	}{
+		{"All-Purpose Flour", 120},
+		{"flour, sifted", 120},
+		{"packed brown sugar", 213},
+		{"confectioners' sugar", 113},
+		{"unsalted butter", 227},
+	}
+	for _, e := range tests {
+		got, ok := Density(e.ingredient)
+		if !ok || math.Abs(got*Cup.Size-e.gramsPerCup) > 1e-9 {
+			t.Errorf("%q: expected %v g a cup, got %v (%v)", e.ingredient, e.gramsPerCup, got*Cup.Size, ok)
+		}
+	}
+
+	for _, ingredient := range []string{"rice vinegar", "sugar snap peas", "salted peanuts", "milk"} {
+		if _, ok := Density(ingredient); ok {
+			t.Errorf("%q: expected no density", ingredient)
+		}
+	}
+}
+
+func TestConvertRecipe(t *testing.T) {
+	amount := func(text string) models.Quantity {
+		quantity, err := models.ParseQuantity(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return quantity
+	}
+	ingredient := func(name, text, unit string) models.Ingredient {
+		return models.Ingredient{Name: name, Amount: text, Unit: unit, Quantity: amount(text)}
+	}
+
+	tests := []struct {
+		ingredient models.Ingredient
+		system     System
+		amount     string
+		unit       string
+	}{
+		{ingredient("all-purpose flour", "1", "cup"), Metric, "120", "g"},
+		{ingredient("brown sugar", "1-2", "Cups"), Metric, "215-425", "g"},
+		{ingredient("milk", "2", "cups"), Metric, "475", "ml"},
+		{ingredient("water", "5", "c"), Metric, "1.2", "l"},
+		{ingredient("ground beef", "1", "lb"), Metric, "455", "g"},
+		{ingredient("sugar", "200", "g"), Imperial, "1", "cup"},
+		{ingredient("butter", "113.5", "grams"), Imperial, "½", "cup"},
+		{ingredient("chicken", "1", "kg"), Imperial, "2.2", "lb"},
+		{ingredient("stock", "240", "ml"), Imperial, "1", "cup"},
+		{ingredient("vanilla", "5", "ml"), Imperial, "1", "tsp"},
+
+		// Left as written
+		{ingredient("flour", "2", "Tablespoons"), Metric, "2", "Tablespoons"},
+		{ingredient("flour", "1", "cup"), Imperial, "1", "cup"},
+		{ingredient("milk", "500", "ml"), Metric, "500", "ml"},
+		{ingredient("garlic", "2", "cloves"), Metric, "2", "cloves"},
+		{ingredient("salt", "to taste", "g"), Imperial, "to taste", "g"},
+		{models.Ingredient{Name: "parsley", Amount: "a handful", Unit: "cup"}, Metric, "a handful", "cup"},
+	}
+	for _, e := range tests {
+		recipe := models.Recipe{Ingredients: []models.Ingredient{e.ingredient}}
+		got := ConvertRecipe(recipe, e.system).Ingredients[0]
+		if got.Amount != e.amount || got.Unit != e.unit {
+			t.Errorf("%s %s %s in %s: expected %s %s, got %s %s", e.ingredient.Amount, e.ingredient.Unit,
+				e.ingredient.Name, e.system, e.amount, e.unit, got.Amount, got.Unit)
+		}
+		if recipe.Ingredients[0].Amount != e.ingredient.Amount {
+			t.Errorf("%s: expected the recipe to be left alone, got %s", e.ingredient.Name, recipe.Ingredients[0].Amount)
+		}
+	}
+}
+
+func TestParseSystem(t *testing.T) {
+	if system, ok := ParseSystem("metric"); !ok || system != Metric {
+		t.Errorf("expected metric, got %q", system)
+	}
+	if system, ok := ParseSystem("imperial"); !ok || system != Imperial {
+		t.Errorf("expected imperial, got %q", system)
+	}
+	if _, ok := ParseSystem("Metric"); ok {
+		t.Error("expected systems to be lowercase")
+	}
+}
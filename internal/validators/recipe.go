@@ -0,0 +1,164 @@
+// Package validators checks JSON payloads, the forms package does the same for posted forms
+package validators
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/popnfresh234/recipe-app-golang/internal/images"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Limits of a recipe, the text columns are varchar(255) in MySQL
+const (
+	MaxTitleLength          = 100
+	MaxIngredients          = 100
+	MaxIngredientNameLength = 100
+	MaxAmountLength         = 20
+	MaxUnitLength           = 30
+	MaxDirections           = 100
+	MaxDirectionLength      = 255
+	MaxImageBytes           = 2 << 20
+	MaxPhotos               = 20
+	MaxCaptionLength        = 255
+	MaxServings             = 100
+)
+
+// Errors holds validation error messages keyed by the JSON path of the field, like "title" or "ingredients[2].amount"
+type Errors map[string][]string
+
+// Add adds an error message for a given path
+func (e Errors) Add(path, message string) {
+	e[path] = append(e[path], message)
+}
+
+// Recipe validates a recipe posted as JSON the way forms.Form validates a posted form
+type Recipe struct {
+	Recipe models.JsonRecipe
+	Errors Errors
+}
+
+// NewRecipe initializes a recipe validator
+func NewRecipe(recipe models.JsonRecipe) *Recipe {
+	return &Recipe{
+		Recipe: recipe,
+		Errors: Errors{},
+	}
+}
+
+// Validate checks every field of the recipe
+func (f *Recipe) Validate() {
+	f.required("title", f.Recipe.Title)
+	f.maxLength("title", f.Recipe.Title, MaxTitleLength)
+	if f.Recipe.Servings < 0 || f.Recipe.Servings > MaxServings {
+		f.Errors.Add("servings", fmt.Sprintf("Use a number of servings from 1 to %d, or leave it empty", MaxServings))
+	}
+
+	switch {
+	case len(f.Recipe.Ingredients) == 0:
+		f.Errors.Add("ingredients", "Add at least one ingredient")
+	case len(f.Recipe.Ingredients) > MaxIngredients:
+		f.Errors.Add("ingredients", fmt.Sprintf("A recipe can have at most %d ingredients", MaxIngredients))
+	}
+	for i, ingredient := range f.Recipe.Ingredients {
+		path := fmt.Sprintf("ingredients[%d]", i)
+		f.required(path+".name", ingredient.Name)
+		f.maxLength(path+".name", ingredient.Name, MaxIngredientNameLength)
+		f.amount(path+".amount", ingredient.Amount)
+		f.maxLength(path+".unit", ingredient.Unit, MaxUnitLength)
+	}
+
+	switch {
+	case len(f.Recipe.Directions) == 0:
+		f.Errors.Add("directions", "Add at least one direction")
+	case len(f.Recipe.Directions) > MaxDirections:
+		f.Errors.Add("directions", fmt.Sprintf("A recipe can have at most %d directions", MaxDirections))
+	}
+	for i, direction := range f.Recipe.Directions {
+		path := fmt.Sprintf("directions[%d]", i)
+		f.required(path+".direction", direction.Direction)
+		f.maxLength(path+".direction", direction.Direction, MaxDirectionLength)
+		f.photos(path+".photos", direction.Photos)
+	}
+
+	f.image("image", f.Recipe.Image)
+	f.photos("photos", f.Recipe.Photos)
+}
+
+// Valid returns true if there are no errors, otherwise false
+func (f *Recipe) Valid() bool {
+	return len(f.Errors) == 0
+}
+
+// required checks that value isn't blank
+func (f *Recipe) required(path, value string) {
+	if strings.TrimSpace(value) == "" {
+		f.Errors.Add(path, "This field cannot be empty")
+	}
+}
+
+// maxLength checks that value is at most length characters long
+func (f *Recipe) maxLength(path, value string, length int) {
+	if len([]rune(value)) > length {
+		f.Errors.Add(path, fmt.Sprintf("This field must be at most %d characters long", length))
+	}
+}
+
+// amount checks that an amount, if there is one, is a quantity models.ParseQuantity understands,
+// like validAmount in validators.js
+func (f *Recipe) amount(path, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	_, err := models.ParseQuantity(value)
+	if len([]rune(value)) > MaxAmountLength || err != nil {
+		f.Errors.Add(path, "Use an amount like 2, 1.5, 1 1/2, 1½, a range like 2-3 or to taste")
+	}
+}
+
+// photos checks that there are at most MaxPhotos photos, each the key of an uploaded image with a caption of
+// at most MaxCaptionLength. Photos must be uploaded first, they can't be base64 like the image of a recipe.
+func (f *Recipe) photos(path string, photos []models.JsonPhoto) {
+	if len(photos) > MaxPhotos {
+		f.Errors.Add(path, fmt.Sprintf("At most %d photos can be added", MaxPhotos))
+	}
+	for i, photo := range photos {
+		photoPath := fmt.Sprintf("%s[%d]", path, i)
+		if !images.OriginalKey(photo.Image) {
+			f.Errors.Add(photoPath+".image", "Upload the photo first")
+		}
+		f.maxLength(photoPath+".caption", photo.Caption, MaxCaptionLength)
+	}
+}
+
+// image checks that an image, if there is one, is the key of an uploaded image or
+// a base64 encoded PNG, JPEG or WebP of at most MaxImageBytes
+func (f *Recipe) image(path, value string) {
+	if value == "" || images.OriginalKey(value) {
+		return
+	}
+	if images.ValidKey(value) {
+		f.Errors.Add(path, "Use the ID of the uploaded image, not of one of its sizes")
+		return
+	}
+	if base64.StdEncoding.DecodedLen(len(value)) > MaxImageBytes+2 {
+		f.Errors.Add(path, fmt.Sprintf("The image must be at most %d MB", MaxImageBytes>>20))
+		return
+	}
+
+	b, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		f.Errors.Add(path, "The image is not valid base64")
+		return
+	}
+	if len(b) > MaxImageBytes {
+		f.Errors.Add(path, fmt.Sprintf("The image must be at most %d MB", MaxImageBytes>>20))
+		return
+	}
+	if !slices.Contains(images.Types, http.DetectContentType(b)) {
+		f.Errors.Add(path, "The image must be a PNG, JPEG or WebP")
+	}
+}
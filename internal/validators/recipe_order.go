@@ -0,0 +1,54 @@
+package validators
+
+import (
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"slices"
+)
+
+// RecipeOrder validates a new order of the ingredients and directions of a recipe
+type RecipeOrder struct {
+	Order  models.JsonRecipeOrder
+	Recipe models.Recipe
+	Errors Errors
+}
+
+// NewRecipeOrder initializes a validator of order for recipe
+func NewRecipeOrder(order models.JsonRecipeOrder, recipe models.Recipe) *RecipeOrder {
+	return &RecipeOrder{
+		Order:  order,
+		Recipe: recipe,
+		Errors: Errors{},
+	}
+}
+
+// Validate checks that each list in the order holds every ID of the recipe's ingredients or directions once
+func (f *RecipeOrder) Validate() {
+	var ingredients, directions []int
+	for _, ingredient := range f.Recipe.Ingredients {
+		ingredients = append(ingredients, ingredient.ID)
+	}
+	for _, direction := range f.Recipe.Directions {
+		directions = append(directions, direction.ID)
+	}
+	f.ids("ingredients", f.Order.Ingredients, ingredients, "List the id of every ingredient of the recipe once")
+	f.ids("directions", f.Order.Directions, directions, "List the id of every direction of the recipe once")
+}
+
+// Valid returns true if there are no errors, otherwise false
+func (f *RecipeOrder) Valid() bool {
+	return len(f.Errors) == 0
+}
+
+// ids checks that ids, if given, are the IDs in want in any order
+func (f *RecipeOrder) ids(path string, ids, want []int, message string) {
+	if ids == nil {
+		return
+	}
+	ids = slices.Clone(ids)
+	want = slices.Clone(want)
+	slices.Sort(ids)
+	slices.Sort(want)
+	if !slices.Equal(ids, want) {
+		f.Errors.Add(path, message)
+	}
+}
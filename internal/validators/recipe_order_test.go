@@ -0,0 +1,42 @@
+package validators
+
+import (
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"slices"
+	"testing"
+)
+
+func TestRecipeOrderValidate(t *testing.T) {
+	recipe := models.Recipe{
+		Ingredients: []models.Ingredient{{ID: 1}, {ID: 2}, {ID: 3}},
+		Directions:  []models.Direction{{ID: 4}, {ID: 5}},
+	}
+	tests := []struct {
+		name  string
+		order models.JsonRecipeOrder
+		want  []string
+	}{
+		{"both", models.JsonRecipeOrder{Ingredients: []int{3, 1, 2}, Directions: []int{5, 4}}, nil},
+		{"directions only", models.JsonRecipeOrder{Directions: []int{5, 4}}, nil},
+		{"nothing", models.JsonRecipeOrder{}, nil},
+		{"missing ingredient", models.JsonRecipeOrder{Ingredients: []int{3, 1}}, []string{"ingredients"}},
+		{"twice", models.JsonRecipeOrder{Ingredients: []int{1, 1, 2, 3}}, []string{"ingredients"}},
+		{"other recipe", models.JsonRecipeOrder{Directions: []int{5, 6}}, []string{"directions"}},
+		{"empty", models.JsonRecipeOrder{Ingredients: []int{}, Directions: []int{4}}, []string{"directions", "ingredients"}},
+	}
+	for _, e := range tests {
+		t.Run(e.name, func(t *testing.T) {
+			validator := NewRecipeOrder(e.order, recipe)
+			validator.Validate()
+
+			var paths []string
+			for path := range validator.Errors {
+				paths = append(paths, path)
+			}
+			slices.Sort(paths)
+			if !slices.Equal(paths, e.want) {
+				t.Errorf("expected errors for %v, got %v", e.want, validator.Errors)
+			}
+		})
+	}
+}
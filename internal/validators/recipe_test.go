@@ -0,0 +1,114 @@
+package validators
+
+import (
+	"encoding/base64"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// pngHeader is enough of a PNG for content sniffing
+var pngHeader = "\x89PNG\r\n\x1a\n"
+
+func validRecipe() models.JsonRecipe {
+	return models.JsonRecipe{
+		Title:    "Tomato Soup",
+		Servings: 4,
+		Ingredients: []models.JsonIngredient{
+			{Name: "tomatoes", Amount: "4", Unit: "whole"},
+			{Name: "cream", Amount: "1.5", Unit: "cups"},
+			{Name: "salt", Amount: "1/2", Unit: "tsp"},
+			{Name: "pepper"},
+		},
+		Directions: []models.JsonDirection{
+			{Direction: "Chop the tomatoes", Photos: []models.JsonPhoto{{Image: strings.Repeat("c", 64) + ".jpg"}}},
+			{Direction: "Simmer for 20 minutes"},
+		},
+		Image:  base64.StdEncoding.EncodeToString([]byte(pngHeader)),
+		Photos: []models.JsonPhoto{{Image: strings.Repeat("a", 64) + ".jpg", Caption: "Served with bread"}},
+	}
+}
+
+func TestRecipeValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(recipe *models.JsonRecipe)
+		want   string
+	}{
+		{"valid", func(recipe *models.JsonRecipe) {}, ""},
+		{"blank title", func(recipe *models.JsonRecipe) { recipe.Title = "  " }, "title"},
+		{"long title", func(recipe *models.JsonRecipe) { recipe.Title = strings.Repeat("é", MaxTitleLength+1) }, "title"},
+		{"no servings", func(recipe *models.JsonRecipe) { recipe.Servings = 0 }, ""},
+		{"negative servings", func(recipe *models.JsonRecipe) { recipe.Servings = -2 }, "servings"},
+		{"too many servings", func(recipe *models.JsonRecipe) { recipe.Servings = MaxServings + 1 }, "servings"},
+		{"no ingredients", func(recipe *models.JsonRecipe) { recipe.Ingredients = nil }, "ingredients"},
+		{"too many ingredients", func(recipe *models.JsonRecipe) {
+			recipe.Ingredients = make([]models.JsonIngredient, MaxIngredients+1)
+			for i := range recipe.Ingredients {
+				recipe.Ingredients[i].Name = "salt"
+			}
+		}, "ingredients"},
+		{"blank ingredient", func(recipe *models.JsonRecipe) { recipe.Ingredients[1].Name = "" }, "ingredients[1].name"},
+		{"word amount", func(recipe *models.JsonRecipe) { recipe.Ingredients[2].Amount = "a pinch" }, "ingredients[2].amount"},
+		{"negative amount", func(recipe *models.JsonRecipe) { recipe.Ingredients[0].Amount = "-1" }, "ingredients[0].amount"},
+		{"mixed number", func(recipe *models.JsonRecipe) { recipe.Ingredients[1].Amount = "1 1/2" }, ""},
+		{"unicode fraction", func(recipe *models.JsonRecipe) { recipe.Ingredients[1].Amount = "1½" }, ""},
+		{"range", func(recipe *models.JsonRecipe) { recipe.Ingredients[0].Amount = "3-4" }, ""},
+		{"backwards range", func(recipe *models.JsonRecipe) { recipe.Ingredients[0].Amount = "4-3" }, "ingredients[0].amount"},
+		{"to taste", func(recipe *models.JsonRecipe) { recipe.Ingredients[3].Amount = "to taste" }, ""},
+		{"long unit", func(recipe *models.JsonRecipe) { recipe.Ingredients[3].Unit = strings.Repeat("x", MaxUnitLength+1) }, "ingredients[3].unit"},
+		{"no directions", func(recipe *models.JsonRecipe) { recipe.Directions = []models.JsonDirection{} }, "directions"},
+		{"blank direction", func(recipe *models.JsonRecipe) { recipe.Directions[1].Direction = "\n" }, "directions[1].direction"},
+		{"long direction", func(recipe *models.JsonRecipe) {
+			recipe.Directions[0].Direction = strings.Repeat("x", MaxDirectionLength+1)
+		}, "directions[0].direction"},
+		{"no image", func(recipe *models.JsonRecipe) { recipe.Image = "" }, ""},
+		{"image key", func(recipe *models.JsonRecipe) { recipe.Image = strings.Repeat("0", 64) + ".webp" }, ""},
+		{"image size key", func(recipe *models.JsonRecipe) { recipe.Image = strings.Repeat("0", 64) + "-400.jpg" }, "image"},
+		{"image path", func(recipe *models.JsonRecipe) { recipe.Image = "../" + strings.Repeat("0", 64) + ".webp" }, "image"},
+		{"image not base64", func(recipe *models.JsonRecipe) { recipe.Image = "not base64!" }, "image"},
+		{"image type", func(recipe *models.JsonRecipe) {
+			recipe.Image = base64.StdEncoding.EncodeToString([]byte("GIF89a"))
+		}, "image"},
+		{"too many photos", func(recipe *models.JsonRecipe) {
+			for len(recipe.Photos) <= MaxPhotos {
+				recipe.Photos = append(recipe.Photos, recipe.Photos[0])
+			}
+		}, "photos"},
+		{"photo not uploaded", func(recipe *models.JsonRecipe) {
+			recipe.Photos[0].Image = base64.StdEncoding.EncodeToString([]byte(pngHeader))
+		}, "photos[0].image"},
+		{"photo size key", func(recipe *models.JsonRecipe) {
+			recipe.Photos[0].Image = strings.Repeat("b", 64) + "-1200.jpg"
+		}, "photos[0].image"},
+		{"long caption", func(recipe *models.JsonRecipe) {
+			recipe.Photos[0].Caption = strings.Repeat("x", MaxCaptionLength+1)
+		}, "photos[0].caption"},
+		{"direction photo path", func(recipe *models.JsonRecipe) {
+			recipe.Directions[0].Photos[0].Image = "../" + strings.Repeat("c", 64) + ".jpg"
+		}, "directions[0].photos[0].image"},
+		{"image size", func(recipe *models.JsonRecipe) {
+			recipe.Image = base64.StdEncoding.EncodeToString([]byte(pngHeader + strings.Repeat("x", MaxImageBytes)))
+		}, "image"},
+	}
+	for _, e := range tests {
+		t.Run(e.name, func(t *testing.T) {
+			recipe := validRecipe()
+			e.change(&recipe)
+			validator := NewRecipe(recipe)
+			validator.Validate()
+
+			var paths []string
+			for path := range validator.Errors {
+				paths = append(paths, path)
+			}
+			if e.want == "" && !validator.Valid() {
+				t.Errorf("expected no errors, got %v", validator.Errors)
+			}
+			if e.want != "" && !slices.Equal(paths, []string{e.want}) {
+				t.Errorf("expected an error for %s only, got %v", e.want, validator.Errors)
+			}
+		})
+	}
+}
@@ -6,14 +6,35 @@ import (
 	"github.com/popnfresh234/recipe-app-golang/repository"
 )
 
-type mysqlDBRepo struct {
+// sqlDBRepo holds the repository methods whose SQL runs unchanged on MySQL and SQLite.
+// The driver repos embed it and add the methods that differ, like search and time scanning.
+type sqlDBRepo struct {
 	App *config.AppConfig
 	DB  *sql.DB
 }
 
+type mysqlDBRepo struct {
+	sqlDBRepo
+}
+
 func NewMysqlRepo(conn *sql.DB, app *config.AppConfig) repository.DatabaseRepo {
 	return &mysqlDBRepo{
-		App: app,
-		DB:  conn,
+		sqlDBRepo{
+			App: app,
+			DB:  conn,
+		},
+	}
+}
+
+type sqliteDBRepo struct {
+	sqlDBRepo
+}
+
+func NewSqliteRepo(conn *sql.DB, app *config.AppConfig) repository.DatabaseRepo {
+	return &sqliteDBRepo{
+		sqlDBRepo{
+			App: app,
+			DB:  conn,
+		},
 	}
 }
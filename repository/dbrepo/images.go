@@ -0,0 +1,206 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"github.com/popnfresh234/recipe-app-golang/internal/images"
+	"log"
+	"time"
+)
+
+// imageBlobBatch is how many images MoveImageBlobs reads at a time, each can be a few megabytes
+const imageBlobBatch = 20
+
+// imageBlob is an image still kept in the image column of a recipe
+type imageBlob struct {
+	recipeID int
+	image    []byte
+}
+
+// moveImageBlobsMigration is the name MoveImageBlobs is recorded under in data_migrations
+const moveImageBlobsMigration = "move_image_blobs"
+
+// MoveImageBlobs moves the base64 images recipes used to keep in their image column into store, and
+// points image_key at them. They are stored the way uploads are, resized and without their metadata.
+// It runs once for a database of either driver, data_migrations records that it ran.
+// Images that aren't base64 PNGs, JPEGs or WebPs are logged and left where they are. It returns how many it moved.
+func MoveImageBlobs(conn *sql.DB, store images.Store) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	done, err := dataMigrated(ctx, conn, moveImageBlobsMigration)
+	if err != nil || done {
+		return 0, err
+	}
+	moved, err := moveImageBlobs(ctx, conn, store)
+	if err != nil {
+		return moved, err
+	}
+	return moved, recordDataMigration(ctx, conn, moveImageBlobsMigration)
+}
+
+// moveImageBlobs moves the images of MoveImageBlobs, those without a key
+func moveImageBlobs(ctx context.Context, conn *sql.DB, store images.Store) (int, error) {
+	recipeID := func(blob imageBlob) int { return blob.recipeID }
+	return migrateInBatches(ctx, conn, imageBlobs, recipeID, func(blob imageBlob) (bool, error) {
+		data, err := base64.StdEncoding.DecodeString(string(blob.image))
+		if err != nil {
+			log.Println("Error decoding image of recipe", blob.recipeID, err)
+			return false, nil
+		}
+		key, err := images.Upload(ctx, store, data)
+		if errors.Is(err, images.ErrInvalidImage) {
+			log.Println("Error moving image of recipe", blob.recipeID, err)
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		// updated_at is left alone, the recipe didn't change
+		_, err = conn.ExecContext(ctx, `UPDATE recipes SET image_key = ?, image = '' WHERE id = ?`, key, blob.recipeID)
+		return err == nil, err
+	})
+}
+
+// imageBlobs reads the next batch of recipes after lastID that still keep their image in the image column
+func imageBlobs(ctx context.Context, conn *sql.DB, lastID int) ([]imageBlob, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT id, image FROM recipes
+		WHERE id > ? AND image_key = '' AND LENGTH(image) > 0
+		ORDER BY id
+		LIMIT ?`, lastID, imageBlobBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blobs []imageBlob
+	for rows.Next() {
+		var blob imageBlob
+		err = rows.Scan(&blob.recipeID, &blob.image)
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, blob)
+	}
+	return blobs, rows.Err()
+}
+
+// recipeImageKeys gets the keys of the images of a recipe, its own image and the photos of it and its directions
+func recipeImageKeys(ctx context.Context, tx dbtx, recipeId int) ([]string, error) {
+	statement := `
+		SELECT image_key FROM recipes WHERE id = ? AND image_key <> ''
+		UNION
+		SELECT image_key FROM recipe_photos WHERE recipe_id = ?
+		UNION
+		SELECT
+		    direction_photos.image_key
+		FROM direction_photos
+		JOIN directions ON directions.id = direction_photos.direction_id
+		WHERE directions.recipe_id = ?
+	`
+	rows, err := tx.QueryContext(ctx, statement, recipeId, recipeId, recipeId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		err = rows.Scan(&key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// unusedImageKeys keeps the keys that no recipe, recipe photo or direction photo uses, and that no upload
+// is waiting to be used for. Images are stored by their contents, so an image can be used by several recipes.
+func unusedImageKeys(ctx context.Context, tx dbtx, keys []string) ([]string, error) {
+	statement := `
+		SELECT
+		    (SELECT COUNT(*) FROM recipes WHERE image_key = ?) +
+		    (SELECT COUNT(*) FROM recipe_photos WHERE image_key = ?) +
+		    (SELECT COUNT(*) FROM direction_photos WHERE image_key = ?) +
+		    (SELECT COUNT(*) FROM uploads WHERE image_key = ?)
+	`
+	var unused []string
+	for _, key := range keys {
+		var uses int
+		err := tx.QueryRowContext(ctx, statement, key, key, key, key).Scan(&uses)
+		if err != nil {
+			return nil, err
+		}
+		if uses == 0 {
+			unused = append(unused, key)
+		}
+	}
+	return unused, nil
+}
+
+// insertUpload records that a user uploaded the image with key
+func insertUpload(ctx context.Context, tx dbtx, userId int, key string) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO uploads (user_id, image_key, created_at, updated_at) VALUES (?,?,?,?)`,
+		userId, key, time.Now(), time.Now())
+	return err
+}
+
+// countUploads counts the images a user uploaded since since
+func countUploads(ctx context.Context, tx dbtx, userId int, since time.Time) (int, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM uploads WHERE user_id = ? AND created_at >= ?`, userId, since).
+		Scan(&count)
+	return count, err
+}
+
+// deleteUploads deletes the uploads made before before, and returns the keys of their images that are now unused
+func deleteUploads(ctx context.Context, tx dbtx, before time.Time) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT DISTINCT image_key FROM uploads WHERE created_at < ?`, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		err = rows.Scan(&key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM uploads WHERE created_at < ?`, before)
+	if err != nil {
+		return nil, err
+	}
+	return unusedImageKeys(ctx, tx, keys)
+}
+
+// removeImages deletes the images with keys, and their resized copies, from store.
+// Errors are only logged, an image left behind takes up space but breaks nothing.
+func removeImages(store images.Store, keys []string) {
+	if store == nil || len(keys) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, key := range keys {
+		err := images.Remove(ctx, store, key)
+		if err != nil {
+			log.Println("Error removing image", key, err)
+		}
+	}
+}
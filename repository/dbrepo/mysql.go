@@ -2,82 +2,158 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/popnfresh234/recipe-app-golang/internal/models"
 	"golang.org/x/crypto/bcrypt"
 	"log"
+	"strings"
 	"time"
 )
 
+// GetAllRecipes gets every recipe along with the name of its author
 func (dbRepo *mysqlDBRepo) GetAllRecipes() ([]models.Recipe, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	rows, err := dbRepo.DB.QueryContext(ctx, `
-		select 
-		    id, image, title, created_at, updated_at, user_id
-		from recipes
+		SELECT
+		    recipes.id, recipes.title, recipes.image_key, recipes.created_at, recipes.updated_at, recipes.user_id, users.name
+		FROM recipes
+		JOIN users ON users.id = recipes.user_id
+		ORDER BY recipes.id
 	`)
 	if err != nil {
-		fmt.Println(err)
+		log.Println(err)
 		return nil, err
 	}
+	defer rows.Close()
 
+	return scanMysqlRecipeList(rows)
+}
+
+// ListRecipes gets a page of recipes in the given sort order, along with the total number of recipes
+func (dbRepo *mysqlDBRepo) ListRecipes(offset, limit int, sort string) ([]models.Recipe, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	statement, err := recipeListStatement(sort)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := countRecipes(ctx, dbRepo.DB)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	rows, err := dbRepo.DB.QueryContext(ctx, statement, limit, offset)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	recipes, err := scanMysqlRecipeList(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return recipes, total, nil
+}
+
+// mysqlSearchFrom matches recipes against the FULLTEXT indexes on titles, ingredient names and directions.
+// Every placeholder takes the search terms.
+const mysqlSearchFrom = `
+	FROM recipes
+	JOIN users ON users.id = recipes.user_id
+	LEFT JOIN (
+	    SELECT recipe_id, SUM(MATCH(name) AGAINST (? IN NATURAL LANGUAGE MODE)) AS score
+	    FROM ingredients
+	    WHERE MATCH(name) AGAINST (? IN NATURAL LANGUAGE MODE)
+	    GROUP BY recipe_id
+	) matched_ingredients ON matched_ingredients.recipe_id = recipes.id
+	LEFT JOIN (
+	    SELECT recipe_id, SUM(MATCH(direction) AGAINST (? IN NATURAL LANGUAGE MODE)) AS score
+	    FROM directions
+	    WHERE MATCH(direction) AGAINST (? IN NATURAL LANGUAGE MODE)
+	    GROUP BY recipe_id
+	) matched_directions ON matched_directions.recipe_id = recipes.id
+	WHERE MATCH(recipes.title) AGAINST (? IN NATURAL LANGUAGE MODE)
+	   OR matched_ingredients.recipe_id IS NOT NULL
+	   OR matched_directions.recipe_id IS NOT NULL
+`
+
+// SearchRecipes gets a page of the recipes matching query, most relevant first, along with the number of matches
+func (dbRepo *mysqlDBRepo) SearchRecipes(query string, offset, limit int) ([]models.Recipe, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	terms := strings.Join(searchTerms(query), " ")
+	if terms == "" {
+		return nil, 0, nil
+	}
+
+	var total int
+	err := dbRepo.DB.QueryRowContext(ctx, "SELECT COUNT(*)"+mysqlSearchFrom, terms, terms, terms, terms, terms).Scan(&total)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	statement := fmt.Sprintf(`
+		SELECT
+		    recipes.id, recipes.title, recipes.image_key, recipes.created_at, recipes.updated_at, recipes.user_id, users.name
+		%s
+		ORDER BY
+		    MATCH(recipes.title) AGAINST (? IN NATURAL LANGUAGE MODE) * %d
+		    + COALESCE(matched_ingredients.score, 0) * %d
+		    + COALESCE(matched_directions.score, 0) * %d DESC,
+		    recipes.id DESC
+		LIMIT ? OFFSET ?
+	`, mysqlSearchFrom, searchTitleWeight, searchIngredientsWeight, searchDirectionsWeight)
+	rows, err := dbRepo.DB.QueryContext(ctx, statement, terms, terms, terms, terms, terms, terms, limit, offset)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	recipes, err := scanMysqlRecipeList(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return recipes, total, nil
+}
+
+// scanMysqlRecipeList scans rows selected by recipeListStatement
+func scanMysqlRecipeList(rows *sql.Rows) ([]models.Recipe, error) {
 	var recipes []models.Recipe
 	for rows.Next() {
-		var id, userId int
+		var recipe models.Recipe
 		var createdAt, updatedAt []byte
-		var title, image string
-
-		err = rows.Scan(
-			&id, &image, &title, &createdAt, &updatedAt, &userId,
+		err := rows.Scan(
+			&recipe.ID, &recipe.Title, &recipe.Image, &createdAt, &updatedAt, &recipe.UserId, &recipe.User.Name,
 		)
-
 		if err != nil {
-			fmt.Println(err)
+			log.Println(err)
 			return nil, err
 		}
 
-		parsedCreated, err := time.Parse("2006-01-02 15:04:05", string(createdAt))
+		recipe.CreatedAt, err = time.Parse("2006-01-02 15:04:05", string(createdAt))
 		if err != nil {
 			fmt.Println("Error parsing created at")
 			return nil, err
 		}
-		parsedUpdated, err := time.Parse("2006-01-02 15:04:05", string(updatedAt))
+		recipe.UpdatedAt, err = time.Parse("2006-01-02 15:04:05", string(updatedAt))
 		if err != nil {
 			fmt.Println("Error parsing updated at")
 			return nil, err
 		}
-		recipe := models.Recipe{
-			ID:        id,
-			Image:     image,
-			Title:     title,
-			CreatedAt: parsedCreated,
-			UpdatedAt: parsedUpdated,
-			UserId:    userId,
-		}
-
-		var user models.User
-		userStatemet := `
-			SELECT name
-			FROM 
-			    users
-			WHERE
-			    users.id = ?
-		`
-
-		userRow := dbRepo.DB.QueryRowContext(ctx, userStatemet, recipe.UserId)
-		err = userRow.Scan(&user.Name)
-		if err != nil {
-			fmt.Println(err)
-			return nil, err
-		}
-
-		recipe.User = user
 		recipes = append(recipes, recipe)
 	}
-	err = rows.Err()
+	err := rows.Err()
 	if err != nil {
 		return nil, err
 	}
@@ -91,20 +167,31 @@ func (dbRepo *mysqlDBRepo) GetRecipeDetails(recipeId int) (models.Recipe, error)
 
 	recipeStatement := `
 		SELECT
-			id, title, image, user_id
+			id, title, image_key, servings, user_id, created_at, updated_at
 		FROM
 		    recipes
 		WHERE
 		    recipes.id = ?
 	`
 	var recipe models.Recipe
+	var createdAt, updatedAt []byte
 
 	recipeRow := dbRepo.DB.QueryRowContext(ctx, recipeStatement, recipeId)
-	err := recipeRow.Scan(&recipe.ID, &recipe.Title, &recipe.Image, &recipe.UserId)
+	err := recipeRow.Scan(&recipe.ID, &recipe.Title, &recipe.Image, &recipe.Servings, &recipe.UserId, &createdAt, &updatedAt)
 	if err != nil {
 		fmt.Println(err)
 		return recipe, err
 	}
+	recipe.CreatedAt, err = time.Parse("2006-01-02 15:04:05", string(createdAt))
+	if err != nil {
+		fmt.Println("Error parsing created at")
+		return recipe, err
+	}
+	recipe.UpdatedAt, err = time.Parse("2006-01-02 15:04:05", string(updatedAt))
+	if err != nil {
+		fmt.Println("Error parsing updated at")
+		return recipe, err
+	}
 
 	// Get User
 	userStatement := `
@@ -125,121 +212,36 @@ func (dbRepo *mysqlDBRepo) GetRecipeDetails(recipeId int) (models.Recipe, error)
 	}
 	recipe.User = user
 
-	// Get ingredients
-	ingStatement := `
-			SELECT
-		    	id, name,amount, unit
-			FROM
-		    	ingredients
-			WHERE
-		    	recipe_id = ?
-		`
-	var ingredients []models.Ingredient
-	ingredientRows, err := dbRepo.DB.QueryContext(ctx, ingStatement, recipeId)
-	for ingredientRows.Next() {
-		var ingredient models.Ingredient
-		err = ingredientRows.Scan(
-			&ingredient.ID, &ingredient.Name, &ingredient.Amount, &ingredient.Unit,
-		)
-		if err != nil {
-			log.Fatal("Ingredient scan error")
-		}
-		ingredients = append(ingredients, ingredient)
-	}
-
-	//Get directions
-	dirStatement := `
-			SELECT
-		    	id, direction
-			FROM
-		    	directions
-			WHERE
-		    	recipe_id = ?
-		`
-	var directions []models.Direction
-	directionRows, err := dbRepo.DB.QueryContext(ctx, dirStatement, recipeId)
-	for directionRows.Next() {
-		var direction models.Direction
-		err = directionRows.Scan(
-			&direction.ID, &direction.Direction,
-		)
-		if err != nil {
-			log.Fatal("Direction scan error")
-		}
-		directions = append(directions, direction)
-	}
-
-	recipe.Ingredients = ingredients
-	recipe.Directions = directions
-	return recipe, nil
-}
-
-func (dbRepo *mysqlDBRepo) InsertRecipe(title string, image string, userId int) (int64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	statement :=
-		`INSERT INTO recipes (title,image,user_id, created_at, updated_at)
- 		VALUES (?,?,?,?,?)
-		`
-	res, err := dbRepo.DB.ExecContext(ctx, statement, title, image, userId, time.Now(), time.Now())
+	recipe.Ingredients, err = getIngredients(ctx, dbRepo.DB, recipeId)
 	if err != nil {
-		log.Println("Error inserting user", err)
-		return -1, err
+		log.Println("Error getting ingredients", err)
+		return recipe, err
 	}
 
-	newId, err := res.LastInsertId()
+	recipe.Directions, err = getDirections(ctx, dbRepo.DB, recipeId)
 	if err != nil {
-		return -1, err
+		log.Println("Error getting directions", err)
+		return recipe, err
 	}
 
-	return newId, nil
-}
-
-// InsertIngredient handles inserting an ingredient into the database
-func (dbRepo *mysqlDBRepo) InsertIngredient(name, amount, unit string, recipeId int64) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	statement :=
-		`INSERT INTO ingredients (name,amount,unit,recipe_id, created_at, updated_at)
- 		VALUES (?,?,?,?,?,?)
-		`
-	_, err := dbRepo.DB.ExecContext(ctx, statement, name, amount, unit, recipeId, time.Now(), time.Now())
+	err = getRecipePhotos(ctx, dbRepo.DB, &recipe)
 	if err != nil {
-		fmt.Println(err)
-		return err
-	}
-	return nil
-}
-
-// InsertDirection handles inserting a direction into the database
-func (dbRepo *mysqlDBRepo) InsertDirection(direction string, recipeId int64) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	statement :=
-		`INSERT INTO directions (direction,recipe_id, created_at, updated_at)
- 		VALUES (?,?,?,?)
-		`
-	_, err := dbRepo.DB.ExecContext(ctx, statement, direction, recipeId, time.Now(), time.Now())
-	if err != nil {
-		fmt.Println(err)
-		return err
+		log.Println("Error getting photos", err)
+		return recipe, err
 	}
-	return nil
+	return recipe, nil
 }
 
 // GetUserByEmail looks up a user by email
 func (dbRepo *mysqlDBRepo) GetUserByEmail(email, password string) (models.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	row := dbRepo.DB.QueryRowContext(ctx, `SELECT id, name, image, email, password, created_at, updated_at FROM users WHERE email = ?`, email)
+	row := dbRepo.DB.QueryRowContext(ctx, `SELECT id, name, image, email, password, disabled, created_at, updated_at FROM users WHERE email = ?`, email)
 
 	var user models.User
 	var createdAt, updatedAt []byte
 
-	err := row.Scan(&user.ID, &user.Name, &user.Image, &user.Email, &user.Password, &createdAt, &updatedAt)
+	err := row.Scan(&user.ID, &user.Name, &user.Image, &user.Email, &user.Password, &user.Disabled, &createdAt, &updatedAt)
 	if err != nil {
 		log.Println("Error scanning", err)
 		return models.User{}, err
@@ -266,16 +268,29 @@ func (dbRepo *mysqlDBRepo) GetUserByEmail(email, password string) (models.User,
 	return user, nil
 }
 
-// InsertUser inserts a new user into the DB
+// InsertUser inserts a new user into the DB, the first user to sign up becomes an admin
 func (dbRepo *mysqlDBRepo) InsertUser(name, email, password string) (models.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
+
+	tx, err := dbRepo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.User{}, err
+	}
+	defer tx.Rollback()
+
+	err = lockAdminRole(ctx, tx)
+	if err != nil {
+		log.Println("Error locking admin role", err)
+		return models.User{}, err
+	}
+
 	statement :=
 		`INSERT INTO users (name, image,email, password, created_at, updated_at)
  		VALUES (?,?,?,?,?,?)
 		`
 
-	res, err := dbRepo.DB.ExecContext(ctx, statement, name, "", email, password, time.Now(), time.Now())
+	res, err := tx.ExecContext(ctx, statement, name, "", email, password, time.Now(), time.Now())
 
 	if err != nil {
 		log.Println("Error inserting user", err)
@@ -289,7 +304,13 @@ func (dbRepo *mysqlDBRepo) InsertUser(name, email, password string) (models.User
 		return models.User{}, err
 	}
 
-	row := dbRepo.DB.QueryRowContext(ctx, `SELECT * FROM users WHERE id = ?`, newId)
+	err = grantFirstUserAdmin(ctx, tx, int(newId))
+	if err != nil {
+		log.Println("Error granting admin role", err)
+		return models.User{}, err
+	}
+
+	row := tx.QueryRowContext(ctx, `SELECT id, name, image, email, password, created_at, updated_at FROM users WHERE id = ?`, newId)
 	var user models.User
 	var createdAt, updatedAt []byte
 
@@ -310,45 +331,170 @@ func (dbRepo *mysqlDBRepo) InsertUser(name, email, password string) (models.User
 		log.Println("Error parsing time", err)
 		return models.User{}, err
 	}
+
+	user.Roles, err = getUserRoles(ctx, tx, user.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return models.User{}, err
+	}
 	return user, nil
 }
 
-func (dbRepo *mysqlDBRepo) UpdateRecipe(jsonRecipe models.JsonRecipe) (models.Recipe, error) {
+// ListUsers gets every user whose name or email contains search, along with their roles
+func (dbRepo *mysqlDBRepo) ListUsers(search string) ([]models.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	statement := `UPDATE recipes SET title = ?, image=?, updated_at = ? WHERE id = ?`
-	_, err := dbRepo.DB.ExecContext(ctx, statement, jsonRecipe.Title, jsonRecipe.Image, time.Now(), jsonRecipe.ID)
+	statement := `
+		SELECT
+		    id, name, email, disabled, created_at, updated_at
+		FROM
+		    users
+		WHERE
+		    name LIKE ? OR email LIKE ?
+		ORDER BY id
+	`
+	pattern := "%" + search + "%"
+	rows, err := dbRepo.DB.QueryContext(ctx, statement, pattern, pattern)
 	if err != nil {
-		return models.Recipe{}, err
+		log.Println(err)
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Delete old ingredients
-	deleteIngredients := `DELETE FROM ingredients WHERE recipe_id = ?`
-	_, err = dbRepo.DB.ExecContext(ctx, deleteIngredients, jsonRecipe.ID)
+	userRoles, err := getAllUserRoles(ctx, dbRepo.DB)
 	if err != nil {
-		return models.Recipe{}, err
+		return nil, err
 	}
 
-	// Delete old directions
-	deleteDirections := `DELETE FROM directions WHERE recipe_id = ?`
-	_, err = dbRepo.DB.ExecContext(ctx, deleteDirections, jsonRecipe.ID)
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		var createdAt, updatedAt []byte
+
+		err = rows.Scan(&user.ID, &user.Name, &user.Email, &user.Disabled, &createdAt, &updatedAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+
+		user.CreatedAt, err = time.Parse("2006-01-02 15:04:05", string(createdAt))
+		if err != nil {
+			log.Println("Error parsing time", err)
+			return nil, err
+		}
+
+		user.UpdatedAt, err = time.Parse("2006-01-02 15:04:05", string(updatedAt))
+		if err != nil {
+			log.Println("Error parsing time", err)
+			return nil, err
+		}
+
+		user.Roles = userRoles[user.ID]
+		users = append(users, user)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetAdminActions gets the most recent admin actions, newest first
+func (dbRepo *mysqlDBRepo) GetAdminActions(limit int) ([]models.AdminAction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	statement := `
+		SELECT
+		    id, COALESCE(admin_id, 0), admin_name, action, target_type, target_id, details, created_at
+		FROM
+		    admin_actions
+		ORDER BY id DESC
+		LIMIT ?
+	`
+	rows, err := dbRepo.DB.QueryContext(ctx, statement, limit)
 	if err != nil {
-		return models.Recipe{}, err
+		log.Println(err)
+		return nil, err
 	}
+	defer rows.Close()
+
+	var actions []models.AdminAction
+	for rows.Next() {
+		var action models.AdminAction
+		var createdAt []byte
+
+		err = rows.Scan(&action.ID, &action.AdminID, &action.AdminName, &action.Action, &action.TargetType,
+			&action.TargetID, &action.Details, &createdAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
 
-	return models.Recipe{}, err
+		action.CreatedAt, err = time.Parse("2006-01-02 15:04:05", string(createdAt))
+		if err != nil {
+			log.Println("Error parsing time", err)
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return actions, nil
 }
 
-func (dbRepo *mysqlDBRepo) DeleteRecipe(id int) error {
+// ListApiTokens gets the API tokens of a user, newest first
+func (dbRepo *mysqlDBRepo) ListApiTokens(userId int) ([]models.ApiToken, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	statement := `DELETE FROM recipes WHERE id = ?`
-	_, err := dbRepo.DB.ExecContext(ctx, statement, id)
+	statement := `
+		SELECT
+		    id, user_id, name, last_used_at, created_at
+		FROM
+		    api_tokens
+		WHERE
+		    user_id = ?
+		ORDER BY id DESC
+	`
+	rows, err := dbRepo.DB.QueryContext(ctx, statement, userId)
 	if err != nil {
-		return err
+		log.Println(err)
+		return nil, err
 	}
+	defer rows.Close()
+
+	var tokens []models.ApiToken
+	for rows.Next() {
+		var token models.ApiToken
+		var lastUsedAt, createdAt []byte
+		err = rows.Scan(&token.ID, &token.UserID, &token.Name, &lastUsedAt, &createdAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
 
-	return nil
+		// last_used_at is NULL until the token is used
+		if lastUsedAt != nil {
+			token.LastUsedAt, err = time.Parse("2006-01-02 15:04:05", string(lastUsedAt))
+			if err != nil {
+				log.Println("Error parsing time", err)
+				return nil, err
+			}
+		}
+		token.CreatedAt, err = time.Parse("2006-01-02 15:04:05", string(createdAt))
+		if err != nil {
+			log.Println("Error parsing time", err)
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
 }
@@ -0,0 +1,74 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"log"
+	"time"
+)
+
+// quantityBatch is how many ingredients ParseQuantities reads at a time
+const quantityBatch = 500
+
+// unparsedAmount is the amount of an ingredient saved before quantities were stored next to amounts
+type unparsedAmount struct {
+	ingredientID int
+	amount       string
+}
+
+// parseQuantitiesMigration is the name ParseQuantities is recorded under in data_migrations
+const parseQuantitiesMigration = "parse_quantities"
+
+// ParseQuantities stores the quantities of the ingredients saved before quantities were stored next to their amounts.
+// It runs once for a database of either driver, data_migrations records that it ran.
+// Amounts that can't be parsed are logged and stored as no quantity. It returns how many it parsed.
+func ParseQuantities(conn *sql.DB) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	done, err := dataMigrated(ctx, conn, parseQuantitiesMigration)
+	if err != nil || done {
+		return 0, err
+	}
+	ingredientID := func(amount unparsedAmount) int { return amount.ingredientID }
+	parsed, err := migrateInBatches(ctx, conn, unparsedAmounts, ingredientID, func(amount unparsedAmount) (bool, error) {
+		quantity, err := models.ParseQuantity(amount.amount)
+		if err != nil {
+			log.Println("Error parsing the amount of ingredient", amount.ingredientID, err)
+		}
+
+		// updated_at is left alone, the ingredient didn't change
+		_, err = conn.ExecContext(ctx, `UPDATE ingredients SET quantity_min = ?, quantity_max = ?, to_taste = ? WHERE id = ?`,
+			quantity.Min, quantity.Max, quantity.ToTaste, amount.ingredientID)
+		return err == nil, err
+	})
+	if err != nil {
+		return parsed, err
+	}
+	return parsed, recordDataMigration(ctx, conn, parseQuantitiesMigration)
+}
+
+// unparsedAmounts reads the next batch of ingredients after lastID without a quantity
+func unparsedAmounts(ctx context.Context, conn *sql.DB, lastID int) ([]unparsedAmount, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT id, amount FROM ingredients
+		WHERE id > ? AND quantity_min IS NULL
+		ORDER BY id
+		LIMIT ?`, lastID, quantityBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var amounts []unparsedAmount
+	for rows.Next() {
+		var amount unparsedAmount
+		err = rows.Scan(&amount.ingredientID, &amount.amount)
+		if err != nil {
+			return nil, err
+		}
+		amounts = append(amounts, amount)
+	}
+	return amounts, rows.Err()
+}
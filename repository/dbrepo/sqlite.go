@@ -0,0 +1,435 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"io/fs"
+	"log"
+	"path"
+	"strings"
+	"time"
+)
+
+//go:embed sqlite_migrations/*.sql
+var sqliteMigrations embed.FS
+
+// MigrateSqlite applies the embedded SQLite migrations that have not been run yet.
+// Versions are recorded in schema_migration, the same table soda uses for the fizz migrations.
+func MigrateSqlite(conn *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migration (version TEXT NOT NULL PRIMARY KEY)`)
+	if err != nil {
+		return err
+	}
+
+	// fs.Glob returns the files in lexical order, which is also version order
+	files, err := fs.Glob(sqliteMigrations, "sqlite_migrations/*.sql")
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		version, _, _ := strings.Cut(path.Base(file), "_")
+
+		var applied int
+		row := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migration WHERE version = ?`, version)
+		err = row.Scan(&applied)
+		if err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+
+		statements, err := sqliteMigrations.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, string(statements))
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `INSERT INTO schema_migration (version) VALUES (?)`, version)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			log.Println("Error applying migration", file, err)
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+		log.Println("Applied migration", file)
+	}
+	return nil
+}
+
+// GetAllRecipes gets every recipe along with the name of its author
+func (dbRepo *sqliteDBRepo) GetAllRecipes() ([]models.Recipe, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := dbRepo.DB.QueryContext(ctx, `
+		SELECT
+		    recipes.id, recipes.title, recipes.image_key, recipes.created_at, recipes.updated_at, recipes.user_id, users.name
+		FROM recipes
+		JOIN users ON users.id = recipes.user_id
+		ORDER BY recipes.id
+	`)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSqliteRecipeList(rows)
+}
+
+// ListRecipes gets a page of recipes in the given sort order, along with the total number of recipes
+func (dbRepo *sqliteDBRepo) ListRecipes(offset, limit int, sort string) ([]models.Recipe, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	statement, err := recipeListStatement(sort)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := countRecipes(ctx, dbRepo.DB)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	rows, err := dbRepo.DB.QueryContext(ctx, statement, limit, offset)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	recipes, err := scanSqliteRecipeList(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return recipes, total, nil
+}
+
+// SearchRecipes gets a page of the recipes matching query, most relevant first, along with the number of matches.
+// It searches the recipe_search FTS5 table, which stands in for the MySQL FULLTEXT indexes.
+func (dbRepo *sqliteDBRepo) SearchRecipes(query string, offset, limit int) ([]models.Recipe, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, 0, nil
+	}
+	// Quoting each term keeps FTS5 from reading it as query syntax, any term may match
+	match := `"` + strings.Join(terms, `" OR "`) + `"`
+
+	var total int
+	err := dbRepo.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM recipe_search WHERE recipe_search MATCH ?`, match).Scan(&total)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	// bm25 ranks better matches lower
+	statement := fmt.Sprintf(`
+		SELECT
+		    recipes.id, recipes.title, recipes.image_key, recipes.created_at, recipes.updated_at, recipes.user_id, users.name
+		FROM recipe_search
+		JOIN recipes ON recipes.id = recipe_search.rowid
+		JOIN users ON users.id = recipes.user_id
+		WHERE recipe_search MATCH ?
+		ORDER BY bm25(recipe_search, %d, %d, %d), recipes.id DESC
+		LIMIT ? OFFSET ?
+	`, searchTitleWeight, searchIngredientsWeight, searchDirectionsWeight)
+	rows, err := dbRepo.DB.QueryContext(ctx, statement, match, limit, offset)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	recipes, err := scanSqliteRecipeList(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return recipes, total, nil
+}
+
+// scanSqliteRecipeList scans rows selected by recipeListStatement
+func scanSqliteRecipeList(rows *sql.Rows) ([]models.Recipe, error) {
+	var recipes []models.Recipe
+	for rows.Next() {
+		var recipe models.Recipe
+		err := rows.Scan(
+			&recipe.ID, &recipe.Title, &recipe.Image, &recipe.CreatedAt, &recipe.UpdatedAt, &recipe.UserId, &recipe.User.Name,
+		)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		recipes = append(recipes, recipe)
+	}
+	err := rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return recipes, nil
+}
+
+// GetRecipeDetails gets a recipe by ID
+func (dbRepo *sqliteDBRepo) GetRecipeDetails(recipeId int) (models.Recipe, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	recipeStatement := `
+		SELECT
+			recipes.id, recipes.title, recipes.image_key, recipes.servings, recipes.user_id, recipes.created_at,
+			recipes.updated_at, users.id, users.name, users.email
+		FROM
+		    recipes
+		JOIN users ON users.id = recipes.user_id
+		WHERE
+		    recipes.id = ?
+	`
+	var recipe models.Recipe
+
+	recipeRow := dbRepo.DB.QueryRowContext(ctx, recipeStatement, recipeId)
+	err := recipeRow.Scan(&recipe.ID, &recipe.Title, &recipe.Image, &recipe.Servings, &recipe.UserId, &recipe.CreatedAt,
+		&recipe.UpdatedAt, &recipe.User.ID, &recipe.User.Name, &recipe.User.Email)
+	if err != nil {
+		log.Println(err)
+		return recipe, err
+	}
+
+	recipe.Ingredients, err = getIngredients(ctx, dbRepo.DB, recipeId)
+	if err != nil {
+		log.Println("Error getting ingredients", err)
+		return recipe, err
+	}
+
+	recipe.Directions, err = getDirections(ctx, dbRepo.DB, recipeId)
+	if err != nil {
+		log.Println("Error getting directions", err)
+		return recipe, err
+	}
+
+	err = getRecipePhotos(ctx, dbRepo.DB, &recipe)
+	if err != nil {
+		log.Println("Error getting photos", err)
+		return recipe, err
+	}
+
+	return recipe, nil
+}
+
+// GetUserByEmail looks up a user by email
+func (dbRepo *sqliteDBRepo) GetUserByEmail(email, password string) (models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	row := dbRepo.DB.QueryRowContext(ctx, `SELECT id, name, image, email, password, disabled, created_at, updated_at FROM users WHERE email = ?`, email)
+
+	var user models.User
+	err := row.Scan(&user.ID, &user.Name, &user.Image, &user.Email, &user.Password, &user.Disabled, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		log.Println("Error scanning", err)
+		return models.User{}, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if err != nil {
+		log.Println(err)
+		return models.User{}, errors.New("incorrect password")
+	}
+
+	return user, nil
+}
+
+// InsertUser inserts a new user into the DB, the first user to sign up becomes an admin
+func (dbRepo *sqliteDBRepo) InsertUser(name, email, password string) (models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := dbRepo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.User{}, err
+	}
+	defer tx.Rollback()
+
+	statement :=
+		`INSERT INTO users (name, image, email, password, created_at, updated_at)
+ 		VALUES (?,?,?,?,?,?)
+		`
+
+	res, err := tx.ExecContext(ctx, statement, name, []byte{}, email, password, time.Now(), time.Now())
+	if err != nil {
+		log.Println("Error inserting user", err)
+		return models.User{}, err
+	}
+
+	newId, err := res.LastInsertId()
+	if err != nil {
+		log.Println("Error inserting user", err)
+		return models.User{}, err
+	}
+
+	err = grantFirstUserAdmin(ctx, tx, int(newId))
+	if err != nil {
+		log.Println("Error granting admin role", err)
+		return models.User{}, err
+	}
+
+	row := tx.QueryRowContext(ctx, `SELECT id, name, image, email, password, created_at, updated_at FROM users WHERE id = ?`, newId)
+	var user models.User
+	err = row.Scan(&user.ID, &user.Name, &user.Image, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		log.Println("Error fetching newly created user", err)
+		return models.User{}, err
+	}
+
+	user.Roles, err = getUserRoles(ctx, tx, user.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// ListUsers gets every user whose name or email contains search, along with their roles
+func (dbRepo *sqliteDBRepo) ListUsers(search string) ([]models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Read the roles first, SQLite only has one connection
+	userRoles, err := getAllUserRoles(ctx, dbRepo.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := `
+		SELECT
+		    id, name, email, disabled, created_at, updated_at
+		FROM
+		    users
+		WHERE
+		    name LIKE ? OR email LIKE ?
+		ORDER BY id
+	`
+	pattern := "%" + search + "%"
+	rows, err := dbRepo.DB.QueryContext(ctx, statement, pattern, pattern)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		err = rows.Scan(&user.ID, &user.Name, &user.Email, &user.Disabled, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		user.Roles = userRoles[user.ID]
+		users = append(users, user)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetAdminActions gets the most recent admin actions, newest first
+func (dbRepo *sqliteDBRepo) GetAdminActions(limit int) ([]models.AdminAction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	statement := `
+		SELECT
+		    id, COALESCE(admin_id, 0), admin_name, action, target_type, target_id, details, created_at
+		FROM
+		    admin_actions
+		ORDER BY id DESC
+		LIMIT ?
+	`
+	rows, err := dbRepo.DB.QueryContext(ctx, statement, limit)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var actions []models.AdminAction
+	for rows.Next() {
+		var action models.AdminAction
+		err = rows.Scan(&action.ID, &action.AdminID, &action.AdminName, &action.Action, &action.TargetType,
+			&action.TargetID, &action.Details, &action.CreatedAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return actions, nil
+}
+
+// ListApiTokens gets the API tokens of a user, newest first
+func (dbRepo *sqliteDBRepo) ListApiTokens(userId int) ([]models.ApiToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	statement := `
+		SELECT
+		    id, user_id, name, last_used_at, created_at
+		FROM
+		    api_tokens
+		WHERE
+		    user_id = ?
+		ORDER BY id DESC
+	`
+	rows, err := dbRepo.DB.QueryContext(ctx, statement, userId)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []models.ApiToken
+	for rows.Next() {
+		var token models.ApiToken
+		var lastUsedAt sql.NullTime
+		err = rows.Scan(&token.ID, &token.UserID, &token.Name, &lastUsedAt, &token.CreatedAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		token.LastUsedAt = lastUsedAt.Time
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
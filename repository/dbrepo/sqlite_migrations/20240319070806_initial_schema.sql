@@ -0,0 +1,66 @@
+-- Mirrors the fizz migrations in /migrations up to and including 20240319070806_add_user_index
+CREATE TABLE users
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    name       TEXT     NOT NULL,
+    email      TEXT     NOT NULL,
+    password   TEXT     NOT NULL,
+    image      BLOB     NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE UNIQUE INDEX users_email_idx ON users (email);
+
+CREATE TABLE recipes
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    title      TEXT     NOT NULL DEFAULT '',
+    image      BLOB     NOT NULL,
+    user_id    INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX recipes_users_id_fk ON recipes (user_id);
+
+CREATE TABLE ingredients
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    name       TEXT     NOT NULL,
+    unit       TEXT     NOT NULL,
+    amount     TEXT     NOT NULL,
+    recipe_id  INTEGER  NOT NULL REFERENCES recipes (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX ingredients_recipes_id_fk ON ingredients (recipe_id);
+
+CREATE TABLE directions
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    direction  TEXT     NOT NULL,
+    recipe_id  INTEGER  NOT NULL REFERENCES recipes (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX directions_recipes_id_fk ON directions (recipe_id);
+
+CREATE TABLE roles
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    role       TEXT     NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE user_roles
+(
+    user_id    INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    role_id    INTEGER  NOT NULL REFERENCES roles (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (user_id, role_id)
+);
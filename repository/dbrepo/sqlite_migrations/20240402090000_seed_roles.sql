@@ -0,0 +1,5 @@
+CREATE UNIQUE INDEX roles_role_idx ON roles (role);
+
+INSERT INTO roles (role, created_at, updated_at)
+VALUES ('admin', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+       ('editor', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
@@ -0,0 +1,15 @@
+-- Includes the foreign key from 20240403091500_create_fk_for_admin_actions_table, SQLite can't add it later
+CREATE TABLE admin_actions
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    admin_id    INTEGER REFERENCES users (id) ON DELETE SET NULL ON UPDATE CASCADE,
+    admin_name  TEXT     NOT NULL,
+    action      TEXT     NOT NULL,
+    target_type TEXT     NOT NULL,
+    target_id   INTEGER  NOT NULL,
+    details     TEXT     NOT NULL DEFAULT '',
+    created_at  DATETIME NOT NULL,
+    updated_at  DATETIME NOT NULL
+);
+
+CREATE INDEX admin_actions_created_at_idx ON admin_actions (created_at);
@@ -0,0 +1,3 @@
+CREATE INDEX recipes_created_at_idx ON recipes (created_at);
+CREATE INDEX recipes_updated_at_idx ON recipes (updated_at);
+CREATE INDEX recipes_title_idx ON recipes (title);
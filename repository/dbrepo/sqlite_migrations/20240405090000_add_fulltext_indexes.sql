@@ -0,0 +1,67 @@
+-- SQLite has no FULLTEXT indexes, an FTS5 table kept up to date by triggers takes their place.
+-- Each row holds the title, ingredient names and directions of the recipe with the same rowid.
+CREATE VIRTUAL TABLE recipe_search USING fts5(title, ingredients, directions);
+
+INSERT INTO recipe_search (rowid, title, ingredients, directions)
+SELECT id,
+       title,
+       COALESCE((SELECT group_concat(name, ' ') FROM ingredients WHERE recipe_id = recipes.id), ''),
+       COALESCE((SELECT group_concat(direction, ' ') FROM directions WHERE recipe_id = recipes.id), '')
+FROM recipes;
+
+CREATE TRIGGER recipes_search_insert AFTER INSERT ON recipes
+BEGIN
+    INSERT INTO recipe_search (rowid, title, ingredients, directions) VALUES (NEW.id, NEW.title, '', '');
+END;
+
+CREATE TRIGGER recipes_search_update AFTER UPDATE OF title ON recipes
+BEGIN
+    UPDATE recipe_search SET title = NEW.title WHERE rowid = NEW.id;
+END;
+
+CREATE TRIGGER recipes_search_delete AFTER DELETE ON recipes
+BEGIN
+    DELETE FROM recipe_search WHERE rowid = OLD.id;
+END;
+
+CREATE TRIGGER ingredients_search_insert AFTER INSERT ON ingredients
+BEGIN
+    UPDATE recipe_search
+    SET ingredients = (SELECT group_concat(name, ' ') FROM ingredients WHERE recipe_id = NEW.recipe_id)
+    WHERE rowid = NEW.recipe_id;
+END;
+
+CREATE TRIGGER ingredients_search_update AFTER UPDATE OF name ON ingredients
+BEGIN
+    UPDATE recipe_search
+    SET ingredients = (SELECT group_concat(name, ' ') FROM ingredients WHERE recipe_id = NEW.recipe_id)
+    WHERE rowid = NEW.recipe_id;
+END;
+
+CREATE TRIGGER ingredients_search_delete AFTER DELETE ON ingredients
+BEGIN
+    UPDATE recipe_search
+    SET ingredients = COALESCE((SELECT group_concat(name, ' ') FROM ingredients WHERE recipe_id = OLD.recipe_id), '')
+    WHERE rowid = OLD.recipe_id;
+END;
+
+CREATE TRIGGER directions_search_insert AFTER INSERT ON directions
+BEGIN
+    UPDATE recipe_search
+    SET directions = (SELECT group_concat(direction, ' ') FROM directions WHERE recipe_id = NEW.recipe_id)
+    WHERE rowid = NEW.recipe_id;
+END;
+
+CREATE TRIGGER directions_search_update AFTER UPDATE OF direction ON directions
+BEGIN
+    UPDATE recipe_search
+    SET directions = (SELECT group_concat(direction, ' ') FROM directions WHERE recipe_id = NEW.recipe_id)
+    WHERE rowid = NEW.recipe_id;
+END;
+
+CREATE TRIGGER directions_search_delete AFTER DELETE ON directions
+BEGIN
+    UPDATE recipe_search
+    SET directions = COALESCE((SELECT group_concat(direction, ' ') FROM directions WHERE recipe_id = OLD.recipe_id), '')
+    WHERE rowid = OLD.recipe_id;
+END;
@@ -0,0 +1,13 @@
+-- Includes the foreign key from 20240406090500_create_fk_for_api_tokens_table, SQLite can't add it later
+CREATE TABLE api_tokens
+(
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id      INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    name         TEXT     NOT NULL,
+    token_hash   TEXT     NOT NULL,
+    last_used_at DATETIME,
+    created_at   DATETIME NOT NULL,
+    updated_at   DATETIME NOT NULL
+);
+
+CREATE UNIQUE INDEX api_tokens_token_hash_idx ON api_tokens (token_hash);
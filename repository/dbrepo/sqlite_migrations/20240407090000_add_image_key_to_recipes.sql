@@ -0,0 +1 @@
+ALTER TABLE recipes ADD COLUMN image_key TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,13 @@
+-- Includes the foreign key from 20240408090500_create_fk_for_recipe_photos_table, SQLite can't add it later
+CREATE TABLE recipe_photos
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    recipe_id  INTEGER  NOT NULL REFERENCES recipes (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    image_key  TEXT     NOT NULL,
+    caption    TEXT     NOT NULL DEFAULT '',
+    position   INTEGER  NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX recipe_photos_recipe_id_position_idx ON recipe_photos (recipe_id, position);
@@ -0,0 +1,13 @@
+-- Includes the foreign key from 20240408091500_create_fk_for_direction_photos_table, SQLite can't add it later
+CREATE TABLE direction_photos
+(
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    direction_id INTEGER  NOT NULL REFERENCES directions (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    image_key    TEXT     NOT NULL,
+    caption      TEXT     NOT NULL DEFAULT '',
+    position     INTEGER  NOT NULL DEFAULT 0,
+    created_at   DATETIME NOT NULL,
+    updated_at   DATETIME NOT NULL
+);
+
+CREATE INDEX direction_photos_direction_id_position_idx ON direction_photos (direction_id, position);
@@ -0,0 +1,6 @@
+-- Rows saved before there were positions are all at 0, they keep their order because reads order by position and then id
+ALTER TABLE ingredients ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE directions ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX ingredients_recipe_id_position_idx ON ingredients (recipe_id, position);
+CREATE INDEX directions_recipe_id_position_idx ON directions (recipe_id, position);
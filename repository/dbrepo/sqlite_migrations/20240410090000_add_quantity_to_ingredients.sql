@@ -0,0 +1,4 @@
+-- The quantity is parsed from the amount, NULL until ParseQuantities has parsed the amounts saved before there were quantities
+ALTER TABLE ingredients ADD COLUMN quantity_min REAL;
+ALTER TABLE ingredients ADD COLUMN quantity_max REAL;
+ALTER TABLE ingredients ADD COLUMN to_taste BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+ALTER TABLE recipes ADD COLUMN servings INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,11 @@
+-- Includes the foreign key from 20240412090500_create_fk_for_shopping_lists_table, SQLite can't add it later
+CREATE TABLE shopping_lists
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id    INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    name       TEXT     NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX shopping_lists_user_id_idx ON shopping_lists (user_id);
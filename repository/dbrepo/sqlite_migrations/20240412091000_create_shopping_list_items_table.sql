@@ -0,0 +1,16 @@
+-- Includes the foreign key from 20240412091500_create_fk_for_shopping_list_items_table, SQLite can't add it later
+CREATE TABLE shopping_list_items
+(
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    shopping_list_id INTEGER  NOT NULL REFERENCES shopping_lists (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    name             TEXT     NOT NULL,
+    amount           TEXT     NOT NULL DEFAULT '',
+    unit             TEXT     NOT NULL DEFAULT '',
+    section          TEXT     NOT NULL,
+    checked          BOOLEAN  NOT NULL DEFAULT FALSE,
+    position         INTEGER  NOT NULL DEFAULT 0,
+    created_at       DATETIME NOT NULL,
+    updated_at       DATETIME NOT NULL
+);
+
+CREATE INDEX shopping_list_items_shopping_list_id_position_idx ON shopping_list_items (shopping_list_id, position);
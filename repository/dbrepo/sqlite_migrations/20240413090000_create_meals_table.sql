@@ -0,0 +1,14 @@
+-- Includes the foreign keys from 20240413090500_create_fks_for_meals_table, SQLite can't add them later.
+-- Dates are stored as YYYY-MM-DD text, like MySQL returns its DATE columns.
+CREATE TABLE meals
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id    INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    recipe_id  INTEGER  NOT NULL REFERENCES recipes (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    date       TEXT     NOT NULL,
+    slot       TEXT     NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX meals_user_id_date_idx ON meals (user_id, date);
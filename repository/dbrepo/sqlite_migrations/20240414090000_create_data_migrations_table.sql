@@ -0,0 +1,9 @@
+CREATE TABLE data_migrations
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    name       TEXT     NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE UNIQUE INDEX data_migrations_name_idx ON data_migrations (name);
@@ -0,0 +1,13 @@
+-- Includes the foreign key from 20240415090500_create_fk_for_uploads_table, SQLite can't add it later
+CREATE TABLE uploads
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id    INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    image_key  TEXT     NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX uploads_user_id_created_at_idx ON uploads (user_id, created_at);
+CREATE INDEX uploads_created_at_idx ON uploads (created_at);
+CREATE INDEX uploads_image_key_idx ON uploads (image_key);
@@ -0,0 +1,1156 @@
+package dbrepo
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/popnfresh234/recipe-app-golang/internal/config"
+	"github.com/popnfresh234/recipe-app-golang/internal/driver"
+	"github.com/popnfresh234/recipe-app-golang/internal/images"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"github.com/popnfresh234/recipe-app-golang/internal/pantry"
+	"github.com/popnfresh234/recipe-app-golang/repository"
+	"golang.org/x/crypto/bcrypt"
+	"image"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSqliteTestRepo creates a migrated SQLite database in a temporary directory
+func newSqliteTestRepo(t *testing.T) repository.DatabaseRepo {
+	t.Helper()
+
+	db, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.SQL.Close() })
+
+	err = MigrateSqlite(db.SQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Running the migrations again does nothing
+	err = MigrateSqlite(db.SQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSqliteRepo(db.SQL, &config.AppConfig{})
+}
+
+func TestSqliteSaveRecipe(t *testing.T) {
+	repo := newSqliteTestRepo(t)
+	user, err := repo.InsertUser("Julia", "julia@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recipe := models.JsonRecipe{
+		Title:       "Tomato Soup",
+		Servings:    4,
+		Ingredients: []models.JsonIngredient{{Name: "tomatoes", Amount: "4", Unit: "whole"}},
+		Directions:  []models.JsonDirection{{Direction: "Chop"}, {Direction: "Simmer"}},
+		Image:       strings.Repeat("a", 64) + ".png",
+	}
+	id, err := repo.SaveRecipe(recipe, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recipe.ID = int(id)
+	recipe.Title = "Roasted Tomato Soup"
+	recipe.Servings = 6
+	recipe.Directions = []models.JsonDirection{{Direction: "Roast"}}
+	_, err = repo.SaveRecipe(recipe, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := repo.GetRecipeDetails(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Title != "Roasted Tomato Soup" || saved.Servings != 6 || saved.User.Name != "Julia" || saved.Image != recipe.Image {
+		t.Errorf("unexpected recipe %+v", saved)
+	}
+	if len(saved.Ingredients) != 1 || len(saved.Directions) != 1 || saved.Directions[0].Direction != "Roast" {
+		t.Errorf("expected ingredients and directions to be replaced, got %+v %+v", saved.Ingredients, saved.Directions)
+	}
+
+	// Saving a recipe that doesn't exist fails without writing anything
+	_, err = repo.SaveRecipe(models.JsonRecipe{ID: 999, Title: "Missing"}, user.ID)
+	if err == nil {
+		t.Error("expected an error saving a missing recipe")
+	}
+
+	// A new recipe for a missing user fails on the foreign key
+	_, err = repo.SaveRecipe(models.JsonRecipe{Title: "Orphan"}, 999)
+	if err == nil {
+		t.Error("expected an error saving a recipe for a missing user")
+	}
+	recipes, err := repo.GetAllRecipes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipes) != 1 {
+		t.Errorf("expected 1 recipe, got %d", len(recipes))
+	}
+}
+
+func TestSqliteUsers(t *testing.T) {
+	repo := newSqliteTestRepo(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := repo.InsertUser("Julia", "julia@example.com", string(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID == 0 || user.Name != "Julia" || user.CreatedAt.IsZero() {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	_, err = repo.InsertUser("Julia", "julia@example.com", string(hash))
+	if err == nil {
+		t.Error("expected an error inserting a second user with the same email")
+	}
+
+	found, err := repo.GetUserByEmail("julia@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != user.ID {
+		t.Errorf("expected user %d, got %d", user.ID, found.ID)
+	}
+	_, err = repo.GetUserByEmail("julia@example.com", "wrong")
+	if err == nil {
+		t.Error("expected an error for the wrong password")
+	}
+	_, err = repo.GetUserByEmail("nobody@example.com", "secret")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing user, got %v", err)
+	}
+
+	byId, err := repo.GetUserById(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byId.Email != "julia@example.com" || !byId.UpdatedAt.Equal(user.UpdatedAt) {
+		t.Errorf("unexpected user %+v", byId)
+	}
+}
+
+func TestSqliteDeleteRecipe(t *testing.T) {
+	repo := newSqliteTestRepo(t)
+	user, err := repo.InsertUser("Julia", "julia@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := repo.SaveRecipe(models.JsonRecipe{
+		Title:       "Tomato Soup",
+		Ingredients: []models.JsonIngredient{{Name: "tomatoes", Amount: "4"}},
+		Directions:  []models.JsonDirection{{Direction: "Simmer"}},
+	}, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.DeleteRecipe(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.GetRecipeDetails(int(id))
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for the deleted recipe, got %v", err)
+	}
+
+	// The foreign keys remove the ingredients and directions too
+	conn := repo.(*sqliteDBRepo).DB
+	var left int
+	_ = conn.QueryRow(`SELECT (SELECT COUNT(*) FROM ingredients) + (SELECT COUNT(*) FROM directions)`).Scan(&left)
+	if left != 0 {
+		t.Errorf("expected ingredients and directions to be deleted, %d left", left)
+	}
+}
+
+func TestSqliteRoles(t *testing.T) {
+	repo := newSqliteTestRepo(t)
+
+	first, err := repo.InsertUser("Ada", "ada@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.HasRole(models.RoleAdmin) {
+		t.Error("expected the first user to be an admin")
+	}
+
+	second, err := repo.InsertUser("Julia", "julia@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.HasRole(models.RoleAdmin) || second.Email != "julia@example.com" {
+		t.Errorf("unexpected second user %+v", second)
+	}
+
+	_, err = repo.InsertUser("Julia", "julia@example.com", "hash")
+	if err == nil {
+		t.Error("expected duplicate emails to be rejected")
+	}
+
+	// Assigning twice is allowed
+	for i := 0; i < 2; i++ {
+		err = repo.AssignRole(second.ID, models.RoleEditor)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = repo.AssignRole(second.ID, "chef")
+	if err == nil {
+		t.Error("expected unknown roles to be rejected")
+	}
+
+	roles, err := repo.GetUserRoles(second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 1 || roles[models.RoleEditor].Role != models.RoleEditor {
+		t.Errorf("expected editor role, got %v", roles)
+	}
+
+	err = repo.RevokeRole(second.ID, models.RoleEditor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles, err = repo.GetUserRoles(second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 0 {
+		t.Errorf("expected no roles, got %v", roles)
+	}
+}
+
+func TestSqliteAdmin(t *testing.T) {
+	repo := newSqliteTestRepo(t)
+
+	admin, err := repo.InsertUser("Ada", "ada@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := repo.InsertUser("Julia", "julia@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.SaveRecipe(models.JsonRecipe{Title: "Tomato Soup"}, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := repo.ListUsers("JUL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != user.ID {
+		t.Errorf("expected search to find Julia, got %+v", users)
+	}
+	users, err = repo.ListUsers("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || !users[0].HasRole(models.RoleAdmin) || users[1].HasRole(models.RoleAdmin) {
+		t.Errorf("expected both users with their roles, got %+v", users)
+	}
+
+	err = repo.SetUserDisabled(user.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabled, err := repo.GetUserById(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !disabled.Disabled {
+		t.Error("expected user to be disabled")
+	}
+
+	for _, action := range []string{models.ActionDisableUser, models.ActionDeleteUser} {
+		err = repo.InsertAdminAction(models.AdminAction{
+			AdminID:    admin.ID,
+			AdminName:  admin.Name,
+			Action:     action,
+			TargetType: "user",
+			TargetID:   user.ID,
+			Details:    user.Email,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Deleting a user deletes their recipes
+	err = repo.DeleteUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipes, err := repo.GetAllRecipes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipes) != 0 {
+		t.Errorf("expected recipes to be deleted, got %d", len(recipes))
+	}
+	err = repo.DeleteUser(user.ID)
+	if err == nil {
+		t.Error("expected an error deleting a missing user")
+	}
+
+	// The audit log outlives the admin who wrote it
+	err = repo.DeleteUser(admin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions, err := repo.GetAdminActions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 1 || actions[0].Action != models.ActionDeleteUser || actions[0].AdminID != 0 || actions[0].AdminName != "Ada" {
+		t.Errorf("unexpected admin actions %+v", actions)
+	}
+}
+
+func TestSqliteRecipeOrder(t *testing.T) {
+	repo := newSqliteTestRepo(t)
+	user, err := repo.InsertUser("Julia", "julia@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lists are saved in the order they are posted in
+	recipe := models.JsonRecipe{
+		Title:       "Tomato Soup",
+		Ingredients: []models.JsonIngredient{{Name: "tomatoes"}, {Name: "onion"}, {Name: "salt"}},
+		Directions:  []models.JsonDirection{{Direction: "Chop"}, {Direction: "Simmer"}, {Direction: "Blend"}},
+	}
+	id, err := repo.SaveRecipe(recipe, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := repo.GetRecipeDetails(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, direction := range saved.Directions {
+		if direction.Direction != recipe.Directions[i].Direction || direction.Position != i {
+			t.Errorf("expected %q at %d, got %+v", recipe.Directions[i].Direction, i, direction)
+		}
+	}
+
+	// Moving steps keeps their IDs
+	order := models.JsonRecipeOrder{
+		Ingredients: []int{saved.Ingredients[2].ID, saved.Ingredients[0].ID, saved.Ingredients[1].ID},
+		Directions:  []int{saved.Directions[1].ID, saved.Directions[0].ID, saved.Directions[2].ID},
+	}
+	err = repo.ReorderRecipe(int(id), order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reordered, err := repo.GetRecipeDetails(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names, directions []string
+	for i, ingredient := range reordered.Ingredients {
+		names = append(names, ingredient.Name)
+		if ingredient.ID != order.Ingredients[i] || ingredient.Position != i {
+			t.Errorf("expected ingredient %d at %d, got %+v", order.Ingredients[i], i, ingredient)
+		}
+	}
+	for _, direction := range reordered.Directions {
+		directions = append(directions, direction.Direction)
+	}
+	if strings.Join(names, ",") != "salt,tomatoes,onion" || strings.Join(directions, ",") != "Simmer,Chop,Blend" {
+		t.Errorf("expected the new order, got %v %v", names, directions)
+	}
+	if reordered.UpdatedAt.Before(saved.UpdatedAt) {
+		t.Errorf("expected the recipe to be updated, got %v before %v", reordered.UpdatedAt, saved.UpdatedAt)
+	}
+
+	// The steps of another recipe can't be moved, and nothing is moved when one of them fails
+	otherId, err := repo.SaveRecipe(models.JsonRecipe{Title: "Bread", Directions: []models.JsonDirection{{Direction: "Bake"}}}, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := repo.GetRecipeDetails(int(otherId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.ReorderRecipe(int(id), models.JsonRecipeOrder{Directions: []int{saved.Directions[2].ID, other.Directions[0].ID}})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected no rows, got %v", err)
+	}
+	unchanged, err := repo.GetRecipeDetails(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unchanged.Directions[0].Direction != "Simmer" {
+		t.Errorf("expected the order to be kept, got %+v", unchanged.Directions)
+	}
+}
+
+func TestSqliteRecipePhotos(t *testing.T) {
+	repo := newSqliteTestRepo(t)
+	conn := repo.(*sqliteDBRepo).DB
+	user, err := repo.InsertUser("Julia", "julia@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := func(c string) string { return strings.Repeat(c, 64) + ".jpg" }
+	recipe := models.JsonRecipe{
+		Title:       "Tomato Soup",
+		Ingredients: []models.JsonIngredient{{Name: "tomatoes"}},
+		Directions: []models.JsonDirection{
+			{Direction: "Chop", Photos: []models.JsonPhoto{{Image: key("c"), Caption: "Chopped"}}},
+			{Direction: "Simmer"},
+			{Direction: "Serve", Photos: []models.JsonPhoto{{Image: key("d")}, {Image: key("e"), Caption: "Garnished"}}},
+		},
+		Photos: []models.JsonPhoto{{Image: key("b"), Caption: "Served"}, {Image: key("a"), Caption: "Leftovers"}},
+	}
+	id, err := repo.SaveRecipe(recipe, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := repo.GetRecipeDetails(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, photo := range saved.Photos {
+		got = append(got, photo.Image[:1]+":"+photo.Caption)
+	}
+	for _, direction := range saved.Directions {
+		got = append(got, direction.Direction)
+		for _, photo := range direction.Photos {
+			got = append(got, photo.Image[:1]+":"+photo.Caption)
+		}
+	}
+	want := "b:Served,a:Leftovers,Chop,c:Chopped,Simmer,Serve,d:,e:Garnished"
+	if strings.Join(got, ",") != want {
+		t.Errorf("expected the photos in order\n%s\ngot\n%s", want, strings.Join(got, ","))
+	}
+
+	// Saving the recipe again replaces its photos and those of its directions
+	recipe.ID = int(id)
+	recipe.Photos = []models.JsonPhoto{{Image: key("a")}}
+	recipe.Directions = []models.JsonDirection{{Direction: "Heat"}}
+	_, err = repo.SaveRecipe(recipe, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err = repo.GetRecipeDetails(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Photos) != 1 || saved.Photos[0].Image != key("a") || len(saved.Directions[0].Photos) != 0 {
+		t.Errorf("expected the photos to be replaced, got %+v %+v", saved.Photos, saved.Directions)
+	}
+	var left int
+	_ = conn.QueryRow(`SELECT COUNT(*) FROM direction_photos`).Scan(&left)
+	if left != 0 {
+		t.Errorf("expected the photos of deleted directions to be deleted, %d are left", left)
+	}
+}
+
+func TestSqliteListRecipes(t *testing.T) {
+	repo := newSqliteTestRepo(t)
+	user, err := repo.InsertUser("Julia", "julia@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"Chili", "Apple Pie", "Bread"} {
+		_, err = repo.SaveRecipe(models.JsonRecipe{Title: title, Image: strings.Repeat("a", 64) + ".jpg"}, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		sort   string
+		offset int
+		limit  int
+		want   []string
+	}{
+		{models.SortNewest, 0, 10, []string{"Bread", "Apple Pie", "Chili"}},
+		{models.SortOldest, 0, 2, []string{"Chili", "Apple Pie"}},
+		{models.SortOldest, 2, 2, []string{"Bread"}},
+		{models.SortTitle, 1, 1, []string{"Bread"}},
+		{models.SortUpdated, 3, 2, nil},
+	}
+	for _, e := range tests {
+		recipes, total, err := repo.ListRecipes(e.offset, e.limit, e.sort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 3 {
+			t.Errorf("expected 3 recipes in total, got %d", total)
+		}
+		var titles []string
+		for _, recipe := range recipes {
+			titles = append(titles, recipe.Title)
+			if recipe.Image != strings.Repeat("a", 64)+".jpg" || recipe.User.Name != "Julia" {
+				t.Errorf("expected the author's name and the image key, got %+v", recipe)
+			}
+		}
+		if strings.Join(titles, ",") != strings.Join(e.want, ",") {
+			t.Errorf("%s %d-%d: expected %v, got %v", e.sort, e.offset, e.limit, e.want, titles)
+		}
+	}
+
+	_, _, err = repo.ListRecipes(0, 10, "id; DROP TABLE recipes")
+	if err == nil {
+		t.Error("expected unknown sorts to be rejected")
+	}
+}
+
+func TestSqliteSearchRecipes(t *testing.T) {
+	repo := newSqliteTestRepo(t)
+	user, err := repo.InsertUser("Julia", "julia@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	soup := models.JsonRecipe{
+		Title:       "Tomato Soup",
+		Ingredients: []models.JsonIngredient{{Name: "tomatoes"}},
+		Directions:  []models.JsonDirection{{Direction: "Simmer"}},
+	}
+	soupId, err := repo.SaveRecipe(soup, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.SaveRecipe(models.JsonRecipe{
+		Title:       "Bread",
+		Ingredients: []models.JsonIngredient{{Name: "flour"}},
+		Directions:  []models.JsonDirection{{Direction: "Serve with tomato soup"}},
+	}, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(query string) []string {
+		t.Helper()
+		recipes, total, err := repo.SearchRecipes(query, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != len(recipes) {
+			t.Errorf("%s: expected a total of %d, got %d", query, len(recipes), total)
+		}
+		var titles []string
+		for _, recipe := range recipes {
+			titles = append(titles, recipe.Title)
+		}
+		return titles
+	}
+
+	if got := search("soup"); strings.Join(got, ",") != "Tomato Soup,Bread" {
+		t.Errorf("expected the title match first, got %v", got)
+	}
+	if got := search(`flour" OR "`); strings.Join(got, ",") != "Bread" {
+		t.Errorf("expected query syntax to be ignored, got %v", got)
+	}
+	if got := search("  "); got != nil {
+		t.Errorf("expected no results for an empty query, got %v", got)
+	}
+
+	// The index follows edits and deletes
+	soup.ID = int(soupId)
+	soup.Title = "Gazpacho"
+	soup.Ingredients = []models.JsonIngredient{{Name: "cucumber"}}
+	_, err = repo.SaveRecipe(soup, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := search("tomatoes"); got != nil {
+		t.Errorf("expected old ingredients to be gone, got %v", got)
+	}
+	if got := search("cucumber"); strings.Join(got, ",") != "Gazpacho" {
+		t.Errorf("expected new ingredients to be found, got %v", got)
+	}
+
+	err = repo.DeleteRecipe(int(soupId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := search("gazpacho"); got != nil {
+		t.Errorf("expected deleted recipes to be gone, got %v", got)
+	}
+}
+
+func TestSqliteMatchRecipes(t *testing.T) {
+	repo := newSqliteTestRepo(t)
+	user, err := repo.InsertUser("Julia", "julia@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, recipe := range []models.JsonRecipe{
+		{Title: "Fried Rice", Ingredients: []models.JsonIngredient{{Name: "Rice"}, {Name: "eggs"}, {Name: "Scallions"}}},
+		{Title: "Chicken and Rice", Ingredients: []models.JsonIngredient{{Name: "chicken thighs"}, {Name: "rice"}, {Name: "garlic cloves"}, {Name: "cumin"}}},
+		{Title: "Beef Stew", Ingredients: []models.JsonIngredient{{Name: "beef"}, {Name: "carrots"}}},
+	} {
+		_, err = repo.SaveRecipe(recipe, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	matches, err := repo.MatchRecipes(pantry.New("chicken, RICE, garlic, green onions"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %+v", matches)
+	}
+
+	// Chicken and Rice covers more ingredients even though Fried Rice misses fewer
+	first, second := matches[0], matches[1]
+	if first.Recipe.Title != "Chicken and Rice" || first.Covered != 3 || first.Coverage() != 75 || first.Recipe.User.Name != "Julia" {
+		t.Errorf("unexpected first match %+v", first)
+	}
+	if len(first.Missing) != 1 || first.Missing[0].Name != "cumin" {
+		t.Errorf("expected cumin to be missing, got %+v", first.Missing)
+	}
+	if second.Recipe.Title != "Fried Rice" || second.Covered != 2 || second.Coverage() != 66 {
+		t.Errorf("unexpected second match %+v", second)
+	}
+
+	matches, err = repo.MatchRecipes(pantry.New("chicken, rice"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].Recipe.Title != "Chicken and Rice" || len(matches[0].Recipe.Ingredients) != 4 {
+		t.Errorf("expected the limit to keep the best match with all its ingredients, got %+v", matches)
+	}
+
+	matches, err = repo.MatchRecipes(pantry.New(" , "), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("expected no matches for an empty pantry, got %+v", matches)
+	}
+}
+
+func TestSqliteApiTokens(t *testing.T) {
+	repo := newSqliteTestRepo(t)
+	user, err := repo.InsertUser("Julia", "julia@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := repo.InsertApiToken(user.ID, "importer", "hash-of-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.ID == 0 || token.Name != "importer" || token.UserID != user.ID {
+		t.Errorf("unexpected token %+v", token)
+	}
+	_, err = repo.InsertApiToken(user.ID, "copy", "hash-of-token")
+	if err == nil {
+		t.Error("expected an error storing the same token hash twice")
+	}
+
+	found, err := repo.GetUserByApiToken("hash-of-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != user.ID || !found.HasRole(models.RoleAdmin) {
+		t.Errorf("expected Julia with their roles, got %+v", found)
+	}
+	_, err = repo.GetUserByApiToken("hash-of-another-token")
+	if err == nil {
+		t.Error("expected an error for an unknown token")
+	}
+
+	other, err := repo.InsertApiToken(user.ID, "unused", "hash-of-unused-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := repo.ListApiTokens(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 || tokens[0].ID != other.ID || !tokens[0].LastUsedAt.IsZero() || tokens[1].LastUsedAt.IsZero() {
+		t.Errorf("expected the unused token first, got %+v", tokens)
+	}
+
+	// Only the owner can revoke a token
+	err = repo.DeleteApiToken(user.ID+1, other.ID)
+	if err == nil {
+		t.Error("expected an error revoking someone else's token")
+	}
+	err = repo.DeleteApiToken(user.ID, other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.GetUserByApiToken("hash-of-unused-token")
+	if err == nil {
+		t.Error("expected the revoked token to stop working")
+	}
+
+	// Deleting a user deletes their tokens
+	err = repo.DeleteUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.GetUserByApiToken("hash-of-token")
+	if err == nil {
+		t.Error("expected the token of a deleted user to be gone")
+	}
+}
+
+func TestSqliteShoppingLists(t *testing.T) {
+	repo := newSqliteTestRepo(t)
+	user, err := repo.InsertUser("Julia", "julia@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := repo.InsertUser("Paul", "paul@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := []models.ShoppingListItem{
+		{Name: "tomatoes", Amount: "1-2", Unit: "lb", Section: "Produce", Position: 0},
+		{Name: "salt", Amount: "to taste", Section: "Spices", Position: 1},
+	}
+	listId, err := repo.InsertShoppingList(user.ID, "Week 1", items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.InsertShoppingList(user.ID, "Empty", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := repo.GetShoppingList(user.ID, int(listId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Name != "Week 1" || len(list.Items) != 2 || list.Items[0].String() != "1-2 lb tomatoes" || list.Items[1].Section != "Spices" {
+		t.Errorf("unexpected list %+v", list)
+	}
+	_, err = repo.GetShoppingList(other.ID, int(listId))
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected someone else's list not to be found, got %v", err)
+	}
+
+	// Checking an item twice is fine, checking someone else's isn't
+	for range 2 {
+		err = repo.CheckShoppingListItem(user.ID, int(listId), list.Items[1].ID, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = repo.CheckShoppingListItem(other.ID, int(listId), list.Items[0].ID, true)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected someone else's item not to be found, got %v", err)
+	}
+	list, err = repo.GetShoppingList(user.ID, int(listId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Items[0].Checked || !list.Items[1].Checked {
+		t.Errorf("expected only salt to be checked, got %+v", list.Items)
+	}
+
+	// The checked list was changed last
+	lists, err := repo.ListShoppingLists(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 2 || lists[0].ID != int(listId) || lists[0].Items != nil {
+		t.Errorf("expected Week 1 first and without items, got %+v", lists)
+	}
+
+	err = repo.DeleteShoppingList(other.ID, int(listId))
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected someone else's list not to be deleted, got %v", err)
+	}
+	err = repo.DeleteShoppingList(user.ID, int(listId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.GetShoppingList(user.ID, int(listId))
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the deleted list to be gone, got %v", err)
+	}
+}
+
+func TestSqliteMeals(t *testing.T) {
+	repo := newSqliteTestRepo(t)
+	user, err := repo.InsertUser("Julia", "julia@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := repo.InsertUser("Paul", "paul@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	soup, err := repo.SaveRecipe(models.JsonRecipe{Title: "Soup"}, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := func(s string) time.Time {
+		d, err := time.Parse(models.DateLayout, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	var mealId int64
+	for _, meal := range []struct{ date, slot string }{
+		{"2024-04-14", models.SlotDinner},
+		{"2024-04-13", models.SlotDinner},
+		{"2024-04-13", models.SlotBreakfast},
+		{"2024-04-20", models.SlotLunch},
+	} {
+		mealId, err = repo.InsertMeal(user.ID, int(soup), day(meal.date), meal.slot)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The end of the range is left out, meals are in the order of the day
+	meals, err := repo.ListMeals(user.ID, day("2024-04-13"), day("2024-04-20"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meals) != 3 || meals[0].Slot != models.SlotBreakfast || meals[1].Slot != models.SlotDinner ||
+		!meals[2].Date.Equal(day("2024-04-14")) || meals[0].RecipeTitle != "Soup" {
+		t.Errorf("unexpected meals %+v", meals)
+	}
+	meals, err = repo.ListMeals(other.ID, day("2024-04-13"), day("2024-04-21"))
+	if err != nil || len(meals) != 0 {
+		t.Errorf("expected no meals for Paul, got %+v, %v", meals, err)
+	}
+
+	err = repo.DeleteMeal(other.ID, int(mealId))
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected someone else's meal not to be deleted, got %v", err)
+	}
+	err = repo.DeleteMeal(user.ID, int(mealId))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the latest feed token works
+	_, err = repo.GetUserByCalendarToken("first")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected an unknown token not to be found, got %v", err)
+	}
+	for _, hash := range []string{"first", "second"} {
+		err = repo.SetCalendarToken(user.ID, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = repo.GetUserByCalendarToken("first")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the replaced token not to be found, got %v", err)
+	}
+	found, err := repo.GetUserByCalendarToken("second")
+	if err != nil || found.ID != user.ID {
+		t.Errorf("expected the token to belong to Julia, got %+v, %v", found, err)
+	}
+
+	// Deleting the recipe takes it off the plan
+	err = repo.DeleteRecipe(int(soup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meals, err = repo.ListMeals(user.ID, day("2024-04-01"), day("2024-05-01"))
+	if err != nil || len(meals) != 0 {
+		t.Errorf("expected the soup to be off the plan, got %+v, %v", meals, err)
+	}
+}
+
+func TestSqliteMoveImageBlobs(t *testing.T) {
+	repo := newSqliteTestRepo(t)
+	conn := repo.(*sqliteDBRepo).DB
+	user, err := repo.InsertUser("Julia", "julia@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Recipes saved before image keys kept a base64 image in the image column
+	var buf bytes.Buffer
+	err = png.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := base64.StdEncoding.EncodeToString(buf.Bytes())
+	blobs := []string{blob, "", "not base64!", blob, base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\nsoup"))}
+	for i, blob := range blobs {
+		_, err = conn.Exec(`INSERT INTO recipes (title, image, user_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+			fmt.Sprintf("Soup %d", i), blob, user.ID, time.Now(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err := images.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved, err := MoveImageBlobs(conn, store)
+	if err != nil || moved != 2 {
+		t.Fatalf("expected 2 images to be moved, got %d %v", moved, err)
+	}
+
+	first, err := repo.GetRecipeDetails(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := first.Image
+	if !images.ValidKey(key) {
+		t.Fatalf("expected an image key, got %q", key)
+	}
+	for id, want := range map[int]string{2: "", 3: "", 4: key, 5: ""} {
+		recipe, err := repo.GetRecipeDetails(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recipe.Image != want {
+			t.Errorf("recipe %d: expected image %q, got %q", id, want, recipe.Image)
+		}
+	}
+	for _, stored := range []string{key, images.SizeKey(key, images.ThumbWidth), images.SizeKey(key, images.DetailWidth)} {
+		_, err = store.Get(context.Background(), stored)
+		if err != nil {
+			t.Errorf("expected %s in the store, got %v", stored, err)
+		}
+	}
+
+	// Moved images are cleared, the ones that couldn't be moved are kept
+	var left int
+	_ = conn.QueryRow(`SELECT COUNT(*) FROM recipes WHERE LENGTH(image) > 0`).Scan(&left)
+	if left != 2 {
+		t.Errorf("expected 2 images left in the table, got %d", left)
+	}
+
+	// The move runs once, blobs written after it are left alone
+	_, err = conn.Exec(`INSERT INTO recipes (title, image, user_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+		"Late Soup", blob, user.ID, time.Now(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved, err = MoveImageBlobs(conn, store)
+	if err != nil || moved != 0 {
+		t.Errorf("expected nothing to move the second time, got %d %v", moved, err)
+	}
+	_ = conn.QueryRow(`SELECT COUNT(*) FROM recipes WHERE LENGTH(image) > 0`).Scan(&left)
+	if left != 3 {
+		t.Errorf("expected the move not to run again, got %d images left in the table", left)
+	}
+}
+
+func TestSqliteRemoveReplacedImages(t *testing.T) {
+	repo := newSqliteTestRepo(t)
+	store, err := images.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.(*sqliteDBRepo).App.Images = store
+	user, err := repo.InsertUser("Julia", "julia@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	var keys []string
+	for _, width := range []int{8, 9, 10} {
+		var buf bytes.Buffer
+		err = png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, 8)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := images.Upload(ctx, store, buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	stored := func(key string) bool {
+		_, err := store.Get(ctx, key)
+		return err == nil
+	}
+
+	// Both recipes use the first image
+	soup, err := repo.SaveRecipe(models.JsonRecipe{Title: "Soup", Image: keys[0], Photos: []models.JsonPhoto{{Image: keys[2]}}}, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stew, err := repo.SaveRecipe(models.JsonRecipe{Title: "Stew", Image: keys[0]}, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.SaveRecipe(models.JsonRecipe{ID: int(soup), Title: "Soup", Image: keys[1]}, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored(keys[0]) || !stored(keys[1]) {
+		t.Error("expected the images still in use to be kept")
+	}
+	if stored(keys[2]) || stored(images.SizeKey(keys[2], images.ThumbWidth)) {
+		t.Error("expected the replaced photo and its copies to be removed")
+	}
+
+	err = repo.DeleteRecipe(int(stew))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored(keys[0]) || !stored(keys[1]) {
+		t.Error("expected only the image of the deleted recipe to be removed")
+	}
+}
+
+func TestSqliteUploads(t *testing.T) {
+	repo := newSqliteTestRepo(t)
+	store, err := images.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.(*sqliteDBRepo).App.Images = store
+	user, err := repo.InsertUser("Julia", "julia@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	var keys []string
+	for _, width := range []int{8, 9, 10} {
+		var buf bytes.Buffer
+		err = png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, 8)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := images.Upload(ctx, store, buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.InsertUpload(user.ID, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	stored := func(key string) bool {
+		exists, err := store.Exists(ctx, key)
+		return err == nil && exists
+	}
+
+	count, err := repo.CountUploads(user.ID, time.Now().Add(-time.Hour))
+	if err != nil || count != 3 {
+		t.Errorf("expected 3 uploads, got %d %v", count, err)
+	}
+	count, _ = repo.CountUploads(user.ID, time.Now().Add(time.Hour))
+	if count != 0 {
+		t.Errorf("expected no uploads after now, got %d", count)
+	}
+
+	// Nothing is removed while the uploads are recent
+	removed, err := repo.DeleteUploads(time.Now().Add(-time.Hour))
+	if err != nil || removed != 0 || !stored(keys[2]) {
+		t.Errorf("expected recent uploads to be kept, got %d %v", removed, err)
+	}
+
+	// A recipe keeps the first image, and the second was uploaded again after the cut-off
+	_, err = repo.SaveRecipe(models.JsonRecipe{Title: "Soup", Image: keys[0]}, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	err = repo.InsertUpload(user.ID, keys[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err = repo.DeleteUploads(before)
+	if err != nil || removed != 1 {
+		t.Errorf("expected 1 image to be removed, got %d %v", removed, err)
+	}
+	if !stored(keys[0]) || !stored(keys[1]) || stored(keys[2]) || stored(images.SizeKey(keys[2], images.ThumbWidth)) {
+		t.Error("expected only the unused upload and its copies to be removed")
+	}
+	count, _ = repo.CountUploads(user.ID, time.Time{})
+	if count != 1 {
+		t.Errorf("expected the old uploads to be forgotten, got %d left", count)
+	}
+}
+
+func TestSqliteParseQuantities(t *testing.T) {
+	repo := newSqliteTestRepo(t)
+	conn := repo.(*sqliteDBRepo).DB
+	user, err := repo.InsertUser("Julia", "julia@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Saved recipes get their quantities right away
+	id, err := repo.SaveRecipe(models.JsonRecipe{Title: "Tomato Soup", Ingredients: []models.JsonIngredient{
+		{Name: "tomatoes", Amount: "1½"},
+		{Name: "salt", Amount: "to taste"},
+	}}, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ingredients saved before there were quantities only have their amount
+	for i, amount := range []string{"2-3", "a pinch", ""} {
+		_, err = conn.Exec(`INSERT INTO ingredients (name, amount, unit, position, recipe_id, created_at, updated_at)
+			VALUES (?, ?, '', ?, ?, ?, ?)`, fmt.Sprintf("spice %d", i), amount, 2+i, id, time.Now(), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	parsed, err := ParseQuantities(conn)
+	if err != nil || parsed != 3 {
+		t.Fatalf("expected 3 amounts to be parsed, got %d %v", parsed, err)
+	}
+
+	recipe, err := repo.GetRecipeDetails(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.Quantity{{Min: 1.5, Max: 1.5}, {ToTaste: true}, {Min: 2, Max: 3}, {}, {}}
+	if len(recipe.Ingredients) != len(want) {
+		t.Fatalf("expected %d ingredients, got %+v", len(want), recipe.Ingredients)
+	}
+	for i, ingredient := range recipe.Ingredients {
+		if ingredient.Quantity != want[i] {
+			t.Errorf("%q: expected %+v, got %+v", ingredient.Amount, want[i], ingredient.Quantity)
+		}
+	}
+
+	// It only runs once
+	_, err = conn.Exec(`INSERT INTO ingredients (name, amount, unit, position, recipe_id, created_at, updated_at)
+		VALUES ('pepper', '1', '', 5, ?, ?, ?)`, id, time.Now(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err = ParseQuantities(conn)
+	if err != nil || parsed != 0 {
+		t.Errorf("expected nothing to parse the second time, got %d %v", parsed, err)
+	}
+}
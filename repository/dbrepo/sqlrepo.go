@@ -0,0 +1,399 @@
+package dbrepo
+
+import (
+	"context"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"github.com/popnfresh234/recipe-app-golang/internal/pantry"
+	"log"
+	"time"
+)
+
+// MatchRecipes finds up to limit recipes that can be cooked, at least in part, with the ingredients in p
+func (dbRepo *sqlDBRepo) MatchRecipes(p pantry.Pantry, limit int) ([]models.RecipeMatch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	matches, err := matchRecipes(ctx, dbRepo.DB, p, limit)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return matches, nil
+}
+
+// SaveRecipe writes a recipe, its ingredients, its directions and their photos in a single transaction.
+// A recipe without an ID is inserted for userId, otherwise the existing recipe is updated
+// and its ingredients, directions and photos are replaced. If any step fails nothing is written.
+func (dbRepo *sqlDBRepo) SaveRecipe(jsonRecipe models.JsonRecipe, userId int) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := dbRepo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, err
+	}
+	defer tx.Rollback()
+
+	var recipeId int64
+	var oldImages []string
+	if jsonRecipe.ID == 0 {
+		recipeId, err = insertRecipe(ctx, tx, jsonRecipe.Title, jsonRecipe.Image, jsonRecipe.Servings, userId)
+	} else {
+		recipeId = int64(jsonRecipe.ID)
+		oldImages, err = recipeImageKeys(ctx, tx, jsonRecipe.ID)
+		if err == nil {
+			err = updateRecipe(ctx, tx, jsonRecipe)
+		}
+	}
+	if err != nil {
+		log.Println("Error saving recipe", err)
+		return -1, err
+	}
+
+	for position, ingredient := range jsonRecipe.Ingredients {
+		err = insertIngredient(ctx, tx, ingredient.Name, ingredient.Amount, ingredient.Unit, position, recipeId)
+		if err != nil {
+			log.Println("Error saving ingredient", err)
+			return -1, err
+		}
+	}
+
+	for position, direction := range jsonRecipe.Directions {
+		directionId, err := insertDirection(ctx, tx, direction.Direction, position, recipeId)
+		if err == nil {
+			err = insertPhotos(ctx, tx, "direction_photos", directionId, direction.Photos)
+		}
+		if err != nil {
+			log.Println("Error saving direction", err)
+			return -1, err
+		}
+	}
+
+	err = insertPhotos(ctx, tx, "recipe_photos", recipeId, jsonRecipe.Photos)
+	if err != nil {
+		log.Println("Error saving photos", err)
+		return -1, err
+	}
+
+	// Images the recipe no longer uses are removed from the image storage once the change is saved
+	unused, err := unusedImageKeys(ctx, tx, oldImages)
+	if err != nil {
+		log.Println("Error finding replaced images", err)
+		return -1, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return -1, err
+	}
+	removeImages(dbRepo.App.Images, unused)
+	return recipeId, nil
+}
+
+// ReorderRecipe moves the ingredients and directions of a recipe to the positions of their IDs in order.
+// An ID that isn't one of the recipe's is sql.ErrNoRows and nothing is moved.
+func (dbRepo *sqlDBRepo) ReorderRecipe(recipeId int, order models.JsonRecipeOrder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := dbRepo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = reorderRecipe(ctx, tx, recipeId, order)
+	if err != nil {
+		log.Println("Error reordering recipe", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteRecipe deletes a recipe, its ingredients and directions are removed by the foreign keys.
+// Images no other recipe uses are removed from the image storage.
+func (dbRepo *sqlDBRepo) DeleteRecipe(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := dbRepo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	keys, err := recipeImageKeys(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM recipes WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	unused, err := unusedImageKeys(ctx, tx, keys)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	removeImages(dbRepo.App.Images, unused)
+	return nil
+}
+
+// GetUserRoles gets the roles of a user keyed by role name
+func (dbRepo *sqlDBRepo) GetUserRoles(userId int) (map[string]models.Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getUserRoles(ctx, dbRepo.DB, userId)
+}
+
+// AssignRole gives a user one of the roles in the roles table
+func (dbRepo *sqlDBRepo) AssignRole(userId int, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return assignRole(ctx, dbRepo.DB, userId, role)
+}
+
+// RevokeRole takes a role away from a user
+func (dbRepo *sqlDBRepo) RevokeRole(userId int, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return revokeRole(ctx, dbRepo.DB, userId, role)
+}
+
+// GetUserById gets a user and their roles by ID
+func (dbRepo *sqlDBRepo) GetUserById(id int) (models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	row := dbRepo.DB.QueryRowContext(ctx, `SELECT id, name, email, disabled, created_at, updated_at FROM users WHERE id = ?`, id)
+
+	var user models.User
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Disabled, scanTime(&user.CreatedAt), scanTime(&user.UpdatedAt))
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user.Roles, err = getUserRoles(ctx, dbRepo.DB, user.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// SetUserDisabled disables or re-enables a user account
+func (dbRepo *sqlDBRepo) SetUserDisabled(id int, disabled bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return setUserDisabled(ctx, dbRepo.DB, id, disabled)
+}
+
+// DeleteUser deletes a user along with their recipes
+func (dbRepo *sqlDBRepo) DeleteUser(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return deleteUser(ctx, dbRepo.DB, id)
+}
+
+// InsertAdminAction records an action taken in the admin console
+func (dbRepo *sqlDBRepo) InsertAdminAction(action models.AdminAction) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertAdminAction(ctx, dbRepo.DB, action)
+}
+
+// InsertApiToken stores the hash of a new API token for a user
+func (dbRepo *sqlDBRepo) InsertApiToken(userId int, name, tokenHash string) (models.ApiToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertApiToken(ctx, dbRepo.DB, userId, name, tokenHash)
+}
+
+// GetUserByApiToken gets the user, and their roles, that the token with tokenHash belongs to
+func (dbRepo *sqlDBRepo) GetUserByApiToken(tokenHash string) (models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	userId, err := useApiToken(ctx, dbRepo.DB, tokenHash)
+	if err != nil {
+		return models.User{}, err
+	}
+	return dbRepo.GetUserById(userId)
+}
+
+// DeleteApiToken revokes an API token of a user
+func (dbRepo *sqlDBRepo) DeleteApiToken(userId, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return deleteApiToken(ctx, dbRepo.DB, userId, id)
+}
+
+// InsertShoppingList saves a shopping list for a user along with its items
+func (dbRepo *sqlDBRepo) InsertShoppingList(userId int, name string, items []models.ShoppingListItem) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := dbRepo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, err
+	}
+	defer tx.Rollback()
+
+	listId, err := insertShoppingList(ctx, tx, userId, name, items)
+	if err != nil {
+		log.Println("Error saving shopping list", err)
+		return -1, err
+	}
+	return listId, tx.Commit()
+}
+
+// ListShoppingLists gets the shopping lists of a user without their items, the most recently changed first
+func (dbRepo *sqlDBRepo) ListShoppingLists(userId int) ([]models.ShoppingList, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	lists, err := listShoppingLists(ctx, dbRepo.DB, userId)
+	if err != nil {
+		log.Println(err)
+	}
+	return lists, err
+}
+
+// GetShoppingList gets a shopping list of a user with its items in order
+func (dbRepo *sqlDBRepo) GetShoppingList(userId, id int) (models.ShoppingList, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getShoppingList(ctx, dbRepo.DB, userId, id)
+}
+
+// CheckShoppingListItem checks or unchecks an item of a user's shopping list
+func (dbRepo *sqlDBRepo) CheckShoppingListItem(userId, listId, itemId int, checked bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := dbRepo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkShoppingListItem(ctx, tx, userId, listId, itemId, checked)
+	if err != nil {
+		log.Println("Error checking shopping list item", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteShoppingList deletes a shopping list of a user
+func (dbRepo *sqlDBRepo) DeleteShoppingList(userId, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return deleteShoppingList(ctx, dbRepo.DB, userId, id)
+}
+
+// InsertMeal plans a recipe for a user on the day of date, in slot
+func (dbRepo *sqlDBRepo) InsertMeal(userId, recipeId int, date time.Time, slot string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	mealId, err := insertMeal(ctx, dbRepo.DB, userId, recipeId, date, slot)
+	if err != nil {
+		log.Println("Error planning meal", err)
+		return -1, err
+	}
+	return mealId, nil
+}
+
+// ListMeals gets the meals a user planned from the day of from up to, but not including, the day of to
+func (dbRepo *sqlDBRepo) ListMeals(userId int, from, to time.Time) ([]models.Meal, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	meals, err := listMeals(ctx, dbRepo.DB, userId, from, to)
+	if err != nil {
+		log.Println(err)
+	}
+	return meals, err
+}
+
+// DeleteMeal deletes a meal a user planned
+func (dbRepo *sqlDBRepo) DeleteMeal(userId, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return deleteMeal(ctx, dbRepo.DB, userId, id)
+}
+
+// SetCalendarToken stores the hash of a user's new calendar feed token
+func (dbRepo *sqlDBRepo) SetCalendarToken(userId int, tokenHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return setCalendarToken(ctx, dbRepo.DB, userId, tokenHash)
+}
+
+// GetUserByCalendarToken gets the user, and their roles, that the calendar feed token with tokenHash belongs to
+func (dbRepo *sqlDBRepo) GetUserByCalendarToken(tokenHash string) (models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	userId, err := getCalendarTokenUser(ctx, dbRepo.DB, tokenHash)
+	if err != nil {
+		return models.User{}, err
+	}
+	return dbRepo.GetUserById(userId)
+}
+
+// InsertUpload records that a user uploaded the image with key, so it is kept until a recipe uses it
+func (dbRepo *sqlDBRepo) InsertUpload(userId int, key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertUpload(ctx, dbRepo.DB, userId, key)
+}
+
+// CountUploads counts the images a user uploaded since since
+func (dbRepo *sqlDBRepo) CountUploads(userId int, since time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return countUploads(ctx, dbRepo.DB, userId, since)
+}
+
+// DeleteUploads forgets the uploads made before before and removes their images from the image storage
+// unless a recipe uses them. It returns how many images it removed.
+func (dbRepo *sqlDBRepo) DeleteUploads(before time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := dbRepo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	unused, err := deleteUploads(ctx, tx, before)
+	if err != nil {
+		log.Println("Error deleting uploads", err)
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	removeImages(dbRepo.App.Images, unused)
+	return len(unused), nil
+}
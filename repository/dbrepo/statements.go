@@ -0,0 +1,932 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"github.com/popnfresh234/recipe-app-golang/internal/pantry"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Statements in this file are shared by the MySQL and SQLite repos
+
+// dbtx is implemented by both *sql.DB and *sql.Tx, so statements can run inside or outside a transaction
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// recipeListOrder maps the sort orders of ListRecipes to ORDER BY clauses, the ID breaks ties so pages don't overlap
+var recipeListOrder = map[string]string{
+	models.SortNewest:  "recipes.created_at DESC, recipes.id DESC",
+	models.SortOldest:  "recipes.created_at ASC, recipes.id ASC",
+	models.SortUpdated: "recipes.updated_at DESC, recipes.id DESC",
+	models.SortTitle:   "recipes.title ASC, recipes.id ASC",
+}
+
+// recipeListStatement selects a page of recipes along with the names of their authors and the keys of their images
+func recipeListStatement(sort string) (string, error) {
+	orderBy, ok := recipeListOrder[sort]
+	if !ok {
+		return "", fmt.Errorf("unknown sort %q", sort)
+	}
+	return `
+		SELECT
+		    recipes.id, recipes.title, recipes.image_key, recipes.created_at, recipes.updated_at, recipes.user_id, users.name
+		FROM recipes
+		JOIN users ON users.id = recipes.user_id
+		ORDER BY ` + orderBy + `
+		LIMIT ? OFFSET ?
+	`, nil
+}
+
+// Search relevance weights, a match in the title counts for more than one in the ingredients or directions
+const (
+	searchTitleWeight       = 3
+	searchIngredientsWeight = 2
+	searchDirectionsWeight  = 1
+)
+
+// searchTerms splits a search query into lowercase words, dropping punctuation and search operators
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// matchCandidates is how many recipes per result SQL ranks for matchRecipes to rank again with p.Has.
+// The search patterns match more names than p.Has covers, so a few more recipes are ranked than are kept.
+const matchCandidates = 4
+
+// matchRecipes finds the recipes with an ingredient covered by p, ranked by how many of their ingredients p covers.
+// SQL ranks the recipes by how many of their ingredients match the pantry's search patterns and keeps the best,
+// then only their ingredients are loaded for p.Has to decide what is covered.
+func matchRecipes(ctx context.Context, tx dbtx, p pantry.Pantry, limit int) ([]models.RecipeMatch, error) {
+	patterns := p.SearchPatterns()
+	if len(patterns) == 0 || limit <= 0 {
+		return nil, nil
+	}
+
+	// Patterns are made of letters only, so they need no escaping
+	conditions := make([]string, len(patterns))
+	args := make([]any, 0, len(patterns)+1)
+	for i, pattern := range patterns {
+		conditions[i] = "LOWER(name) LIKE ?"
+		args = append(args, "%"+pattern+"%")
+	}
+	args = append(args, limit*matchCandidates)
+	statement := `
+		SELECT
+		    recipe_id
+		FROM (
+		    SELECT
+		        recipe_id, SUM(CASE WHEN ` + strings.Join(conditions, " OR ") + ` THEN 1 ELSE 0 END) AS matched,
+		        COUNT(*) AS total
+		    FROM ingredients
+		    GROUP BY recipe_id
+		) AS counts
+		WHERE matched > 0
+		ORDER BY matched DESC, total - matched ASC, recipe_id DESC
+		LIMIT ?
+	`
+	candidates, err := queryIds(ctx, tx, statement, args...)
+	if err != nil || len(candidates) == 0 {
+		return nil, err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(candidates)), ",")
+	args = make([]any, len(candidates))
+	for i, id := range candidates {
+		args[i] = id
+	}
+	statement = `
+		SELECT
+		    recipes.id, recipes.title, recipes.user_id, users.name,
+		    ingredients.id, ingredients.name, ingredients.amount, ingredients.unit
+		FROM recipes
+		JOIN users ON users.id = recipes.user_id
+		JOIN ingredients ON ingredients.recipe_id = recipes.id
+		WHERE recipes.id IN (` + placeholders + `)
+		ORDER BY recipes.id, ingredients.position, ingredients.id
+	`
+	rows, err := tx.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipes []models.Recipe
+	for rows.Next() {
+		var recipe models.Recipe
+		var ingredient models.Ingredient
+		err = rows.Scan(
+			&recipe.ID, &recipe.Title, &recipe.UserId, &recipe.User.Name,
+			&ingredient.ID, &ingredient.Name, &ingredient.Amount, &ingredient.Unit,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if len(recipes) == 0 || recipes[len(recipes)-1].ID != recipe.ID {
+			recipes = append(recipes, recipe)
+		}
+		last := &recipes[len(recipes)-1]
+		last.Ingredients = append(last.Ingredients, ingredient)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return rankRecipeMatches(recipes, p, limit), nil
+}
+
+// queryIds runs a statement selecting a single column of IDs
+func queryIds(ctx context.Context, tx dbtx, statement string, args ...any) ([]int, error) {
+	rows, err := tx.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// rankRecipeMatches works out which ingredients of each recipe p covers, and keeps the limit best
+// recipes that have at least one. Recipes covering more ingredients come first, then those missing fewer.
+func rankRecipeMatches(recipes []models.Recipe, p pantry.Pantry, limit int) []models.RecipeMatch {
+	var matches []models.RecipeMatch
+	for _, recipe := range recipes {
+		match := models.RecipeMatch{Recipe: recipe}
+		for _, ingredient := range recipe.Ingredients {
+			if p.Has(ingredient.Name) {
+				match.Covered++
+			} else {
+				match.Missing = append(match.Missing, ingredient)
+			}
+		}
+		if match.Covered > 0 {
+			matches = append(matches, match)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Covered != b.Covered {
+			return a.Covered > b.Covered
+		}
+		if len(a.Missing) != len(b.Missing) {
+			return len(a.Missing) < len(b.Missing)
+		}
+		return a.Recipe.ID > b.Recipe.ID
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// countRecipes counts every recipe
+func countRecipes(ctx context.Context, tx dbtx) (int, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM recipes").Scan(&count)
+	return count, err
+}
+
+// insertRecipe inserts a new recipe row and returns its ID. The image is stored elsewhere, the row keeps its key.
+func insertRecipe(ctx context.Context, tx dbtx, title string, imageKey string, servings int, userId int) (int64, error) {
+	statement :=
+		`INSERT INTO recipes (title,image,image_key,servings,user_id, created_at, updated_at)
+ 		VALUES (?,'',?,?,?,?,?)
+		`
+	res, err := tx.ExecContext(ctx, statement, title, imageKey, servings, userId, time.Now(), time.Now())
+	if err != nil {
+		return -1, err
+	}
+
+	newId, err := res.LastInsertId()
+	if err != nil {
+		return -1, err
+	}
+
+	return newId, nil
+}
+
+// updateRecipe updates an existing recipe row and deletes its old ingredients, directions and photos.
+// The photos of the directions go with the directions.
+func updateRecipe(ctx context.Context, tx dbtx, jsonRecipe models.JsonRecipe) error {
+	var id int
+	row := tx.QueryRowContext(ctx, `SELECT id FROM recipes WHERE id = ?`, jsonRecipe.ID)
+	err := row.Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	statement := `UPDATE recipes SET title = ?, image_key=?, servings = ?, updated_at = ? WHERE id = ?`
+	_, err = tx.ExecContext(ctx, statement, jsonRecipe.Title, jsonRecipe.Image, jsonRecipe.Servings, time.Now(), jsonRecipe.ID)
+	if err != nil {
+		return err
+	}
+
+	// Delete old ingredients
+	deleteIngredients := `DELETE FROM ingredients WHERE recipe_id = ?`
+	_, err = tx.ExecContext(ctx, deleteIngredients, jsonRecipe.ID)
+	if err != nil {
+		return err
+	}
+
+	// Delete old directions
+	deleteDirections := `DELETE FROM directions WHERE recipe_id = ?`
+	_, err = tx.ExecContext(ctx, deleteDirections, jsonRecipe.ID)
+	if err != nil {
+		return err
+	}
+
+	// Delete old photos
+	_, err = tx.ExecContext(ctx, `DELETE FROM recipe_photos WHERE recipe_id = ?`, jsonRecipe.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// insertIngredient handles inserting an ingredient into the database at position in its recipe,
+// along with the quantity parsed from its amount. Amounts that can't be parsed have no quantity.
+func insertIngredient(ctx context.Context, tx dbtx, name, amount, unit string, position int, recipeId int64) error {
+	quantity, _ := models.ParseQuantity(amount)
+	statement :=
+		`INSERT INTO ingredients (name,amount,quantity_min,quantity_max,to_taste,unit,position,recipe_id, created_at, updated_at)
+ 		VALUES (?,?,?,?,?,?,?,?,?,?)
+		`
+	_, err := tx.ExecContext(ctx, statement, name, amount, quantity.Min, quantity.Max, quantity.ToTaste, unit, position, recipeId,
+		time.Now(), time.Now())
+	return err
+}
+
+// insertDirection handles inserting a direction into the database at position in its recipe and returns its ID
+func insertDirection(ctx context.Context, tx dbtx, direction string, position int, recipeId int64) (int64, error) {
+	statement :=
+		`INSERT INTO directions (direction,position,recipe_id, created_at, updated_at)
+ 		VALUES (?,?,?,?,?)
+		`
+	res, err := tx.ExecContext(ctx, statement, direction, position, recipeId, time.Now(), time.Now())
+	if err != nil {
+		return -1, err
+	}
+	return res.LastInsertId()
+}
+
+// getIngredients gets the ingredients of a recipe in order. Rows saved before there were positions
+// are all at 0, the ID keeps them in the order they were inserted in.
+func getIngredients(ctx context.Context, tx dbtx, recipeId int) ([]models.Ingredient, error) {
+	statement := `
+		SELECT id, name, amount, COALESCE(quantity_min, 0), COALESCE(quantity_max, 0), to_taste, unit, position
+		FROM ingredients
+		WHERE recipe_id = ?
+		ORDER BY position, id
+	`
+	rows, err := tx.QueryContext(ctx, statement, recipeId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ingredients []models.Ingredient
+	for rows.Next() {
+		var ingredient models.Ingredient
+		err = rows.Scan(&ingredient.ID, &ingredient.Name, &ingredient.Amount, &ingredient.Quantity.Min, &ingredient.Quantity.Max,
+			&ingredient.Quantity.ToTaste, &ingredient.Unit, &ingredient.Position)
+		if err != nil {
+			return nil, err
+		}
+		ingredients = append(ingredients, ingredient)
+	}
+	return ingredients, rows.Err()
+}
+
+// getDirections gets the directions of a recipe in order, like getIngredients
+func getDirections(ctx context.Context, tx dbtx, recipeId int) ([]models.Direction, error) {
+	statement := `
+		SELECT id, direction, position
+		FROM directions
+		WHERE recipe_id = ?
+		ORDER BY position, id
+	`
+	rows, err := tx.QueryContext(ctx, statement, recipeId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var directions []models.Direction
+	for rows.Next() {
+		var direction models.Direction
+		err = rows.Scan(&direction.ID, &direction.Direction, &direction.Position)
+		if err != nil {
+			return nil, err
+		}
+		directions = append(directions, direction)
+	}
+	return directions, rows.Err()
+}
+
+// reorderRecipe moves the ingredients and directions of a recipe to the positions of their IDs in order,
+// and marks the recipe as updated. An ID that isn't one of the recipe's is sql.ErrNoRows.
+func reorderRecipe(ctx context.Context, tx dbtx, recipeId int, order models.JsonRecipeOrder) error {
+	for table, ids := range map[string][]int{"ingredients": order.Ingredients, "directions": order.Directions} {
+		if len(ids) == 0 {
+			continue
+		}
+		// A row that keeps its position in the same second changes nothing and MySQL counts no affected rows,
+		// so the IDs are checked here instead of by the UPDATEs
+		args := []any{recipeId}
+		for _, id := range ids {
+			args = append(args, id)
+		}
+		var found int
+		err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table+` WHERE recipe_id = ? AND id IN (?`+
+			strings.Repeat(",?", len(ids)-1)+`)`, args...).Scan(&found)
+		if err != nil {
+			return err
+		}
+		if found != len(ids) {
+			return sql.ErrNoRows
+		}
+
+		statement := `UPDATE ` + table + ` SET position = ?, updated_at = ? WHERE id = ? AND recipe_id = ?`
+		for position, id := range ids {
+			_, err = tx.ExecContext(ctx, statement, position, time.Now(), id, recipeId)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, `UPDATE recipes SET updated_at = ? WHERE id = ?`, time.Now(), recipeId)
+	return err
+}
+
+// photoTables maps the tables of photos to the column of the recipe or direction they belong to
+var photoTables = map[string]string{
+	"recipe_photos":    "recipe_id",
+	"direction_photos": "direction_id",
+}
+
+// insertPhotos inserts the photos of the recipe or direction with ownerId into table, positioned in the order they are listed
+func insertPhotos(ctx context.Context, tx dbtx, table string, ownerId int64, photos []models.JsonPhoto) error {
+	column, ok := photoTables[table]
+	if !ok {
+		return fmt.Errorf("unknown photo table %q", table)
+	}
+	statement := `INSERT INTO ` + table + ` (` + column + `, image_key, caption, position, created_at, updated_at)
+		VALUES (?,?,?,?,?,?)
+		`
+	for position, photo := range photos {
+		_, err := tx.ExecContext(ctx, statement, ownerId, photo.Image, photo.Caption, position, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getRecipePhotos adds the photos of a recipe and of its directions to it, in order
+func getRecipePhotos(ctx context.Context, tx dbtx, recipe *models.Recipe) error {
+	photos, err := queryPhotos(ctx, tx, `
+		SELECT id, image_key, caption, position, recipe_id
+		FROM recipe_photos
+		WHERE recipe_id = ?
+		ORDER BY position, id
+	`, recipe.ID)
+	if err != nil {
+		return err
+	}
+	recipe.Photos = photos[recipe.ID]
+
+	photos, err = queryPhotos(ctx, tx, `
+		SELECT
+		    direction_photos.id, direction_photos.image_key, direction_photos.caption, direction_photos.position,
+		    direction_photos.direction_id
+		FROM direction_photos
+		JOIN directions ON directions.id = direction_photos.direction_id
+		WHERE directions.recipe_id = ?
+		ORDER BY direction_photos.position, direction_photos.id
+	`, recipe.ID)
+	if err != nil {
+		return err
+	}
+	for i := range recipe.Directions {
+		recipe.Directions[i].Photos = photos[recipe.Directions[i].ID]
+	}
+	return nil
+}
+
+// queryPhotos selects photos along with the ID of the recipe or direction they belong to, which they are keyed by
+func queryPhotos(ctx context.Context, tx dbtx, statement string, args ...any) (map[int][]models.Photo, error) {
+	rows, err := tx.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := make(map[int][]models.Photo)
+	for rows.Next() {
+		var photo models.Photo
+		var ownerId int
+		err = rows.Scan(&photo.ID, &photo.Image, &photo.Caption, &photo.Position, &ownerId)
+		if err != nil {
+			return nil, err
+		}
+		photos[ownerId] = append(photos[ownerId], photo)
+	}
+	return photos, rows.Err()
+}
+
+// getUserRoles gets the roles of a user keyed by role name
+func getUserRoles(ctx context.Context, tx dbtx, userId int) (map[string]models.Role, error) {
+	statement := `
+		SELECT
+		    roles.id, roles.role
+		FROM
+		    user_roles
+		JOIN roles ON roles.id = user_roles.role_id
+		WHERE
+		    user_roles.user_id = ?
+	`
+	rows, err := tx.QueryContext(ctx, statement, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make(map[string]models.Role)
+	for rows.Next() {
+		var role models.Role
+		err = rows.Scan(&role.ID, &role.Role)
+		if err != nil {
+			return nil, err
+		}
+		roles[role.Role] = role
+	}
+	return roles, rows.Err()
+}
+
+// assignRole gives a user a role, assigning a role the user already has does nothing
+func assignRole(ctx context.Context, tx dbtx, userId int, role string) error {
+	var roleId int
+	err := tx.QueryRowContext(ctx, `SELECT id FROM roles WHERE role = ?`, role).Scan(&roleId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	if err != nil {
+		return err
+	}
+
+	statement := `
+		INSERT INTO user_roles (user_id, role_id, created_at, updated_at)
+		SELECT ?, roles.id, ?, ? FROM roles
+		WHERE roles.id = ? AND NOT EXISTS (SELECT 1 FROM user_roles WHERE user_id = ? AND role_id = ?)
+	`
+	_, err = tx.ExecContext(ctx, statement, userId, time.Now(), time.Now(), roleId, userId, roleId)
+	return err
+}
+
+// revokeRole takes a role away from a user
+func revokeRole(ctx context.Context, tx dbtx, userId int, role string) error {
+	statement := `DELETE FROM user_roles WHERE user_id = ? AND role_id IN (SELECT id FROM roles WHERE role = ?)`
+	_, err := tx.ExecContext(ctx, statement, userId, role)
+	return err
+}
+
+// grantFirstUserAdmin makes the only user in the database an admin, so a new install can be administered.
+// Users signing up at once have to be serialized for only one of them to get it. SQLite writes one transaction at a
+// time, MySQL takes lockAdminRole before inserting the user. Without it InnoDB deadlocks the signups instead, each
+// waiting to check the other's new row.
+func grantFirstUserAdmin(ctx context.Context, tx dbtx, userId int) error {
+	statement := `
+		INSERT INTO user_roles (user_id, role_id, created_at, updated_at)
+		SELECT ?, roles.id, ?, ? FROM roles
+		WHERE roles.role = ? AND NOT EXISTS (SELECT 1 FROM users WHERE id <> ?)
+	`
+	_, err := tx.ExecContext(ctx, statement, userId, time.Now(), time.Now(), models.RoleAdmin, userId)
+	return err
+}
+
+// lockAdminRole locks the admin row of roles until the transaction ends, so signups on MySQL are serialized
+// for grantFirstUserAdmin. SQLite doesn't have SELECT ... FOR UPDATE, nor need it.
+func lockAdminRole(ctx context.Context, tx dbtx) error {
+	var roleId int
+	return tx.QueryRowContext(ctx, `SELECT id FROM roles WHERE role = ? FOR UPDATE`, models.RoleAdmin).Scan(&roleId)
+}
+
+// getAllUserRoles gets the roles of every user, keyed by user ID and then role name
+func getAllUserRoles(ctx context.Context, tx dbtx) (map[int]map[string]models.Role, error) {
+	statement := `
+		SELECT
+		    user_roles.user_id, roles.id, roles.role
+		FROM
+		    user_roles
+		JOIN roles ON roles.id = user_roles.role_id
+	`
+	rows, err := tx.QueryContext(ctx, statement)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userRoles := make(map[int]map[string]models.Role)
+	for rows.Next() {
+		var userId int
+		var role models.Role
+		err = rows.Scan(&userId, &role.ID, &role.Role)
+		if err != nil {
+			return nil, err
+		}
+		if userRoles[userId] == nil {
+			userRoles[userId] = make(map[string]models.Role)
+		}
+		userRoles[userId][role.Role] = role
+	}
+	return userRoles, rows.Err()
+}
+
+// setUserDisabled disables or re-enables a user account
+func setUserDisabled(ctx context.Context, tx dbtx, id int, disabled bool) error {
+	_, err := tx.ExecContext(ctx, `UPDATE users SET disabled = ?, updated_at = ? WHERE id = ?`, disabled, time.Now(), id)
+	return err
+}
+
+// deleteUser deletes a user, their recipes and roles are removed by the foreign keys
+func deleteUser(ctx context.Context, tx dbtx, id int) error {
+	res, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+// insertAdminAction records an action taken in the admin console
+func insertAdminAction(ctx context.Context, tx dbtx, action models.AdminAction) error {
+	statement :=
+		`INSERT INTO admin_actions (admin_id, admin_name, action, target_type, target_id, details, created_at, updated_at)
+		VALUES (?,?,?,?,?,?,?,?)
+		`
+	var adminId any
+	if action.AdminID != 0 {
+		adminId = action.AdminID
+	}
+	_, err := tx.ExecContext(ctx, statement, adminId, action.AdminName, action.Action, action.TargetType, action.TargetID,
+		action.Details, time.Now(), time.Now())
+	return err
+}
+
+// expectAffected turns an update or delete that matched no rows into sql.ErrNoRows
+func expectAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// mysqlTimeLayout is how MySQL sends DATETIME columns when it is connected without parseTime
+const mysqlTimeLayout = "2006-01-02 15:04:05"
+
+// scanTime scans a DATETIME column into t from either driver. SQLite returns a time.Time, MySQL returns text.
+func scanTime(t *time.Time) sql.Scanner {
+	return timeScanner{t}
+}
+
+type timeScanner struct {
+	t *time.Time
+}
+
+func (s timeScanner) Scan(src any) error {
+	var err error
+	switch v := src.(type) {
+	case time.Time:
+		*s.t = v
+	case []byte:
+		*s.t, err = time.Parse(mysqlTimeLayout, string(v))
+	case string:
+		*s.t, err = time.Parse(mysqlTimeLayout, v)
+	default:
+		err = fmt.Errorf("can't scan %T into a time", src)
+	}
+	return err
+}
+
+// insertApiToken stores the hash of a new API token
+func insertApiToken(ctx context.Context, tx dbtx, userId int, name, tokenHash string) (models.ApiToken, error) {
+	statement :=
+		`INSERT INTO api_tokens (user_id, name, token_hash, created_at, updated_at)
+		VALUES (?,?,?,?,?)
+		`
+	token := models.ApiToken{UserID: userId, Name: name, CreatedAt: time.Now()}
+	res, err := tx.ExecContext(ctx, statement, userId, name, tokenHash, token.CreatedAt, token.CreatedAt)
+	if err != nil {
+		return models.ApiToken{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.ApiToken{}, err
+	}
+	token.ID = int(id)
+	return token, nil
+}
+
+// useApiToken finds the user an API token belongs to and records that the token was used
+func useApiToken(ctx context.Context, tx dbtx, tokenHash string) (int, error) {
+	var userId int
+	err := tx.QueryRowContext(ctx, `SELECT user_id FROM api_tokens WHERE token_hash = ?`, tokenHash).Scan(&userId)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = ? WHERE token_hash = ?`, time.Now(), tokenHash)
+	return userId, err
+}
+
+// deleteApiToken deletes an API token of a user, deleting a token that doesn't exist or belongs to someone else is sql.ErrNoRows
+func deleteApiToken(ctx context.Context, tx dbtx, userId, id int) error {
+	res, err := tx.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, id, userId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+// insertShoppingList inserts a shopping list of a user along with its items, at their positions, and returns its ID
+func insertShoppingList(ctx context.Context, tx dbtx, userId int, name string, items []models.ShoppingListItem) (int64, error) {
+	now := time.Now()
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO shopping_lists (user_id, name, created_at, updated_at) VALUES (?,?,?,?)`, userId, name, now, now)
+	if err != nil {
+		return 0, err
+	}
+	listId, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	statement :=
+		`INSERT INTO shopping_list_items (shopping_list_id, name, amount, unit, section, checked, position, created_at, updated_at)
+		VALUES (?,?,?,?,?,?,?,?,?)
+		`
+	for _, item := range items {
+		_, err = tx.ExecContext(ctx, statement, listId, item.Name, item.Amount, item.Unit, item.Section, item.Checked,
+			item.Position, now, now)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return listId, nil
+}
+
+// listShoppingLists gets the shopping lists of a user without their items, the most recently changed first
+func listShoppingLists(ctx context.Context, tx dbtx, userId int) ([]models.ShoppingList, error) {
+	statement := `
+		SELECT
+		    id, user_id, name, created_at, updated_at
+		FROM
+		    shopping_lists
+		WHERE
+		    user_id = ?
+		ORDER BY updated_at DESC, id DESC
+	`
+	rows, err := tx.QueryContext(ctx, statement, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lists []models.ShoppingList
+	for rows.Next() {
+		var list models.ShoppingList
+		err = rows.Scan(&list.ID, &list.UserID, &list.Name, scanTime(&list.CreatedAt), scanTime(&list.UpdatedAt))
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, rows.Err()
+}
+
+// getShoppingList gets a shopping list of a user with its items in order.
+// A list that doesn't exist or belongs to someone else is sql.ErrNoRows.
+func getShoppingList(ctx context.Context, tx dbtx, userId, id int) (models.ShoppingList, error) {
+	var list models.ShoppingList
+	err := tx.QueryRowContext(ctx,
+		`SELECT id, user_id, name, created_at, updated_at FROM shopping_lists WHERE id = ? AND user_id = ?`, id, userId,
+	).Scan(&list.ID, &list.UserID, &list.Name, scanTime(&list.CreatedAt), scanTime(&list.UpdatedAt))
+	if err != nil {
+		return models.ShoppingList{}, err
+	}
+
+	statement := `
+		SELECT
+		    id, name, amount, unit, section, checked, position
+		FROM
+		    shopping_list_items
+		WHERE
+		    shopping_list_id = ?
+		ORDER BY position, id
+	`
+	rows, err := tx.QueryContext(ctx, statement, id)
+	if err != nil {
+		return models.ShoppingList{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.ShoppingListItem
+		err = rows.Scan(&item.ID, &item.Name, &item.Amount, &item.Unit, &item.Section, &item.Checked, &item.Position)
+		if err != nil {
+			return models.ShoppingList{}, err
+		}
+		list.Items = append(list.Items, item)
+	}
+	return list, rows.Err()
+}
+
+// checkShoppingListItem checks or unchecks an item of a user's shopping list and marks the list as updated.
+// An item that isn't on the list, or a list that belongs to someone else, is sql.ErrNoRows.
+func checkShoppingListItem(ctx context.Context, tx dbtx, userId, listId, itemId int, checked bool) error {
+	statement := `
+		SELECT
+		    shopping_list_items.id
+		FROM
+		    shopping_list_items
+		    JOIN shopping_lists ON shopping_lists.id = shopping_list_items.shopping_list_id
+		WHERE
+		    shopping_list_items.id = ? AND shopping_lists.id = ? AND shopping_lists.user_id = ?
+	`
+	var id int
+	err := tx.QueryRowContext(ctx, statement, itemId, listId, userId).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	// Checking an item that is already checked changes no rows in MySQL, so the SELECT above finds the item instead
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, `UPDATE shopping_list_items SET checked = ?, updated_at = ? WHERE id = ?`, checked, now, itemId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE shopping_lists SET updated_at = ? WHERE id = ?`, now, listId)
+	return err
+}
+
+// deleteShoppingList deletes a shopping list of a user, its items are removed by the foreign key.
+// Deleting a list that doesn't exist or belongs to someone else is sql.ErrNoRows.
+func deleteShoppingList(ctx context.Context, tx dbtx, userId, id int) error {
+	res, err := tx.ExecContext(ctx, `DELETE FROM shopping_lists WHERE id = ? AND user_id = ?`, id, userId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+// insertMeal plans a recipe for a user on the day of date, in slot, and returns the meal's ID
+func insertMeal(ctx context.Context, tx dbtx, userId, recipeId int, date time.Time, slot string) (int64, error) {
+	statement :=
+		`INSERT INTO meals (user_id, recipe_id, date, slot, created_at, updated_at)
+		VALUES (?,?,?,?,?,?)
+		`
+	res, err := tx.ExecContext(ctx, statement, userId, recipeId, date.Format(models.DateLayout), slot, time.Now(), time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// listMeals gets the meals a user planned from the day of from up to, but not including, the day of to, along with
+// the titles of their recipes. They are ordered by day and then by slot, breakfast first.
+func listMeals(ctx context.Context, tx dbtx, userId int, from, to time.Time) ([]models.Meal, error) {
+	statement := `
+		SELECT
+		    meals.id, meals.user_id, meals.recipe_id, recipes.title, meals.date, meals.slot, meals.created_at
+		FROM
+		    meals
+		    JOIN recipes ON recipes.id = meals.recipe_id
+		WHERE
+		    meals.user_id = ? AND meals.date >= ? AND meals.date < ?
+		ORDER BY meals.date, meals.id
+	`
+	rows, err := tx.QueryContext(ctx, statement, userId, from.Format(models.DateLayout), to.Format(models.DateLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var meals []models.Meal
+	for rows.Next() {
+		var meal models.Meal
+		var date string
+		err = rows.Scan(&meal.ID, &meal.UserID, &meal.RecipeID, &meal.RecipeTitle, &date, &meal.Slot, scanTime(&meal.CreatedAt))
+		if err != nil {
+			return nil, err
+		}
+		meal.Date, err = time.Parse(models.DateLayout, date)
+		if err != nil {
+			return nil, err
+		}
+		meals = append(meals, meal)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	// The slots aren't in alphabetical order, so they are sorted here
+	sort.SliceStable(meals, func(i, j int) bool {
+		if !meals[i].Date.Equal(meals[j].Date) {
+			return meals[i].Date.Before(meals[j].Date)
+		}
+		return slices.Index(models.MealSlots, meals[i].Slot) < slices.Index(models.MealSlots, meals[j].Slot)
+	})
+	return meals, nil
+}
+
+// deleteMeal deletes a meal a user planned, deleting a meal that doesn't exist or belongs to someone else is sql.ErrNoRows
+func deleteMeal(ctx context.Context, tx dbtx, userId, id int) error {
+	res, err := tx.ExecContext(ctx, `DELETE FROM meals WHERE id = ? AND user_id = ?`, id, userId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+// setCalendarToken stores the hash of a user's new calendar feed token, the old token stops working
+func setCalendarToken(ctx context.Context, tx dbtx, userId int, tokenHash string) error {
+	res, err := tx.ExecContext(ctx, `UPDATE users SET calendar_token_hash = ?, updated_at = ? WHERE id = ?`,
+		tokenHash, time.Now(), userId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+// getCalendarTokenUser finds the user a calendar feed token belongs to
+func getCalendarTokenUser(ctx context.Context, tx dbtx, tokenHash string) (int, error) {
+	var userId int
+	err := tx.QueryRowContext(ctx, `SELECT id FROM users WHERE calendar_token_hash = ?`, tokenHash).Scan(&userId)
+	return userId, err
+}
+
+// dataMigrated checks if the data migration called name has run on the database
+func dataMigrated(ctx context.Context, tx dbtx, name string) (bool, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM data_migrations WHERE name = ?`, name).Scan(&count)
+	return count > 0, err
+}
+
+// recordDataMigration records that the data migration called name ran, so it doesn't run again
+func recordDataMigration(ctx context.Context, tx dbtx, name string) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO data_migrations (name, created_at, updated_at) VALUES (?,?,?)`,
+		name, time.Now(), time.Now())
+	return err
+}
+
+// migrateInBatches runs migrate on the rows of a data migration a batch at a time. read gets the batch of rows
+// after lastID, the ID of the last row of the batch before, and reads them all before any is migrated, SQLite has
+// a single connection. migrate reports whether it changed its row, rows it skips are left for read to pass over.
+// It returns how many rows were changed.
+func migrateInBatches[T any](ctx context.Context, conn *sql.DB, read func(ctx context.Context, conn *sql.DB, lastID int) ([]T, error),
+	id func(row T) int, migrate func(row T) (bool, error)) (int, error) {
+	changed, lastID := 0, 0
+	for {
+		rows, err := read(ctx, conn, lastID)
+		if err != nil || len(rows) == 0 {
+			return changed, err
+		}
+
+		for _, row := range rows {
+			lastID = id(row)
+			done, err := migrate(row)
+			if err != nil {
+				return changed, err
+			}
+			if done {
+				changed++
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"io"
+	"testing"
+	"time"
+)
+
+// textConnector answers each query with the next of its results, sending every value as text the way MySQL does
+// when it is connected without parseTime. It runs the shared statements through MySQL's scan path without a server.
+// Every UPDATE changes no rows, like MySQL when the values are the ones a row already has.
+type textConnector struct {
+	results [][][]string
+}
+
+func (c *textConnector) Connect(context.Context) (driver.Conn, error) { return textConn{c}, nil }
+func (c *textConnector) Driver() driver.Driver                        { return nil }
+
+type textConn struct {
+	c *textConnector
+}
+
+func (conn textConn) Prepare(string) (driver.Stmt, error) { return textStmt(conn), nil }
+func (conn textConn) Close() error                        { return nil }
+func (conn textConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions aren't supported")
+}
+
+type textStmt struct {
+	c *textConnector
+}
+
+func (s textStmt) Close() error  { return nil }
+func (s textStmt) NumInput() int { return -1 }
+func (s textStmt) Exec([]driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+func (s textStmt) Query([]driver.Value) (driver.Rows, error) {
+	if len(s.c.results) == 0 {
+		return nil, errors.New("no more results")
+	}
+	result := s.c.results[0]
+	s.c.results = s.c.results[1:]
+	rows := &textRows{rows: result}
+	if len(result) > 0 {
+		rows.columns = make([]string, len(result[0]))
+	}
+	return rows, nil
+}
+
+type textRows struct {
+	columns []string
+	rows    [][]string
+}
+
+func (r *textRows) Columns() []string { return r.columns }
+func (r *textRows) Close() error      { return nil }
+func (r *textRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	for i, value := range r.rows[0] {
+		dest[i] = []byte(value)
+	}
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// newTextDB opens a database that answers its queries with results, in order
+func newTextDB(t *testing.T, results ...[][]string) *sql.DB {
+	t.Helper()
+	db := sql.OpenDB(&textConnector{results: results})
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestTextShoppingLists(t *testing.T) {
+	ctx := context.Background()
+	db := newTextDB(t,
+		[][]string{{"1", "2", "Week 1", "2024-04-12 09:00:00", "2024-04-13 10:30:00"}},
+		[][]string{{"1", "2", "Week 1", "2024-04-12 09:00:00", "2024-04-13 10:30:00"}},
+		[][]string{{"5", "tomatoes", "1-2", "lb", "Produce", "1", "0"}},
+	)
+
+	lists, err := listShoppingLists(ctx, db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 1 || !lists[0].UpdatedAt.Equal(time.Date(2024, 4, 13, 10, 30, 0, 0, time.UTC)) {
+		t.Errorf("unexpected lists %+v", lists)
+	}
+
+	list, err := getShoppingList(ctx, db, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !list.CreatedAt.Equal(time.Date(2024, 4, 12, 9, 0, 0, 0, time.UTC)) || len(list.Items) != 1 || !list.Items[0].Checked {
+		t.Errorf("unexpected list %+v", list)
+	}
+}
+
+func TestTextMeals(t *testing.T) {
+	db := newTextDB(t, [][]string{
+		{"7", "2", "3", "Soup", "2024-04-13", "dinner", "2024-04-12 09:00:00"},
+		{"8", "2", "3", "Soup", "2024-04-13", "breakfast", "2024-04-12 09:05:00"},
+	})
+
+	from, to := time.Date(2024, 4, 8, 0, 0, 0, 0, time.UTC), time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC)
+	meals, err := listMeals(context.Background(), db, 2, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meals) != 2 || meals[0].ID != 8 || !meals[1].Date.Equal(time.Date(2024, 4, 13, 0, 0, 0, 0, time.UTC)) ||
+		!meals[1].CreatedAt.Equal(time.Date(2024, 4, 12, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected meals %+v", meals)
+	}
+}
+
+func TestTextReorderRecipe(t *testing.T) {
+	db := newTextDB(t, [][]string{{"2"}}, [][]string{{"1"}})
+
+	order := models.JsonRecipeOrder{Ingredients: []int{4, 3}, Directions: []int{5}}
+	err := reorderRecipe(context.Background(), db, 1, order)
+	if err != nil {
+		t.Errorf("expected rows that keep their values to be reordered, got %v", err)
+	}
+
+	db = newTextDB(t, [][]string{{"1"}})
+	err = reorderRecipe(context.Background(), db, 1, models.JsonRecipeOrder{Ingredients: []int{4, 9}})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected no rows for an ID of another recipe, got %v", err)
+	}
+}
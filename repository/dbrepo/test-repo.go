@@ -0,0 +1,868 @@
+package dbrepo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/popnfresh234/recipe-app-golang/internal/config"
+	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"github.com/popnfresh234/recipe-app-golang/internal/pantry"
+	"github.com/popnfresh234/recipe-app-golang/repository"
+	"golang.org/x/crypto/bcrypt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// testDBRepo is an in-memory DatabaseRepo used by the tests
+type testDBRepo struct {
+	App *config.AppConfig
+
+	mu          sync.Mutex
+	lastId      int
+	users       map[int]models.User
+	recipes     map[int]models.Recipe
+	ingredients map[int][]models.Ingredient
+	directions  map[int][]models.Direction
+	userRoles   map[int]map[string]models.Role
+	actions     []models.AdminAction
+	apiTokens   map[string]models.ApiToken
+	lists       map[int]models.ShoppingList
+	meals       map[int]models.Meal
+	feedTokens  map[string]int // the users calendar feed tokens belong to, keyed by their hashes
+	uploads     []testUpload
+}
+
+// testUpload is an image a user uploaded, like a row of uploads
+type testUpload struct {
+	userId    int
+	key       string
+	createdAt time.Time
+}
+
+// testRoles are the roles seeded by the migrations
+var testRoles = map[string]models.Role{
+	models.RoleAdmin:  {ID: 1, Role: models.RoleAdmin},
+	models.RoleEditor: {ID: 2, Role: models.RoleEditor},
+}
+
+// NewTestingRepo creates an empty in-memory repo
+func NewTestingRepo(app *config.AppConfig) repository.DatabaseRepo {
+	return &testDBRepo{
+		App:         app,
+		users:       make(map[int]models.User),
+		recipes:     make(map[int]models.Recipe),
+		ingredients: make(map[int][]models.Ingredient),
+		directions:  make(map[int][]models.Direction),
+		userRoles:   make(map[int]map[string]models.Role),
+		apiTokens:   make(map[string]models.ApiToken),
+		lists:       make(map[int]models.ShoppingList),
+		meals:       make(map[int]models.Meal),
+		feedTokens:  make(map[string]int),
+	}
+}
+
+// nextId hands out IDs the way an auto increment column would
+func (dbRepo *testDBRepo) nextId() int {
+	dbRepo.lastId++
+	return dbRepo.lastId
+}
+
+// GetAllRecipes gets every recipe along with the name of its author
+func (dbRepo *testDBRepo) GetAllRecipes() ([]models.Recipe, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	var recipes []models.Recipe
+	for _, recipe := range dbRepo.recipes {
+		recipe.User = models.User{Name: dbRepo.users[recipe.UserId].Name}
+		recipes = append(recipes, recipe)
+	}
+	sort.Slice(recipes, func(i, j int) bool {
+		return recipes[i].ID < recipes[j].ID
+	})
+	return recipes, nil
+}
+
+// ListRecipes gets a page of recipes in the given sort order, along with the total number of recipes
+func (dbRepo *testDBRepo) ListRecipes(offset, limit int, sortBy string) ([]models.Recipe, int, error) {
+	recipes, err := dbRepo.GetAllRecipes()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Ties are broken by ID like in the SQL repos
+	var less func(a, b models.Recipe) bool
+	switch sortBy {
+	case models.SortNewest:
+		less = func(a, b models.Recipe) bool {
+			return a.CreatedAt.After(b.CreatedAt) || a.CreatedAt.Equal(b.CreatedAt) && a.ID > b.ID
+		}
+	case models.SortOldest:
+		less = func(a, b models.Recipe) bool {
+			return a.CreatedAt.Before(b.CreatedAt) || a.CreatedAt.Equal(b.CreatedAt) && a.ID < b.ID
+		}
+	case models.SortUpdated:
+		less = func(a, b models.Recipe) bool {
+			return a.UpdatedAt.After(b.UpdatedAt) || a.UpdatedAt.Equal(b.UpdatedAt) && a.ID > b.ID
+		}
+	case models.SortTitle:
+		less = func(a, b models.Recipe) bool {
+			return a.Title < b.Title || a.Title == b.Title && a.ID < b.ID
+		}
+	default:
+		return nil, 0, fmt.Errorf("unknown sort %q", sortBy)
+	}
+	sort.Slice(recipes, func(i, j int) bool {
+		return less(recipes[i], recipes[j])
+	})
+
+	return pageOf(recipes, offset, limit), len(recipes), nil
+}
+
+// SearchRecipes gets a page of the recipes matching query, most relevant first, along with the number of matches.
+// Each word of the title, ingredients and directions that matches a term scores the weight of where it was found.
+func (dbRepo *testDBRepo) SearchRecipes(query string, offset, limit int) ([]models.Recipe, int, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	terms := make(map[string]bool)
+	for _, term := range searchTerms(query) {
+		terms[term] = true
+	}
+	score := func(text string, weight int) int {
+		n := 0
+		for _, word := range searchTerms(text) {
+			if terms[word] {
+				n += weight
+			}
+		}
+		return n
+	}
+
+	var recipes []models.Recipe
+	scores := make(map[int]int)
+	for _, recipe := range dbRepo.recipes {
+		total := score(recipe.Title, searchTitleWeight)
+		for _, ingredient := range dbRepo.ingredients[recipe.ID] {
+			total += score(ingredient.Name, searchIngredientsWeight)
+		}
+		for _, direction := range dbRepo.directions[recipe.ID] {
+			total += score(direction.Direction, searchDirectionsWeight)
+		}
+		if total == 0 {
+			continue
+		}
+
+		recipe.User = models.User{Name: dbRepo.users[recipe.UserId].Name}
+		recipes = append(recipes, recipe)
+		scores[recipe.ID] = total
+	}
+	sort.Slice(recipes, func(i, j int) bool {
+		a, b := recipes[i], recipes[j]
+		return scores[a.ID] > scores[b.ID] || scores[a.ID] == scores[b.ID] && a.ID > b.ID
+	})
+
+	return pageOf(recipes, offset, limit), len(recipes), nil
+}
+
+// MatchRecipes finds up to limit recipes that can be cooked, at least in part, with the ingredients in p
+func (dbRepo *testDBRepo) MatchRecipes(p pantry.Pantry, limit int) ([]models.RecipeMatch, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	var recipes []models.Recipe
+	for _, recipe := range dbRepo.recipes {
+		recipe.Image = ""
+		recipe.User = models.User{Name: dbRepo.users[recipe.UserId].Name}
+		recipe.Ingredients = append([]models.Ingredient(nil), dbRepo.ingredients[recipe.ID]...)
+		recipes = append(recipes, recipe)
+	}
+	return rankRecipeMatches(recipes, p, limit), nil
+}
+
+// GetRecipeDetails gets a recipe by ID
+func (dbRepo *testDBRepo) GetRecipeDetails(recipeId int) (models.Recipe, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	recipe, ok := dbRepo.recipes[recipeId]
+	if !ok {
+		return models.Recipe{}, sql.ErrNoRows
+	}
+	user := dbRepo.users[recipe.UserId]
+	recipe.User = models.User{ID: user.ID, Name: user.Name, Email: user.Email}
+	recipe.Ingredients = append([]models.Ingredient(nil), dbRepo.ingredients[recipeId]...)
+	recipe.Directions = append([]models.Direction(nil), dbRepo.directions[recipeId]...)
+	return recipe, nil
+}
+
+// SaveRecipe inserts or updates a recipe and replaces its ingredients, directions and photos
+func (dbRepo *testDBRepo) SaveRecipe(jsonRecipe models.JsonRecipe, userId int) (int64, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	oldImages := dbRepo.imageKeys(jsonRecipe.ID)
+	recipe, ok := dbRepo.recipes[jsonRecipe.ID]
+	if jsonRecipe.ID == 0 {
+		if _, ok := dbRepo.users[userId]; !ok {
+			return -1, errors.New("foreign key constraint failed")
+		}
+		recipe = models.Recipe{ID: dbRepo.nextId(), UserId: userId, CreatedAt: time.Now()}
+	} else if !ok {
+		return -1, sql.ErrNoRows
+	}
+	recipe.Title = jsonRecipe.Title
+	recipe.Image = jsonRecipe.Image
+	recipe.Servings = jsonRecipe.Servings
+	recipe.Photos = dbRepo.photos(jsonRecipe.Photos)
+	recipe.UpdatedAt = time.Now()
+
+	var ingredients []models.Ingredient
+	for position, ingredient := range jsonRecipe.Ingredients {
+		quantity, _ := models.ParseQuantity(ingredient.Amount)
+		ingredients = append(ingredients, models.Ingredient{
+			ID:       dbRepo.nextId(),
+			Name:     ingredient.Name,
+			Amount:   ingredient.Amount,
+			Quantity: quantity,
+			Unit:     ingredient.Unit,
+			Position: position,
+		})
+	}
+
+	var directions []models.Direction
+	for position, direction := range jsonRecipe.Directions {
+		directions = append(directions, models.Direction{
+			ID:        dbRepo.nextId(),
+			Direction: direction.Direction,
+			Position:  position,
+			Photos:    dbRepo.photos(direction.Photos),
+		})
+	}
+
+	dbRepo.recipes[recipe.ID] = recipe
+	dbRepo.ingredients[recipe.ID] = ingredients
+	dbRepo.directions[recipe.ID] = directions
+	removeImages(dbRepo.App.Images, dbRepo.unusedImageKeys(oldImages))
+	return int64(recipe.ID), nil
+}
+
+// imageKeys gets the keys of the images of a recipe, its own image and the photos of it and its directions
+func (dbRepo *testDBRepo) imageKeys(recipeId int) []string {
+	recipe, ok := dbRepo.recipes[recipeId]
+	if !ok {
+		return nil
+	}
+	var keys []string
+	if recipe.Image != "" {
+		keys = append(keys, recipe.Image)
+	}
+	for _, photo := range recipe.Photos {
+		keys = append(keys, photo.Image)
+	}
+	for _, direction := range dbRepo.directions[recipeId] {
+		for _, photo := range direction.Photos {
+			keys = append(keys, photo.Image)
+		}
+	}
+	return keys
+}
+
+// unusedImageKeys keeps the keys that no recipe uses, and that no upload is waiting to be used for
+func (dbRepo *testDBRepo) unusedImageKeys(keys []string) []string {
+	used := make(map[string]bool)
+	for recipeId := range dbRepo.recipes {
+		for _, key := range dbRepo.imageKeys(recipeId) {
+			used[key] = true
+		}
+	}
+	for _, upload := range dbRepo.uploads {
+		used[upload.key] = true
+	}
+	var unused []string
+	for _, key := range keys {
+		if !used[key] && !slices.Contains(unused, key) {
+			unused = append(unused, key)
+		}
+	}
+	return unused
+}
+
+// photos converts the photos of a posted recipe or direction, positioned in the order they are listed
+func (dbRepo *testDBRepo) photos(jsonPhotos []models.JsonPhoto) []models.Photo {
+	var photos []models.Photo
+	for position, photo := range jsonPhotos {
+		photos = append(photos, models.Photo{ID: dbRepo.nextId(), Image: photo.Image, Caption: photo.Caption, Position: position})
+	}
+	return photos
+}
+
+// ReorderRecipe moves the ingredients and directions of a recipe to the positions of their IDs in order.
+// An ID that isn't one of the recipe's is sql.ErrNoRows and nothing is moved.
+func (dbRepo *testDBRepo) ReorderRecipe(recipeId int, order models.JsonRecipeOrder) error {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	recipe, ok := dbRepo.recipes[recipeId]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	ingredients, err := reorder(dbRepo.ingredients[recipeId], order.Ingredients, func(ingredient *models.Ingredient) *int {
+		return &ingredient.ID
+	}, func(ingredient *models.Ingredient) *int { return &ingredient.Position })
+	if err != nil {
+		return err
+	}
+	directions, err := reorder(dbRepo.directions[recipeId], order.Directions, func(direction *models.Direction) *int {
+		return &direction.ID
+	}, func(direction *models.Direction) *int { return &direction.Position })
+	if err != nil {
+		return err
+	}
+
+	recipe.UpdatedAt = time.Now()
+	dbRepo.recipes[recipeId] = recipe
+	dbRepo.ingredients[recipeId] = ingredients
+	dbRepo.directions[recipeId] = directions
+	return nil
+}
+
+// reorder returns a copy of items with the item with each of ids moved to its position in ids, ordered by position.
+// Items that aren't in ids keep their position, like rows the SQL repos don't update.
+func reorder[T any](items []T, ids []int, id, position func(*T) *int) ([]T, error) {
+	reordered := append([]T(nil), items...)
+	for newPosition, itemId := range ids {
+		i := slices.IndexFunc(reordered, func(item T) bool { return *id(&item) == itemId })
+		if i < 0 {
+			return nil, sql.ErrNoRows
+		}
+		*position(&reordered[i]) = newPosition
+	}
+	slices.SortStableFunc(reordered, func(a, b T) int { return *position(&a) - *position(&b) })
+	return reordered, nil
+}
+
+// GetUserByEmail looks up a user by email and checks their password
+func (dbRepo *testDBRepo) GetUserByEmail(email, password string) (models.User, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	for _, user := range dbRepo.users {
+		if user.Email != email {
+			continue
+		}
+		err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+		if err != nil {
+			return models.User{}, errors.New("incorrect password")
+		}
+		return user, nil
+	}
+	return models.User{}, sql.ErrNoRows
+}
+
+// InsertUser inserts a new user, emails must be unique and the first user becomes an admin
+func (dbRepo *testDBRepo) InsertUser(name, email, password string) (models.User, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	for _, user := range dbRepo.users {
+		if user.Email == email {
+			return models.User{}, errors.New("duplicate email")
+		}
+	}
+
+	user := models.User{
+		ID:        dbRepo.nextId(),
+		Image:     []byte{},
+		Name:      name,
+		Email:     email,
+		Password:  password,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	dbRepo.users[user.ID] = user
+	if len(dbRepo.users) == 1 {
+		dbRepo.userRoles[user.ID] = map[string]models.Role{models.RoleAdmin: testRoles[models.RoleAdmin]}
+	}
+	user.Roles = dbRepo.copyRoles(user.ID)
+	return user, nil
+}
+
+// DeleteRecipe deletes a recipe along with its ingredients and directions
+func (dbRepo *testDBRepo) DeleteRecipe(id int) error {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	keys := dbRepo.imageKeys(id)
+	delete(dbRepo.recipes, id)
+	delete(dbRepo.ingredients, id)
+	delete(dbRepo.directions, id)
+	for mealId, meal := range dbRepo.meals {
+		if meal.RecipeID == id {
+			delete(dbRepo.meals, mealId)
+		}
+	}
+	removeImages(dbRepo.App.Images, dbRepo.unusedImageKeys(keys))
+	return nil
+}
+
+// pageOf returns the recipes of a page, like LIMIT and OFFSET would
+func pageOf(recipes []models.Recipe, offset, limit int) []models.Recipe {
+	if offset > len(recipes) {
+		offset = len(recipes)
+	}
+	end := offset + limit
+	if end > len(recipes) {
+		end = len(recipes)
+	}
+	return recipes[offset:end]
+}
+
+// copyRoles copies the roles of a user so callers can't change the stored map
+func (dbRepo *testDBRepo) copyRoles(userId int) map[string]models.Role {
+	roles := make(map[string]models.Role)
+	for name, role := range dbRepo.userRoles[userId] {
+		roles[name] = role
+	}
+	return roles
+}
+
+// GetUserRoles gets the roles of a user keyed by role name
+func (dbRepo *testDBRepo) GetUserRoles(userId int) (map[string]models.Role, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	return dbRepo.copyRoles(userId), nil
+}
+
+// AssignRole gives a user one of the seeded roles
+func (dbRepo *testDBRepo) AssignRole(userId int, role string) error {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	r, ok := testRoles[role]
+	if !ok {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	if dbRepo.userRoles[userId] == nil {
+		dbRepo.userRoles[userId] = make(map[string]models.Role)
+	}
+	dbRepo.userRoles[userId][role] = r
+	return nil
+}
+
+// RevokeRole takes a role away from a user
+func (dbRepo *testDBRepo) RevokeRole(userId int, role string) error {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	delete(dbRepo.userRoles[userId], role)
+	return nil
+}
+
+// GetUserById gets a user and their roles by ID
+func (dbRepo *testDBRepo) GetUserById(id int) (models.User, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	user, ok := dbRepo.users[id]
+	if !ok {
+		return models.User{}, sql.ErrNoRows
+	}
+	user.Password = ""
+	user.Roles = dbRepo.copyRoles(id)
+	return user, nil
+}
+
+// ListUsers gets every user whose name or email contains search, along with their roles
+func (dbRepo *testDBRepo) ListUsers(search string) ([]models.User, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	search = strings.ToLower(search)
+	var users []models.User
+	for _, user := range dbRepo.users {
+		if !strings.Contains(strings.ToLower(user.Name), search) && !strings.Contains(strings.ToLower(user.Email), search) {
+			continue
+		}
+		user.Password = ""
+		user.Roles = dbRepo.copyRoles(user.ID)
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+	return users, nil
+}
+
+// SetUserDisabled disables or re-enables a user account
+func (dbRepo *testDBRepo) SetUserDisabled(id int, disabled bool) error {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	user, ok := dbRepo.users[id]
+	if !ok {
+		return nil
+	}
+	user.Disabled = disabled
+	user.UpdatedAt = time.Now()
+	dbRepo.users[id] = user
+	return nil
+}
+
+// DeleteUser deletes a user along with their recipes
+func (dbRepo *testDBRepo) DeleteUser(id int) error {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	if _, ok := dbRepo.users[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(dbRepo.users, id)
+	delete(dbRepo.userRoles, id)
+	for hash, token := range dbRepo.apiTokens {
+		if token.UserID == id {
+			delete(dbRepo.apiTokens, hash)
+		}
+	}
+	for listId, list := range dbRepo.lists {
+		if list.UserID == id {
+			delete(dbRepo.lists, listId)
+		}
+	}
+	for mealId, meal := range dbRepo.meals {
+		if meal.UserID == id || dbRepo.recipes[meal.RecipeID].UserId == id {
+			delete(dbRepo.meals, mealId)
+		}
+	}
+	for hash, userId := range dbRepo.feedTokens {
+		if userId == id {
+			delete(dbRepo.feedTokens, hash)
+		}
+	}
+	dbRepo.uploads = slices.DeleteFunc(dbRepo.uploads, func(upload testUpload) bool { return upload.userId == id })
+	for recipeId, recipe := range dbRepo.recipes {
+		if recipe.UserId == id {
+			delete(dbRepo.recipes, recipeId)
+			delete(dbRepo.ingredients, recipeId)
+			delete(dbRepo.directions, recipeId)
+		}
+	}
+	for i := range dbRepo.actions {
+		if dbRepo.actions[i].AdminID == id {
+			dbRepo.actions[i].AdminID = 0
+		}
+	}
+	return nil
+}
+
+// InsertAdminAction records an action taken in the admin console
+func (dbRepo *testDBRepo) InsertAdminAction(action models.AdminAction) error {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	action.ID = dbRepo.nextId()
+	action.CreatedAt = time.Now()
+	dbRepo.actions = append(dbRepo.actions, action)
+	return nil
+}
+
+// GetAdminActions gets the most recent admin actions, newest first
+func (dbRepo *testDBRepo) GetAdminActions(limit int) ([]models.AdminAction, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	var actions []models.AdminAction
+	for i := len(dbRepo.actions) - 1; i >= 0 && len(actions) < limit; i-- {
+		actions = append(actions, dbRepo.actions[i])
+	}
+	return actions, nil
+}
+
+// InsertApiToken stores a new API token for a user, keyed by its hash
+func (dbRepo *testDBRepo) InsertApiToken(userId int, name, tokenHash string) (models.ApiToken, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	if _, ok := dbRepo.users[userId]; !ok {
+		return models.ApiToken{}, errors.New("foreign key constraint failed")
+	}
+	if _, ok := dbRepo.apiTokens[tokenHash]; ok {
+		return models.ApiToken{}, errors.New("duplicate token hash")
+	}
+	token := models.ApiToken{ID: dbRepo.nextId(), UserID: userId, Name: name, CreatedAt: time.Now()}
+	dbRepo.apiTokens[tokenHash] = token
+	return token, nil
+}
+
+// GetUserByApiToken gets the user, and their roles, that the token with tokenHash belongs to
+func (dbRepo *testDBRepo) GetUserByApiToken(tokenHash string) (models.User, error) {
+	dbRepo.mu.Lock()
+	token, ok := dbRepo.apiTokens[tokenHash]
+	if ok {
+		token.LastUsedAt = time.Now()
+		dbRepo.apiTokens[tokenHash] = token
+	}
+	dbRepo.mu.Unlock()
+
+	if !ok {
+		return models.User{}, sql.ErrNoRows
+	}
+	return dbRepo.GetUserById(token.UserID)
+}
+
+// ListApiTokens gets the API tokens of a user, newest first
+func (dbRepo *testDBRepo) ListApiTokens(userId int) ([]models.ApiToken, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	var tokens []models.ApiToken
+	for _, token := range dbRepo.apiTokens {
+		if token.UserID == userId {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].ID > tokens[j].ID
+	})
+	return tokens, nil
+}
+
+// DeleteApiToken revokes an API token of a user
+func (dbRepo *testDBRepo) DeleteApiToken(userId, id int) error {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	for hash, token := range dbRepo.apiTokens {
+		if token.ID == id && token.UserID == userId {
+			delete(dbRepo.apiTokens, hash)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// InsertShoppingList saves a shopping list for a user along with its items
+func (dbRepo *testDBRepo) InsertShoppingList(userId int, name string, items []models.ShoppingListItem) (int64, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	if _, ok := dbRepo.users[userId]; !ok {
+		return -1, errors.New("foreign key constraint failed")
+	}
+	now := time.Now()
+	list := models.ShoppingList{ID: dbRepo.nextId(), UserID: userId, Name: name, CreatedAt: now, UpdatedAt: now}
+	for _, item := range items {
+		item.ID = dbRepo.nextId()
+		list.Items = append(list.Items, item)
+	}
+	dbRepo.lists[list.ID] = list
+	return int64(list.ID), nil
+}
+
+// ListShoppingLists gets the shopping lists of a user without their items, the most recently changed first
+func (dbRepo *testDBRepo) ListShoppingLists(userId int) ([]models.ShoppingList, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	var lists []models.ShoppingList
+	for _, list := range dbRepo.lists {
+		if list.UserID == userId {
+			list.Items = nil
+			lists = append(lists, list)
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool {
+		if !lists[i].UpdatedAt.Equal(lists[j].UpdatedAt) {
+			return lists[i].UpdatedAt.After(lists[j].UpdatedAt)
+		}
+		return lists[i].ID > lists[j].ID
+	})
+	return lists, nil
+}
+
+// GetShoppingList gets a shopping list of a user with its items in order
+func (dbRepo *testDBRepo) GetShoppingList(userId, id int) (models.ShoppingList, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	list, ok := dbRepo.lists[id]
+	if !ok || list.UserID != userId {
+		return models.ShoppingList{}, sql.ErrNoRows
+	}
+	list.Items = slices.Clone(list.Items)
+	sort.SliceStable(list.Items, func(i, j int) bool {
+		return list.Items[i].Position < list.Items[j].Position
+	})
+	return list, nil
+}
+
+// CheckShoppingListItem checks or unchecks an item of a user's shopping list
+func (dbRepo *testDBRepo) CheckShoppingListItem(userId, listId, itemId int, checked bool) error {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	list, ok := dbRepo.lists[listId]
+	if !ok || list.UserID != userId {
+		return sql.ErrNoRows
+	}
+	i := slices.IndexFunc(list.Items, func(item models.ShoppingListItem) bool {
+		return item.ID == itemId
+	})
+	if i < 0 {
+		return sql.ErrNoRows
+	}
+	list.Items = slices.Clone(list.Items)
+	list.Items[i].Checked = checked
+	list.UpdatedAt = time.Now()
+	dbRepo.lists[listId] = list
+	return nil
+}
+
+// DeleteShoppingList deletes a shopping list of a user
+func (dbRepo *testDBRepo) DeleteShoppingList(userId, id int) error {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	list, ok := dbRepo.lists[id]
+	if !ok || list.UserID != userId {
+		return sql.ErrNoRows
+	}
+	delete(dbRepo.lists, id)
+	return nil
+}
+
+// InsertMeal plans a recipe for a user on the day of date, in slot
+func (dbRepo *testDBRepo) InsertMeal(userId, recipeId int, date time.Time, slot string) (int64, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	_, userFound := dbRepo.users[userId]
+	_, recipeFound := dbRepo.recipes[recipeId]
+	if !userFound || !recipeFound {
+		return -1, errors.New("foreign key constraint failed")
+	}
+	day, err := time.Parse(models.DateLayout, date.Format(models.DateLayout))
+	if err != nil {
+		return -1, err
+	}
+	meal := models.Meal{ID: dbRepo.nextId(), UserID: userId, RecipeID: recipeId, Date: day, Slot: slot, CreatedAt: time.Now()}
+	dbRepo.meals[meal.ID] = meal
+	return int64(meal.ID), nil
+}
+
+// ListMeals gets the meals a user planned from the day of from up to, but not including, the day of to
+func (dbRepo *testDBRepo) ListMeals(userId int, from, to time.Time) ([]models.Meal, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	start, end := from.Format(models.DateLayout), to.Format(models.DateLayout)
+	var meals []models.Meal
+	for _, meal := range dbRepo.meals {
+		day := meal.Date.Format(models.DateLayout)
+		if meal.UserID == userId && day >= start && day < end {
+			meal.RecipeTitle = dbRepo.recipes[meal.RecipeID].Title
+			meals = append(meals, meal)
+		}
+	}
+	sort.Slice(meals, func(i, j int) bool {
+		if !meals[i].Date.Equal(meals[j].Date) {
+			return meals[i].Date.Before(meals[j].Date)
+		}
+		if meals[i].Slot != meals[j].Slot {
+			return slices.Index(models.MealSlots, meals[i].Slot) < slices.Index(models.MealSlots, meals[j].Slot)
+		}
+		return meals[i].ID < meals[j].ID
+	})
+	return meals, nil
+}
+
+// DeleteMeal deletes a meal a user planned
+func (dbRepo *testDBRepo) DeleteMeal(userId, id int) error {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	meal, ok := dbRepo.meals[id]
+	if !ok || meal.UserID != userId {
+		return sql.ErrNoRows
+	}
+	delete(dbRepo.meals, id)
+	return nil
+}
+
+// SetCalendarToken stores the hash of a user's new calendar feed token, the old token stops working
+func (dbRepo *testDBRepo) SetCalendarToken(userId int, tokenHash string) error {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	if _, ok := dbRepo.users[userId]; !ok {
+		return sql.ErrNoRows
+	}
+	for hash, id := range dbRepo.feedTokens {
+		if id == userId {
+			delete(dbRepo.feedTokens, hash)
+		}
+	}
+	dbRepo.feedTokens[tokenHash] = userId
+	return nil
+}
+
+// GetUserByCalendarToken gets the user, and their roles, that the calendar feed token with tokenHash belongs to
+func (dbRepo *testDBRepo) GetUserByCalendarToken(tokenHash string) (models.User, error) {
+	dbRepo.mu.Lock()
+	userId, ok := dbRepo.feedTokens[tokenHash]
+	dbRepo.mu.Unlock()
+
+	if !ok {
+		return models.User{}, sql.ErrNoRows
+	}
+	return dbRepo.GetUserById(userId)
+}
+
+// InsertUpload records that a user uploaded the image with key, so it is kept until a recipe uses it
+func (dbRepo *testDBRepo) InsertUpload(userId int, key string) error {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	if _, ok := dbRepo.users[userId]; !ok {
+		return errors.New("foreign key constraint failed")
+	}
+	dbRepo.uploads = append(dbRepo.uploads, testUpload{userId: userId, key: key, createdAt: time.Now()})
+	return nil
+}
+
+// CountUploads counts the images a user uploaded since since
+func (dbRepo *testDBRepo) CountUploads(userId int, since time.Time) (int, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	count := 0
+	for _, upload := range dbRepo.uploads {
+		if upload.userId == userId && !upload.createdAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// DeleteUploads forgets the uploads made before before and removes their images from the image storage
+// unless a recipe uses them. It returns how many images it removed.
+func (dbRepo *testDBRepo) DeleteUploads(before time.Time) (int, error) {
+	dbRepo.mu.Lock()
+	defer dbRepo.mu.Unlock()
+
+	var keys []string
+	dbRepo.uploads = slices.DeleteFunc(dbRepo.uploads, func(upload testUpload) bool {
+		if upload.createdAt.Before(before) {
+			keys = append(keys, upload.key)
+			return true
+		}
+		return false
+	})
+	unused := dbRepo.unusedImageKeys(keys)
+	removeImages(dbRepo.App.Images, unused)
+	return len(unused), nil
+}
@@ -2,24 +2,80 @@ package repository
 
 import (
 	"github.com/popnfresh234/recipe-app-golang/internal/models"
+	"github.com/popnfresh234/recipe-app-golang/internal/pantry"
+	"time"
 )
 
 type DatabaseRepo interface {
 	GetAllRecipes() ([]models.Recipe, error)
 
-	GetRecipeDetails(recipeId int) (models.Recipe, error)
+	ListRecipes(offset, limit int, sort string) ([]models.Recipe, int, error)
+
+	SearchRecipes(query string, offset, limit int) ([]models.Recipe, int, error)
 
-	InsertRecipe(title string, image string, userId int) (int64, error)
+	MatchRecipes(p pantry.Pantry, limit int) ([]models.RecipeMatch, error)
+
+	GetRecipeDetails(recipeId int) (models.Recipe, error)
 
-	InsertIngredient(name, amount, unit string, recipeId int64) error
+	SaveRecipe(jsonRecipe models.JsonRecipe, userId int) (int64, error)
 
-	InsertDirection(direction string, recipeId int64) error
+	ReorderRecipe(recipeId int, order models.JsonRecipeOrder) error
 
 	GetUserByEmail(email, password string) (models.User, error)
 
 	InsertUser(name, email, password string) (models.User, error)
 
-	UpdateRecipe(jsonRecipe models.JsonRecipe) (models.Recipe, error)
-
 	DeleteRecipe(id int) error
+
+	GetUserRoles(userId int) (map[string]models.Role, error)
+
+	AssignRole(userId int, role string) error
+
+	RevokeRole(userId int, role string) error
+
+	GetUserById(id int) (models.User, error)
+
+	ListUsers(search string) ([]models.User, error)
+
+	SetUserDisabled(id int, disabled bool) error
+
+	DeleteUser(id int) error
+
+	InsertAdminAction(action models.AdminAction) error
+
+	GetAdminActions(limit int) ([]models.AdminAction, error)
+
+	InsertApiToken(userId int, name, tokenHash string) (models.ApiToken, error)
+
+	GetUserByApiToken(tokenHash string) (models.User, error)
+
+	ListApiTokens(userId int) ([]models.ApiToken, error)
+
+	DeleteApiToken(userId, id int) error
+
+	InsertShoppingList(userId int, name string, items []models.ShoppingListItem) (int64, error)
+
+	ListShoppingLists(userId int) ([]models.ShoppingList, error)
+
+	GetShoppingList(userId, id int) (models.ShoppingList, error)
+
+	CheckShoppingListItem(userId, listId, itemId int, checked bool) error
+
+	DeleteShoppingList(userId, id int) error
+
+	InsertMeal(userId, recipeId int, date time.Time, slot string) (int64, error)
+
+	ListMeals(userId int, from, to time.Time) ([]models.Meal, error)
+
+	DeleteMeal(userId, id int) error
+
+	SetCalendarToken(userId int, tokenHash string) error
+
+	GetUserByCalendarToken(tokenHash string) (models.User, error)
+
+	InsertUpload(userId int, key string) error
+
+	CountUploads(userId int, since time.Time) (int, error)
+
+	DeleteUploads(before time.Time) (int, error)
 }
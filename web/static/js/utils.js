@@ -1,44 +1,152 @@
-const IMAGE_SIZE = 400
-
-const resizeImage = (file, maxWidth, maxHeight, callback) => {
-    const reader = new FileReader();
-    reader.onload = function (event) {
-        const img = new Image();
-        img.onload = function () {
-            const canvas = document.createElement('canvas');
-            let width = img.width;
-            let height = img.height;
-
-            if (width > height) {
-                if (width > maxWidth) {
-                    height *= maxWidth / width;
-                    width = maxWidth;
-                }
-            } else {
-                if (height > maxHeight) {
-                    width *= maxHeight / height;
-                    height = maxHeight;
-                }
-            }
-
-            canvas.width = width;
-            canvas.height = height;
-            const ctx = canvas.getContext('2d');
-            ctx.drawImage(img, 0, 0, width, height);
-
-            const dataUrl = canvas.toDataURL('image/png');
-            const base64String = dataUrl.replace(/^data:image\/\w+;base64,/, '');
-            callback(base64String);
-        };
-        img.src = event.target.result;
-    };
-    reader.readAsDataURL(file);
-}
-
-
 notify = (msgType, msg) => {
     notie.alert({
         type: msgType,
         text: msg,
     })
-}
\ No newline at end of file
+}
+
+// csrfToken reads the CSRF token of the session, POSTs from page scripts send it in the X-CSRF-Token header
+const csrfToken = () => document.querySelector('meta[name="csrf-token"]').content
+
+// showFieldErrors shows the field errors of a JSON error response inline. elementFor finds the element to show
+// the errors of a path like title or ingredients[2].amount in, the errors of item fields are prefixed with the field
+const showFieldErrors = (fields, elementFor) => {
+    document.querySelectorAll(".field-error").forEach((el) => el.remove())
+    Object.entries(fields || {}).forEach(([path, messages]) => {
+        const el = elementFor(path)
+        if (!el) {
+            return
+        }
+        const field = path.match(/\]\.(\w+)$/)
+        const error = document.createElement("p")
+        error.className = "field-error p-1 text-xs text-red-500"
+        error.textContent = (field ? `${field[1]}: ` : "") + messages.join(" ")
+        el.appendChild(error)
+    })
+}
+
+// postRecipe posts a recipe from a page script, the page follows the redirect when it is saved
+// and shows the field errors of the response when it isn't
+const postRecipe = (url, recipe, elementFor) => {
+    fetch(url, {
+        method: "POST",
+        headers: {
+            "Content-Type": "application/json",
+            "X-CSRF-Token": csrfToken()
+        },
+        body: JSON.stringify(recipe)
+    }).then(async (res) => {
+        if (res.redirected === true) {
+            window.location.href = res.url
+            return
+        }
+        if ((res.headers.get("Content-Type") || "").startsWith("application/json")) {
+            const body = await res.json()
+            showFieldErrors(body.fields, elementFor)
+            notify("error", body.error)
+            return
+        }
+        notify("error", "Error saving recipe")
+    }).catch((err) => {
+        console.log(err)
+    })
+}
+
+// uploadImage uploads the image file picked on a recipe page, done is called with the id and url of the stored image
+// and the errors of the response are shown like the errors of a recipe
+const uploadImage = (file, elementFor, done) => {
+    const form = new FormData()
+    form.append("image", file)
+    fetch("/recipe/images", {
+        method: "POST",
+        headers: {
+            "X-CSRF-Token": csrfToken()
+        },
+        body: form
+    }).then(async (res) => {
+        if ((res.headers.get("Content-Type") || "").startsWith("application/json")) {
+            const body = await res.json()
+            showFieldErrors(body.fields, elementFor)
+            if (res.ok) {
+                done(body)
+                return
+            }
+            notify("error", body.error)
+            return
+        }
+        notify("error", "Error uploading image")
+    }).catch((err) => {
+        console.log(err)
+    })
+}
+
+// photoEditor lets a recipe page add photos with captions to photos, remove them and change their order.
+// It shows them in container and changes photos in place, new photos are uploaded and added to the end.
+const photoEditor = (container, photos, elementFor) => {
+    const list = document.createElement("div")
+    list.className = "flex flex-col gap-2"
+
+    const button = (text, onClick) => {
+        const el = document.createElement("button")
+        el.className = "w-16 std-button"
+        el.innerText = text
+        el.addEventListener("click", () => {
+            onClick()
+            render()
+        })
+        return el
+    }
+
+    const render = () => {
+        list.replaceChildren()
+        photos.forEach((photo, i) => {
+            const item = document.createElement("div")
+            item.className = "flex items-center gap-2 pt-2"
+
+            const img = document.createElement("img")
+            img.className = "w-24 rounded-md"
+            img.src = `/images/${photo.Image}`
+            img.alt = photo.Caption || ""
+
+            const caption = document.createElement("input")
+            caption.className = "std-input-rounded"
+            caption.placeholder = "caption"
+            caption.value = photo.Caption || ""
+            caption.addEventListener("input", (event) => {
+                photo.Caption = event.target.value
+            })
+
+            item.append(img, caption)
+            if (i > 0) {
+                item.appendChild(button("Up", () => photos.splice(i - 1, 2, photos[i], photos[i - 1])))
+            }
+            if (i < photos.length - 1) {
+                item.appendChild(button("Down", () => photos.splice(i, 2, photos[i + 1], photos[i])))
+            }
+            item.appendChild(button("Delete", () => photos.splice(i, 1)))
+            list.appendChild(item)
+        })
+    }
+
+    const fileInput = document.createElement("input")
+    fileInput.className = "mt-2 std-input-rounded"
+    fileInput.type = "file"
+    fileInput.accept = "image/*"
+    const upload = document.createElement("button")
+    upload.className = "mt-2 w-48 std-button"
+    upload.innerText = "Add Photo"
+    upload.addEventListener("click", () => {
+        const file = fileInput.files[0]
+        if (!file) {
+            return
+        }
+        uploadImage(file, elementFor, (uploaded) => {
+            photos.push({Image: uploaded.id, Caption: ""})
+            fileInput.value = ""
+            render()
+        })
+    })
+
+    container.append(list, fileInput, upload)
+    render()
+}
@@ -2,8 +2,12 @@ const has = (input) => {
     return input.length > 0
 }
 
+// A whole number, a decimal, a fraction, a mixed number or one with a unicode fraction, like ParseQuantity in models
+const AMOUNT_NUMBER = "(\\d*\\s*[½⅓⅔¼¾⅕⅖⅗⅘⅙⅚⅐⅛⅜⅝⅞⅑⅒]|(\\d+\\s+)?\\d+\\s*[/⁄]\\s*\\d+|\\d*\\.\\d+|\\d+)"
+
+// Checks an amount is a number, a range of numbers like 2-3 or "to taste"
 const validAmount = (amount) => {
-    const pattern = new RegExp("^\\d+\\/\\d+$|^\\d+(\\.\\d+)?$");
+    const pattern = new RegExp(`^\\s*(${AMOUNT_NUMBER}(\\s*(-|–|—|\\sto\\s)\\s*${AMOUNT_NUMBER})?|to\\s+taste)\\s*$`, "i")
     return pattern.test(amount)
 }
 